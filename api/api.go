@@ -13,20 +13,38 @@ import (
 )
 
 func Api[i any, o any](f func(InParameter i) (ret o, err error), options ...optionSetter) (out *ApiCtx[i, o]) {
+	fWithCtx := func(ctx context.Context, InParameter i) (ret o, err error) { return f(InParameter) }
+	return newApi(f, fWithCtx, reflect.ValueOf(f).Pointer(), options...)
+}
+
+// ApiCtxFunc creates an api whose function receives the context of the call.
+// the context is cancelled when the caller's deadline is exceeded, or the http client is gone.
+// to CallAt / CallEvery it, use the Func of rpc.Rpc[i, o]()
+func ApiCtxFunc[i any, o any](f func(ctx context.Context, InParameter i) (ret o, err error), options ...optionSetter) (out *ApiCtx[i, o]) {
+	return newApi(nil, f, reflect.ValueOf(f).Pointer(), options...)
+}
+
+// f is nil if the api is created by ApiCtxFunc, then Func calls FuncWithCtx with the default ctx
+func newApi[i any, o any](f func(InParameter i) (ret o, err error), fWithCtx func(ctx context.Context, InParameter i) (ret o, err error), funcPtr uintptr, options ...optionSetter) (out *ApiCtx[i, o]) {
 	var targetType reflect.Type = reflect.TypeOf(new(i)).Elem()
 	var option *Option = Option{ApiSourceRds: "default", ApiKey: utils.ApiNameByType(reflect.Zero(targetType).Interface())}.mergeNewOptions(options...)
 
 	out = &ApiCtx[i, o]{Name: option.ApiKey, ApiSourceRds: option.ApiSourceRds, Ctx: context.Background(),
-		Validate: redisdb.NeedValidate(reflect.TypeOf(new(i)).Elem()),
-		Func:     f,
+		Validate:    redisdb.NeedValidate(reflect.TypeOf(new(i)).Elem()),
+		Func:        f,
+		FuncWithCtx: fWithCtx,
 	}
 
 	if len(out.Name) == 0 {
 		logger.Debug().Msg("ApiNamed service created failed!")
-		out.Func = func(InParameter i) (ret o, err error) {
+		out.FuncWithCtx = func(ctx context.Context, InParameter i) (ret o, err error) {
 			logger.Warn().Str("service misnamed", out.Name).Send()
 			return ret, vars.ErrApiNameEmpty
 		}
+		out.Func = nil
+	}
+	if out.Func == nil {
+		out.Func = func(InParameter i) (ret o, err error) { return out.FuncWithCtx(out.Ctx, InParameter) }
 	}
 
 	// Error handling: Check for naming conflicts
@@ -37,9 +55,26 @@ func Api[i any, o any](f func(InParameter i) (ret o, err error), options ...opti
 
 	httpapi.ApiViaHttp.Set(out.Name, out)
 
-	funcPtr := reflect.ValueOf(f).Pointer()
 	httpapi.Fun2Api.Set(funcPtr, out)
 
+	ApiStreamConsumer.Set(out.Name, newStreamConsumer(option.Group, option.Consumer))
+	if option.Concurrency > 0 {
+		ApiWorkerSlots.Set(out.Name, make(chan struct{}, option.Concurrency))
+	}
+	if option.CacheTTL > 0 {
+		ApiCaches.Set(out.Name, newApiCache(out.Name, out.ApiSourceRds, option.CacheTTL, option.CacheSize, option.CacheTags))
+	}
+	if option.IdempotencyTTL > 0 {
+		ApiIdempotencyTTL.Set(out.Name, option.IdempotencyTTL)
+	}
+	for _, limit := range option.RateLimits {
+		limit.Target = out.Name
+		httpapi.AddRateLimit(limit)
+	}
+	if option.Reliable {
+		ApiReliableDelivery.Set(out.Name, newReliableDelivery(option.MaxRetry, option.RetryIdle))
+	}
+
 	apis, _ := APIGroupByRdsToReceiveJob.Get(out.ApiSourceRds)
 	apis = append(apis, out.Name)
 	APIGroupByRdsToReceiveJob.Set(out.ApiSourceRds, apis)
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/doptime/config/cfgredis"
+	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/logger"
+	lru "github.com/hashicorp/golang-lru/v2"
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// CacheInvalidateChannel is the redis channel telling the instances to purge the local caches of the tags
+const CacheInvalidateChannel = "cache:invalidate"
+
+// ApiCache caches the marshaled results of the api, keyed by the hash of the decoded input
+type ApiCache struct {
+	TTL time.Duration
+	// Tags are used by InvalidateCache, the api name is always one of the tags
+	Tags    []string
+	RdsName string
+	// local is the in-process lru, the results are cached in redis if it's nil
+	local *lru.Cache[string, cachedResult]
+
+	hits, misses atomic.Int64
+	// calls are the running calls of the missing entries, the callers of the same entry wait for them
+	mu    sync.Mutex
+	calls map[string]*cacheCall
+}
+
+type cachedResult struct {
+	value    []byte
+	expireAt time.Time
+}
+
+type cacheCall struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// ApiCaches holds the apis cached by WithCache or WithLocalCache, keyed by api name
+var ApiCaches = cmap.New[*ApiCache]()
+
+// subscribedRds are the datasources whose CacheInvalidateChannel is subscribed
+var subscribedRds = cmap.New[bool]()
+
+func newApiCache(apiName, rdsName string, ttl time.Duration, size int, tags []string) (c *ApiCache) {
+	c = &ApiCache{TTL: ttl, Tags: append([]string{apiName}, tags...), RdsName: rdsName, calls: map[string]*cacheCall{}}
+	if size > 0 {
+		c.local, _ = lru.New[string, cachedResult](size)
+		if subscribedRds.SetIfAbsent(rdsName, true) {
+			go subscribeCacheInvalidation(rdsName)
+		}
+	}
+	return c
+}
+
+// CacheStats returns the hits & misses of the cached api. the callers waiting for the running call of the same input are hits
+func CacheStats(apiName string) (hits, misses int64) {
+	if c, ok := ApiCaches.Get(apiName); ok {
+		return c.hits.Load(), c.misses.Load()
+	}
+	return 0, 0
+}
+
+// canonicalInput is the msgpack of the input with map keys sorted, the same input always has the same bytes
+func canonicalInput(in interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	err := enc.Encode(in)
+	return buf.Bytes(), err
+}
+
+// decodeResult unmarshals the result saved by cache or idempotency
+func (a *ApiCtx[i, o]) decodeResult(b []byte) (ret o, err error) {
+	//if o type is a pointer, use reflect.New to create a new pointer
+	if oType := reflect.TypeOf((*o)(nil)).Elem(); oType.Kind() == reflect.Ptr {
+		ret = reflect.New(oType.Elem()).Interface().(o)
+		return ret, msgpack.Unmarshal(b, ret)
+	}
+	return ret, msgpack.Unmarshal(b, &ret)
+}
+
+// callCached runs the api unless the result of the input is cached. cached is true if the result is not computed by this call
+func (a *ApiCtx[i, o]) callCached(ctx context.Context, in i, input []byte) (ret o, cached bool, err error) {
+	c, ok := ApiCaches.Get(a.Name)
+	if !ok {
+		ret, err = a.FuncWithCtx(ctx, in)
+		return ret, false, err
+	}
+	b, cached, err := c.get(ctx, "cache:"+a.Name+":"+httpapi.Fingerprint(input), func() ([]byte, error) {
+		if ret, err = a.FuncWithCtx(ctx, in); err != nil {
+			return nil, err
+		}
+		return msgpack.Marshal(ret)
+	})
+	if err != nil || !cached {
+		return ret, false, err
+	}
+	ret, err = a.decodeResult(b)
+	return ret, true, err
+}
+
+// get returns the cached value of key, or computes it. only one caller computes the missing entry,
+// in the process by calls, and across the instances by the lock in redis
+func (c *ApiCache) get(ctx context.Context, key string, compute func() ([]byte, error)) (value []byte, cached bool, err error) {
+	rds, ok := cfgredis.Servers.Get(c.RdsName)
+	if !ok {
+		return nil, false, fmt.Errorf("DataSource not defined in enviroment %s", c.RdsName)
+	}
+	if value, ok = c.lookup(ctx, rds, key); ok {
+		c.hits.Add(1)
+		return value, true, nil
+	}
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			c.hits.Add(1)
+			return call.value, true, call.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	c.misses.Add(1)
+	if c.local == nil {
+		unlock, value, ok := c.lockOrWait(ctx, rds, key)
+		if ok {
+			call.value = value
+			return value, true, nil
+		}
+		defer unlock()
+	}
+	if call.value, call.err = compute(); call.err == nil {
+		c.store(rds, key, call.value)
+	}
+	return call.value, false, call.err
+}
+
+func (c *ApiCache) lookup(ctx context.Context, rds *redis.Client, key string) (value []byte, ok bool) {
+	if c.local != nil {
+		result, ok := c.local.Get(key)
+		return result.value, ok && time.Now().Before(result.expireAt)
+	}
+	value, err := rds.Get(ctx, key).Bytes()
+	return value, err == nil
+}
+
+func (c *ApiCache) store(rds *redis.Client, key string, value []byte) {
+	if c.local != nil {
+		c.local.Add(key, cachedResult{value: value, expireAt: time.Now().Add(c.TTL)})
+		return
+	}
+	//the tag sets live as long as their newest entry
+	pipe := rds.Pipeline()
+	ctx := context.Background()
+	pipe.Set(ctx, key, value, c.TTL)
+	for _, tag := range c.Tags {
+		pipe.SAdd(ctx, cacheTagKey(tag), key)
+		pipe.Expire(ctx, cacheTagKey(tag), c.TTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Warn().Err(err).Str("key", key).Msg("api result not cached")
+	}
+}
+
+// lockOrWait locks the missing entry in redis. if it's locked by another instance, it waits for the entry.
+// ok is true if the entry is computed by others. otherwise the caller computes it, then unlocks
+func (c *ApiCache) lockOrWait(ctx context.Context, rds *redis.Client, key string) (unlock func(), value []byte, ok bool) {
+	lockKey, lockTTL := key+":lock", time.Second*10
+	if deadline, ok := ctx.Deadline(); ok {
+		lockTTL = time.Until(deadline)
+	}
+	for {
+		if acquired, err := rds.SetNX(ctx, lockKey, 1, lockTTL).Result(); err != nil || acquired {
+			return func() { rds.Del(context.Background(), lockKey) }, nil, false
+		}
+		//the lock is held by another instance, wait for the entry, or the lock released without entry
+		select {
+		case <-ctx.Done():
+			return func() {}, nil, false
+		case <-time.After(time.Millisecond * 20):
+		}
+		if value, ok = c.lookup(ctx, rds, key); ok {
+			return nil, value, true
+		}
+	}
+}
+
+func cacheTagKey(tag string) string {
+	return "cache:tag:" + tag
+}
+
+// InvalidateCache removes the cached results of the apis with any of the tags, i.g. the api name, or the tags of WithCache.
+// the local caches of all the instances are purged
+func InvalidateCache(tags ...string) (err error) {
+	rdsNames := map[string]bool{}
+	for _, c := range ApiCaches.Items() {
+		if slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(c.Tags, tag) }) {
+			rdsNames[c.RdsName] = true
+		}
+	}
+	if len(rdsNames) == 0 {
+		rdsNames["default"] = true
+	}
+	purgeLocalCaches(tags)
+	ctx := context.Background()
+	for rdsName := range rdsNames {
+		rds, ok := cfgredis.Servers.Get(rdsName)
+		if !ok {
+			err = errors.Join(err, fmt.Errorf("DataSource not defined in enviroment %s", rdsName))
+			continue
+		}
+		for _, tag := range tags {
+			keys, e := rds.SMembers(ctx, cacheTagKey(tag)).Result()
+			if e == nil {
+				e = rds.Del(ctx, append(keys, cacheTagKey(tag))...).Err()
+			}
+			err = errors.Join(err, e)
+		}
+		err = errors.Join(err, rds.Publish(ctx, CacheInvalidateChannel, strings.Join(tags, ",")).Err())
+	}
+	return err
+}
+
+// purgeLocalCaches purges the local caches of the apis with any of the tags
+func purgeLocalCaches(tags []string) {
+	for _, c := range ApiCaches.Items() {
+		if c.local != nil && slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(c.Tags, tag) }) {
+			c.local.Purge()
+		}
+	}
+}
+
+func subscribeCacheInvalidation(rdsName string) {
+	rds, ok := cfgredis.Servers.Get(rdsName)
+	if !ok {
+		logger.Error().Str("DataSource not defined in enviroment while subscribeCacheInvalidation", rdsName).Send()
+		return
+	}
+	for msg := range rds.Subscribe(context.Background(), CacheInvalidateChannel).Channel() {
+		purgeLocalCaches(strings.Split(msg.Payload, ","))
+	}
+}
@@ -2,26 +2,37 @@ package api
 
 import (
 	"context"
-	"fmt"
-	"sort"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/doptime/config/cfgredis"
 	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/doptime/utils"
 	"github.com/doptime/logger"
 	cmap "github.com/orcaman/concurrent-map/v2"
 	"github.com/redis/go-redis/v9"
 )
 
-type TaskAtFuture struct {
-	ServiceName  string
-	TimeAtUnixNs int64
-}
-
-var TasksAtFutureList = []*TaskAtFuture{}
-var mut sync.Mutex = sync.Mutex{}
+// CallAtPollInterval is the longest the dispatcher sleeps. it wakes when the earliest task is due,
+// the tasks added meanwhile with an earlier time are fired at most CallAtPollInterval late
+var CallAtPollInterval = time.Second
+
+// claim the due tasks atomically, and move them into the api stream.
+// because the script is atomic, each task is fired by exactly one instance;
+// and because the task is put into the stream, it is delivered by the consumer group like any other job
+// KEYS[1] schedule zset, KEYS[2] data hash, KEYS[3] api stream; ARGV[1] now in unix milli, ARGV[2] max count
+var callAtClaimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	local data = redis.call('HGET', KEYS[2], id)
+	redis.call('HDEL', KEYS[2], id)
+	if data and string.len(data) > 0 then
+		redis.call('XADD', KEYS[3], 'MAXLEN', '~', 4096, '*', 'data', data)
+	end
+end
+return #ids
+`)
 
 func GetServiceDB(serviceName string) (db *redis.Client, ok bool) {
 	var (
@@ -35,31 +46,22 @@ func GetServiceDB(serviceName string) (db *redis.Client, ok bool) {
 	return db, exists
 }
 
-// the reason why rpc can be removed locally is that the when doing rpc. api will recheck the data. only non empty data will be processed
+// rpcCallAtTaskRemoveOne and rpcCallAtTaskAddOne keep the stream protocol of older callers working,
+// which send the CallAt tasks through the api stream with field "timeAt"
 func rpcCallAtTaskRemoveOne(serviceName string, timeAtStr string) {
 	var (
 		rds, redisExists = GetServiceDB(serviceName)
-		TimeAtUnixNs     int64
-		err              error
+		c                = context.Background()
 	)
 	if !redisExists {
 		logger.Error().Str("rpcCallAtTaskRemoveOne missing redis server", serviceName).Send()
 		return
 	}
-
-	if TimeAtUnixNs, err = strconv.ParseInt(timeAtStr, 10, 64); err != nil {
+	pipeline := rds.TxPipeline()
+	pipeline.ZRem(c, utils.CallAtScheduleKey(serviceName), timeAtStr)
+	pipeline.HDel(c, utils.CallAtDataKey(serviceName), timeAtStr)
+	if _, err := pipeline.Exec(c); err != nil {
 		logger.Info().Err(err).Send()
-		return
-	}
-
-	index := sort.Search(len(TasksAtFutureList), func(i int) bool {
-		return TasksAtFutureList[i].TimeAtUnixNs == TimeAtUnixNs && TasksAtFutureList[i].ServiceName == serviceName
-	})
-	if index >= 0 && index < len(TasksAtFutureList) {
-		mut.Lock()
-		TasksAtFutureList = append(TasksAtFutureList[:index], TasksAtFutureList[index+1:]...)
-		mut.Unlock()
-		go rds.HDel(context.Background(), serviceName+":delay", timeAtStr)
 	}
 }
 
@@ -67,134 +69,121 @@ func rpcCallAtTaskRemoveOne(serviceName string, timeAtStr string) {
 func rpcCallAtTaskAddOne(serviceName string, timeAtStr string, bytesValue string) {
 	var (
 		rds, redisExists = GetServiceDB(serviceName)
+		c                = context.Background()
+		timeAtUnixNs     int64
 		err              error
 	)
 	if !redisExists {
 		logger.Error().Str("rpcCallAtTaskAddOne missing redis server", serviceName).Send()
 		return
 	}
-	task := &TaskAtFuture{ServiceName: serviceName}
-	if task.TimeAtUnixNs, err = strconv.ParseInt(timeAtStr, 10, 64); err != nil {
+	if timeAtUnixNs, err = strconv.ParseInt(timeAtStr, 10, 64); err != nil {
 		logger.Info().Err(err).Send()
 		return
 	}
-	if cmd := rds.HSet(context.Background(), serviceName+":delay", timeAtStr, bytesValue); cmd.Err() != nil {
-		logger.Info().Err(cmd.Err()).Send()
-		return
+	pipeline := rds.TxPipeline()
+	pipeline.HSet(c, utils.CallAtDataKey(serviceName), timeAtStr, bytesValue)
+	pipeline.ZAdd(c, utils.CallAtScheduleKey(serviceName), redis.Z{Score: float64(time.Unix(0, timeAtUnixNs).UnixMilli()), Member: timeAtStr})
+	if _, err = pipeline.Exec(c); err != nil {
+		logger.Info().Err(err).Send()
 	}
-	index := sort.Search(len(TasksAtFutureList), func(i int) bool { return TasksAtFutureList[i].TimeAtUnixNs < task.TimeAtUnixNs })
-
-	// Insert the new task into the TasksAtFuture at the found index.
-	mut.Lock()
-	TasksAtFutureList = append(TasksAtFutureList[:index], append([]*TaskAtFuture{task}, TasksAtFutureList[index:]...)...)
-	mut.Unlock()
 }
-func rpcCallAtDispatcher() {
+
+// rpcCallAtDispatcher claims the due tasks of the apis in one data source.
+// one round trip reads the earliest task of every api, the claim script runs only for the apis with due tasks
+func rpcCallAtDispatcher(services []string, rds *redis.Client) {
 	var (
-		data                  string
-		TaskAtFutureNs, nowNs int64
-		err                   error
-		cmd                   []redis.Cmder
-		rds                   *redis.Client
-		redisExists           bool
+		c       = context.Background()
+		cmd     []redis.Cmder
+		claimed int
+		err     error
 	)
 	for {
-		if len(TasksAtFutureList) == 0 {
-			time.Sleep(time.Millisecond * 100)
-			continue
+		now := time.Now()
+		nowMs, wakeAtMs := now.UnixMilli(), now.Add(CallAtPollInterval).UnixMilli()
+		pipeline := rds.Pipeline()
+		for _, service := range services {
+			pipeline.ZRangeWithScores(c, utils.CallAtScheduleKey(service), 0, 0)
 		}
-		nowNs = time.Now().UnixNano()
-		mut.Lock()
-		task := TasksAtFutureList[0]
-		mut.Unlock()
-		TaskAtFutureNs = task.TimeAtUnixNs
-
-		if timeSpan := TaskAtFutureNs - nowNs; timeSpan > 0 {
-			if timeSpan > 100*1000*1000 {
-				timeSpan = 100 * 1000 * 1000
-			}
-			time.Sleep(time.Duration(timeSpan))
+		if cmd, err = pipeline.Exec(c); err != nil && err != redis.Nil {
+			logger.Error().Err(err).Msg("rpcCallAtDispatcher query earliest tasks failed")
+			time.Sleep(CallAtPollInterval)
 			continue
 		}
-		TasksAtFutureList = TasksAtFutureList[1:]
-		strTime := strconv.FormatInt(TaskAtFutureNs, 10)
-		if rds, redisExists = GetServiceDB(task.ServiceName); !redisExists {
-			logger.Error().Str("rpcCallAtDispatcher missing redis server", task.ServiceName).Send()
-			return
-		}
-		pipeline := rds.Pipeline()
-		pipeline.HGet(context.Background(), task.ServiceName+":delay", strTime)
-		pipeline.HDel(context.Background(), task.ServiceName+":delay", strTime)
-		if cmd, err = pipeline.Exec(context.Background()); err != nil {
-			logger.Info().Err(err).Send()
-			continue
-		} else if len(cmd) != 2 || cmd[1].Err() != nil {
-			continue
+		for i, service := range services {
+			earliest := cmd[i].(*redis.ZSliceCmd).Val()
+			if len(earliest) == 0 {
+				continue
+			} else if dueMs := int64(earliest[0].Score); dueMs > nowMs {
+				wakeAtMs = min(wakeAtMs, dueMs)
+				continue
+			}
+			keys := []string{utils.CallAtScheduleKey(service), utils.CallAtDataKey(service), service}
+			if claimed, err = callAtClaimScript.Run(c, rds, keys, nowMs, ServiceBatchSize).Int(); err != nil {
+				logger.Error().Str("service", service).Err(err).Msg("rpcCallAtDispatcher claim failed")
+				continue
+			}
+			logger.Debug().Str("service", service).Int("claimed", claimed).Msg("CallAt tasks fired")
+			//more tasks may be due
+			if int64(claimed) >= ServiceBatchSize {
+				wakeAtMs = nowMs
+			}
 		}
-		if data = cmd[0].(*redis.StringCmd).Val(); len(data) == 0 {
-			continue
+		time.Sleep(time.Until(time.UnixMilli(wakeAtMs)))
+	}
+}
+
+// migrateLegacyCallAtTasks moves the tasks of the keys without hash tag, written by the older versions, to the current keys
+func migrateLegacyCallAtTasks(c context.Context, rds *redis.Client, service string) (err error) {
+	var tasks map[string]string
+	if tasks, err = rds.HGetAll(c, utils.LegacyCallAtDataKey(service)).Result(); err != nil || len(tasks) == 0 {
+		return err
+	}
+	pipeline := rds.Pipeline()
+	for taskID, data := range tasks {
+		//the id is the unix nano of the fire time
+		if timeAt, err := strconv.ParseInt(taskID, 10, 64); err == nil {
+			pipeline.HSetNX(c, utils.CallAtDataKey(service), taskID, data)
+			pipeline.ZAddNX(c, utils.CallAtScheduleKey(service), redis.Z{Score: float64(time.Unix(0, timeAt).UnixMilli()), Member: taskID})
 		}
-		fmt.Println("rpcCallAtRoutine key", task.ServiceName+":delay field", TaskAtFutureNs, "data length", len(data), "data", string(data))
-		CallApiLocallyAndSendBackResult(task.ServiceName, strconv.FormatInt(TaskAtFutureNs, 10), []byte(data))
 	}
+	if _, err = pipeline.Exec(c); err != nil {
+		return err
+	}
+	return rds.Del(c, utils.LegacyCallAtDataKey(service), utils.LegacyCallAtScheduleKey(service)).Err()
 }
 
 var APIGroupByRdsToReceiveJob = cmap.New[[]string]()
 
+// rpcCallAtTasksLoad migrates the tasks of the older versions, then starts the dispatchers.
+// tasks are kept in redis, so nothing is lost across restarts
 func rpcCallAtTasksLoad() {
 	var (
-		timeAtStrs []string
-		cmd        []redis.Cmder
-		err        error
-		rds        *redis.Client
-		exists     bool
+		rds    *redis.Client
+		exists bool
+		c      = context.Background()
 	)
+	ApiStartingWaiter()
 	logger.Info().Msg("rpcCallAtTasksLoading started")
-	var _TasksAtFutureList = []*TaskAtFuture{}
 	for _, dataSource := range APIGroupByRdsToReceiveJob.Keys() {
 		services, ok := APIGroupByRdsToReceiveJob.Get(dataSource)
 		if !ok {
 			continue
 		}
 		if rds, exists = cfgredis.Servers.Get(dataSource); !exists {
-			logger.Info().AnErr("err LoadDelayApiTask, ", err).Send()
+			logger.Info().Str("DataSource not defined in enviroment while rpcCallAtTasksLoad", dataSource).Send()
 			continue
 		}
-		pipeline := rds.Pipeline()
 		for _, service := range services {
-			pipeline.HKeys(context.Background(), service+":delay")
-		}
-		if cmd, err = pipeline.Exec(context.Background()); err != nil {
-			logger.Info().AnErr("err LoadDelayApiTask, ", err).Send()
-			continue
-		}
-
-		for i, service := range services {
-			if err = cmd[i].(*redis.StringSliceCmd).Err(); err != nil {
-				continue
+			if err := migrateLegacyCallAtTasks(c, rds, service); err != nil {
+				logger.Info().Str("service", service).AnErr("err migrate CallAt tasks, ", err).Send()
 			}
-			timeAtStrs = cmd[i].(*redis.StringSliceCmd).Val()
-			for _, timeAtStr := range timeAtStrs {
-				if timeAt, err := strconv.ParseInt(timeAtStr, 10, 64); err == nil {
-					_TasksAtFutureList = append(_TasksAtFutureList, &TaskAtFuture{ServiceName: service, TimeAtUnixNs: timeAt})
-				}
+			if err := migrateLegacyCallEveryTasks(c, rds, service); err != nil {
+				logger.Info().Str("service", service).AnErr("err migrate CallEvery tasks, ", err).Send()
 			}
 		}
-
+		go rpcCallAtDispatcher(services, rds)
+		go rpcCallEveryDispatcher(services, rds)
 	}
-	sort.Slice(_TasksAtFutureList, func(i, j int) bool {
-		return _TasksAtFutureList[i].TimeAtUnixNs < _TasksAtFutureList[j].TimeAtUnixNs
-	})
-	mut.Lock()
-	TasksAtFutureList = _TasksAtFutureList
-	mut.Unlock()
 	logger.Info().Msg("rpcCallAtTasksLoading completed")
 }
-func init() {
-	go func() {
-		rpcCallAtTasksLoad()
-
-		rpcCallAtDispatcher()
-	}()
-
-}
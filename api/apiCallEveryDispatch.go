@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/doptime/doptime/utils"
+	"github.com/doptime/logger"
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// CallEveryPollInterval is the interval to check due recurring tasks
+var CallEveryPollInterval = time.Second
+
+// fire the task only if its score is still the one we read. the next fire time is calculated by the caller, because lua can not parse cron.
+// the compare-and-set makes sure every tick is fired by exactly one instance
+// KEYS[1] schedule zset, KEYS[2] data hash, KEYS[3] api stream; ARGV[1] id, ARGV[2] expected score, ARGV[3] next score
+var callEveryFireScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+local data = redis.call('HGET', KEYS[2], ARGV[1])
+if data and string.len(data) > 0 then
+	redis.call('XADD', KEYS[3], 'MAXLEN', '~', 4096, '*', 'data', data)
+end
+return 1
+`)
+
+var parsedSchedules = cmap.New[utils.Schedule]()
+
+func scheduleOfSpec(spec string) (schedule utils.Schedule, err error) {
+	if schedule, ok := parsedSchedules.Get(spec); ok {
+		return schedule, nil
+	}
+	if schedule, err = utils.ParseSchedule(spec); err == nil {
+		parsedSchedules.Set(spec, schedule)
+	}
+	return schedule, err
+}
+
+// rpcCallEveryDispatcher fires the due recurring tasks of the apis in one data source
+func rpcCallEveryDispatcher(services []string, rds *redis.Client) {
+	var (
+		c   = context.Background()
+		cmd []redis.Cmder
+		err error
+	)
+	for {
+		time.Sleep(CallEveryPollInterval)
+		now := time.Now()
+		pipeline := rds.Pipeline()
+		for _, service := range services {
+			pipeline.ZRangeByScoreWithScores(c, utils.CallEveryScheduleKey(service), &redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(now.UnixMilli(), 10), Count: ServiceBatchSize})
+		}
+		if cmd, err = pipeline.Exec(c); err != nil && err != redis.Nil {
+			logger.Error().Err(err).Msg("rpcCallEveryDispatcher query due tasks failed")
+			continue
+		}
+		for i, service := range services {
+			if due := cmd[i].(*redis.ZSliceCmd).Val(); len(due) > 0 {
+				fireEveryTasks(c, rds, service, due, now)
+			}
+		}
+	}
+}
+
+func fireEveryTasks(c context.Context, rds *redis.Client, service string, due []redis.Z, now time.Time) {
+	var (
+		ids      = make([]string, len(due))
+		specs    []interface{}
+		schedule utils.Schedule
+		err      error
+	)
+	for i, z := range due {
+		ids[i] = z.Member.(string)
+	}
+	if specs, err = rds.HMGet(c, utils.CallEverySpecKey(service), ids...).Result(); err != nil {
+		logger.Error().Str("service", service).Err(err).Msg("load recurring task specs failed")
+		return
+	}
+	keys := []string{utils.CallEveryScheduleKey(service), utils.CallEveryDataKey(service), service}
+	for i, z := range due {
+		spec, _ := specs[i].(string)
+		if schedule, err = scheduleOfSpec(spec); err != nil {
+			//the task is cancelled or broken, stop scheduling it
+			logger.Error().Str("service", service).Str("task", ids[i]).Str("spec", spec).Err(err).Msg("invalid recurring task removed from schedule")
+			rds.ZRem(c, utils.CallEveryScheduleKey(service), ids[i])
+			continue
+		}
+		//missed ticks are skipped, the next tick is always in the future
+		next := schedule.Next(now)
+		if next.IsZero() {
+			logger.Error().Str("service", service).Str("task", ids[i]).Str("spec", spec).Msg("recurring task never fires again, removed from schedule")
+			rds.ZRem(c, utils.CallEveryScheduleKey(service), ids[i])
+			continue
+		}
+		if err = callEveryFireScript.Run(c, rds, keys, ids[i], int64(z.Score), next.UnixMilli()).Err(); err != nil {
+			logger.Error().Str("service", service).Str("task", ids[i]).Err(err).Msg("fire recurring task failed")
+		}
+	}
+}
+
+// migrateLegacyCallEveryTasks moves the recurring tasks of the keys without hash tag, written by the older versions, to the current keys
+func migrateLegacyCallEveryTasks(c context.Context, rds *redis.Client, service string) (err error) {
+	legacySpec, legacyData, legacySchedule := utils.LegacyCallEveryKeys(service)
+	var specs, data map[string]string
+	if specs, err = rds.HGetAll(c, legacySpec).Result(); err != nil || len(specs) == 0 {
+		return err
+	}
+	if data, err = rds.HGetAll(c, legacyData).Result(); err != nil {
+		return err
+	}
+	schedule, err := rds.ZRangeWithScores(c, legacySchedule, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	pipeline := rds.Pipeline()
+	for taskID, spec := range specs {
+		pipeline.HSetNX(c, utils.CallEverySpecKey(service), taskID, spec)
+		pipeline.HSetNX(c, utils.CallEveryDataKey(service), taskID, data[taskID])
+	}
+	//the paused tasks are not in the schedule
+	for _, z := range schedule {
+		pipeline.ZAddNX(c, utils.CallEveryScheduleKey(service), z)
+	}
+	if _, err = pipeline.Exec(c); err != nil {
+		return err
+	}
+	return rds.Del(c, legacySpec, legacyData, legacySchedule).Err()
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/doptime/logger"
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultGroup and DefaultConsumer can be overwritten by [Api] Group / Consumer in toml
+var DefaultGroup = "group0"
+
+// DefaultConsumer is stable in the life of the process, and unique among replicas: hostname-pid
+var DefaultConsumer = func() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "doptime"
+	}
+	return hostname + "-" + strconv.Itoa(os.Getpid())
+}()
+
+var ConsumerHeartbeatInterval = time.Second * 10
+
+// consumers without heartbeat for ConsumerDeadAfter are regarded as dead, and removed from the group once nothing is pending
+var ConsumerDeadAfter = time.Minute
+
+// StreamConsumer is the consumer group & consumer name used to read the stream of an api
+type StreamConsumer struct {
+	Group    string
+	Consumer string
+}
+
+var ApiStreamConsumer = cmap.New[*StreamConsumer]()
+
+func newStreamConsumer(group, consumer string) *StreamConsumer {
+	if group == "" {
+		group = DefaultGroup
+	}
+	if consumer == "" {
+		consumer = DefaultConsumer
+	}
+	return &StreamConsumer{Group: group, Consumer: consumer}
+}
+
+// ConsumerOf returns the group & consumer of the api. apis not registered locally use the defaults
+func ConsumerOf(apiName string) *StreamConsumer {
+	if consumer, ok := ApiStreamConsumer.Get(apiName); ok {
+		return consumer
+	}
+	return newStreamConsumer("", "")
+}
+
+// zset of consumer name => last heartbeat in unix milli
+func ConsumerHeartbeatKey(apiName, group string) string {
+	return apiName + ":consumers:" + group
+}
+
+// consumerHeartbeat registers the consumers of the apis, and removes the dead consumers of the same groups
+func consumerHeartbeat(serviceNames []string, rds *redis.Client) {
+	c := context.Background()
+	ApiStartingWaiter()
+	for {
+		now := time.Now()
+		pipeline := rds.Pipeline()
+		for _, apiName := range serviceNames {
+			consumer := ConsumerOf(apiName)
+			pipeline.ZAdd(c, ConsumerHeartbeatKey(apiName, consumer.Group), redis.Z{Score: float64(now.UnixMilli()), Member: consumer.Consumer})
+		}
+		if _, err := pipeline.Exec(c); err != nil {
+			logger.Error().Err(err).Msg("consumer heartbeat failed")
+		}
+		for _, apiName := range serviceNames {
+			removeDeadConsumers(c, rds, apiName, ConsumerOf(apiName), now)
+		}
+		time.Sleep(ConsumerHeartbeatInterval)
+	}
+}
+
+// a consumer is removed only when it holds no pending entries. pending entries of reliable apis are reclaimed by XAUTOCLAIM first
+func removeDeadConsumers(c context.Context, rds *redis.Client, apiName string, self *StreamConsumer, now time.Time) {
+	var (
+		heartbeatKey = ConsumerHeartbeatKey(apiName, self.Group)
+		consumers    []redis.XInfoConsumer
+		lastBeat     float64
+		err          error
+	)
+	if consumers, err = rds.XInfoConsumers(c, apiName, self.Group).Result(); err != nil {
+		return
+	}
+	deadline := now.Add(-ConsumerDeadAfter)
+	for _, consumer := range consumers {
+		if consumer.Name == self.Consumer || consumer.Pending > 0 || consumer.Idle < ConsumerDeadAfter {
+			continue
+		}
+		if lastBeat, err = rds.ZScore(c, heartbeatKey, consumer.Name).Result(); err == nil && int64(lastBeat) > deadline.UnixMilli() {
+			continue
+		}
+		if err = rds.XGroupDelConsumer(c, apiName, self.Group, consumer.Name).Err(); err != nil {
+			logger.Error().Str("api", apiName).Str("consumer", consumer.Name).Err(err).Msg("XGroupDelConsumer failed")
+			continue
+		}
+		logger.Info().Str("api", apiName).Str("group", self.Group).Str("consumer", consumer.Name).Msg("dead consumer removed")
+	}
+	rds.ZRemRangeByScore(c, heartbeatKey, "-inf", strconv.FormatInt(deadline.UnixMilli(), 10))
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/doptime/config/cfgredis"
+	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/doptime/utils"
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ApiIdempotencyTTL holds the apis made idempotent by WithIdempotency, keyed by api name
+var ApiIdempotencyTTL = cmap.New[time.Duration]()
+
+// idempotencyKey is the redis key of the call. ok is false if the call carries no key and the api is not made idempotent
+func (a *ApiCtx[i, o]) idempotencyKey(ctx context.Context, fingerprint string) (key string, ttl time.Duration, ok bool) {
+	key = utils.IdempotencyKeyOf(ctx)
+	ttl, idempotentApi := ApiIdempotencyTTL.Get(a.Name)
+	if key == "" && !idempotentApi {
+		return "", 0, false
+	} else if key == "" {
+		key = fingerprint
+	} else if !idempotentApi {
+		ttl = httpapi.DefaultIdempotencyTTL
+	}
+	return "idempotency:" + a.Name + ":" + key, ttl, true
+}
+
+// callIdempotently runs the api once per idempotency key, the duplicates get the saved result.
+// replayed is true if the result is saved by idempotency or cache, rather than computed by this call
+func (a *ApiCtx[i, o]) callIdempotently(ctx context.Context, in i) (ret o, replayed bool, err error) {
+	var (
+		rds      *redis.Client
+		input, b []byte
+		key      string
+		ttl      time.Duration
+		ok       bool
+		cached   bool
+	)
+	if input, err = canonicalInput(in); err != nil {
+		return ret, false, err
+	}
+	fingerprint := httpapi.Fingerprint(input)
+	if key, ttl, ok = a.idempotencyKey(ctx, fingerprint); !ok {
+		return a.callCached(ctx, in, input)
+	}
+	if rds, ok = cfgredis.Servers.Get(a.ApiSourceRds); !ok {
+		return ret, false, fmt.Errorf("DataSource not defined in enviroment %s", a.ApiSourceRds)
+	}
+	b, replayed, err = httpapi.Idempotent(ctx, rds, key, fingerprint, ttl, func() ([]byte, error) {
+		if ret, cached, err = a.callCached(ctx, in, input); err != nil {
+			return nil, err
+		}
+		return msgpack.Marshal(ret)
+	})
+	if err != nil || !replayed {
+		return ret, cached, err
+	}
+	ret, err = a.decodeResult(b)
+	return ret, true, err
+}
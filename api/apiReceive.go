@@ -8,6 +8,9 @@ import (
 
 	"github.com/doptime/config/cfgredis"
 	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/doptime/lib"
+	"github.com/doptime/doptime/utils"
+	"github.com/doptime/doptime/vars"
 	"github.com/doptime/logger"
 	"github.com/redis/go-redis/v9"
 	"github.com/vmihailenco/msgpack/v5"
@@ -44,10 +47,27 @@ func rpcReceive() {
 			logger.Error().Str("dataSource missing in rpcReceive", dataSource).Send()
 			continue
 		}
-		go rpcReceiveOneDatasource(services, rds)
+		//one XREADGROUP can only read with one group & consumer, and one NoAck setting
+		//so the apis are split into readers by consumer and reliability
+		type streamReader struct {
+			consumer StreamConsumer
+			noAck    bool
+		}
+		var readers = map[streamReader][]string{}
+		for _, service := range services {
+			reader := streamReader{consumer: *ConsumerOf(service), noAck: !IsReliable(service)}
+			readers[reader] = append(readers[reader], service)
+		}
+		for reader, serviceNames := range readers {
+			go rpcReceiveOneDatasource(serviceNames, rds, reader.consumer, reader.noAck)
+			if !reader.noAck {
+				go reclaimPendingJobs(serviceNames, rds)
+			}
+		}
+		go consumerHeartbeat(services, rds)
 	}
 }
-func rpcReceiveOneDatasource(serviceNames []string, rds *redis.Client) {
+func rpcReceiveOneDatasource(serviceNames []string, rds *redis.Client, consumer StreamConsumer, noAck bool) {
 	var (
 		apiName, data string
 		cmd           *redis.XStreamSliceCmd
@@ -60,7 +80,20 @@ func rpcReceiveOneDatasource(serviceNames []string, rds *redis.Client) {
 
 	//deprecate using list command LRange, to avoid continually query consumption
 	//use xreadgroup to receive data ,2023-01-31
-	for args := defaultXReadGroupArgs(serviceNames); ; {
+	for args, round := defaultXReadGroupArgs(serviceNames, &consumer, noAck), 0; ; round++ {
+		//backpressure: the apis without free workers are not read, until a worker is released
+		freed := workerFreedChan()
+		streams, count := readableStreams(serviceNames, round)
+		if len(streams) == 0 {
+			<-freed
+			continue
+		}
+		args.Streams, args.Count = append(streams, make([]string, len(streams))...), count
+		for i := len(streams); i < len(args.Streams); i++ {
+			args.Streams[i] = ">"
+		}
+		//the skipped apis are read again soon after their workers are released
+		args.Block = lib.Ternary(len(streams) < len(serviceNames), time.Second, time.Second*20)
 		if cmd = rds.XReadGroup(c, args); cmd.Err() == redis.Nil {
 			continue
 		} else if cmd.Err() != nil {
@@ -69,7 +102,7 @@ func rpcReceiveOneDatasource(serviceNames []string, rds *redis.Client) {
 			if items := strings.Split(cmd.Err().Error(), "api:"); len(items) > 1 {
 				if items2 := strings.Split("api:"+items[1], "'"); len(items2) > 1 {
 					logger.Info().Str("starting XGroupEnsureCreatedOneGroup", items2[0]).Send()
-					go XGroupEnsureCreatedOneGroup(c, items2[0], rds)
+					go XGroupEnsureCreatedOneGroup(c, items2[0], consumer.Group, rds)
 				}
 			} else {
 				logger.Error().AnErr("No API name Captured between No such key 'xxx'", cmd.Err()).Send()
@@ -85,24 +118,65 @@ func rpcReceiveOneDatasource(serviceNames []string, rds *redis.Client) {
 				//skip case of placeholder stream while not atOk
 				//but if timeAt is setted, then empty data is allowed, used to clear the task
 				if data = message.Values["data"].(string); len(data) == 0 && !atOk {
+					if !noAck {
+						ackJob(rds, apiName, message.ID)
+					}
 					continue
 				}
-				//the delay calling will lost if the app is down
+				//CallAt tasks sent through the stream by older callers, persisted into the schedule zset
 				if atOk {
 					if len(data) == 0 {
 						rpcCallAtTaskRemoveOne(apiName, timeAtStr.(string))
 					} else {
 						rpcCallAtTaskAddOne(apiName, timeAtStr.(string), data)
 					}
+					if !noAck {
+						ackJob(rds, apiName, message.ID)
+					}
+				} else if apiName := apiName; !noAck {
+					runInWorkerPool(apiName, func() { callReliably(rds, apiName, message) })
 				} else {
-					go CallApiLocallyAndSendBackResult(apiName, message.ID, []byte(data))
+					runInWorkerPool(apiName, func() { runJob(apiName, message) })
 				}
 				httpapi.ApiCounter.Add(apiName, 1)
 			}
 		}
 	}
 }
-func CallApiLocallyAndSendBackResult(apiName, BackToID string, s []byte) (err error) {
+
+// DefaultJobTimeout bounds the jobs whose caller set no deadline, i.g. CallAt & CallEvery
+var DefaultJobTimeout = time.Second * 120
+
+// jobContext derives the context of the job from the deadline & the idempotency key carried by the message.
+// expired is true if the caller has already given up, the job should be dropped without running
+func jobContext(message redis.XMessage) (ctx context.Context, cancel context.CancelFunc, expired bool) {
+	deadline, ok := utils.DeadlineOfMessage(message.Values)
+	if !ok {
+		deadline = time.Now().Add(DefaultJobTimeout)
+	}
+	ctx, cancel = context.WithDeadline(context.Background(), deadline)
+	if key, _ := message.Values[utils.IdempotencyField].(string); key != "" {
+		ctx = utils.WithIdempotencyKey(ctx, key)
+	}
+	return ctx, cancel, !time.Now().Before(deadline)
+}
+
+// runJob runs the job received from stream, unless it is expired
+func runJob(apiName string, message redis.XMessage) (err error) {
+	ctx, cancel, expired := jobContext(message)
+	defer cancel()
+	if expired {
+		logger.Debug().Str("api", apiName).Str("id", message.ID).Msg("job dropped, deadline exceeded")
+		return nil
+	}
+	data, _ := message.Values["data"].(string)
+	if _, ok := message.Values[utils.StreamField]; ok {
+		return CallApiLocallyAndStreamBack(ctx, apiName, message.ID, []byte(data))
+	}
+	return CallApiLocallyAndSendBackResult(ctx, apiName, message.ID, []byte(data))
+}
+
+func CallApiLocallyAndSendBackResult(ctx context.Context, apiName, BackToID string, s []byte) (err error) {
 	var (
 		msgPackResult []byte
 		ret           interface{}
@@ -110,8 +184,6 @@ func CallApiLocallyAndSendBackResult(apiName, BackToID string, s []byte) (err er
 		rds           *redis.Client
 		exists        bool
 	)
-	context, cancel := context.WithTimeout(context.Background(), time.Second*120)
-	defer cancel()
 	if service, exists = httpapi.ApiViaHttp.Get(apiName); !exists {
 		return fmt.Errorf("service %s not found", apiName)
 	}
@@ -120,20 +192,37 @@ func CallApiLocallyAndSendBackResult(apiName, BackToID string, s []byte) (err er
 	if err = msgpack.Unmarshal(s, &_map); err != nil {
 		msgpackNonstruct = s
 	}
-	if ret, err = service.CallByMap(context, _map, msgpackNonstruct, nil); err != nil {
-		return err
-	}
-	if msgPackResult, err = msgpack.Marshal(ret); err != nil {
-		return
-	}
 	DataSource := service.GetDataSource()
 	if rds, exists = cfgredis.Servers.Get(DataSource); !exists {
 		logger.Error().Str("DataSource not defined in enviroment while CallApiLocallyAndSendBackResult", DataSource).Send()
 		return fmt.Errorf("DataSource not defined in enviroment %s", DataSource)
 	}
+	if ret, err = service.CallByMap(ctx, _map, msgpackNonstruct, nil); err == nil {
+		msgPackResult, err = msgpack.Marshal(ret)
+	}
+	if err != nil {
+		sendBackError(rds, BackToID, err)
+		return err
+	}
 	pipline := rds.Pipeline()
-	pipline.RPush(context, BackToID, msgPackResult)
-	pipline.Expire(context, BackToID, time.Second*20)
-	_, err = pipline.Exec(context)
+	//the result is sent back even if ctx is done while sending, the caller may still be waiting
+	c := context.Background()
+	pipline.RPush(c, BackToID, msgPackResult)
+	pipline.Expire(c, BackToID, time.Second*20)
+	_, err = pipline.Exec(c)
 	return err
 }
+
+// sendBackError pushes the error envelope, so that the rpc caller fails fast instead of waiting until timeout
+func sendBackError(rds *redis.Client, BackToID string, err error) {
+	b, errMarshal := msgpack.Marshal(vars.ToApiError(err))
+	if errMarshal != nil {
+		logger.Error().Err(errMarshal).Msg("marshal error envelope failed")
+		return
+	}
+	c, errKey := context.Background(), utils.ReplyErrorKey(BackToID)
+	pipline := rds.Pipeline()
+	pipline.RPush(c, errKey, b)
+	pipline.Expire(c, errKey, time.Second*20)
+	pipline.Exec(c)
+}
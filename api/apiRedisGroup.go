@@ -11,7 +11,8 @@ import (
 
 var ServiceBatchSize int64 = 64
 
-func defaultXReadGroupArgs(serviceNames []string) *redis.XReadGroupArgs {
+// with noAck, the messages are regarded as acknowledged once read. reliable apis are read without noAck
+func defaultXReadGroupArgs(serviceNames []string, consumer *StreamConsumer, noAck bool) *redis.XReadGroupArgs {
 	var (
 		streams []string
 	)
@@ -23,15 +24,15 @@ func defaultXReadGroupArgs(serviceNames []string) *redis.XReadGroupArgs {
 	}
 
 	//ServiceBatchSize is the number of tasks that a service can read from redis at the same time
-	args := &redis.XReadGroupArgs{Streams: streams, Block: time.Second * 20, Count: ServiceBatchSize, NoAck: true, Group: "group0", Consumer: "doptime"}
+	args := &redis.XReadGroupArgs{Streams: streams, Block: time.Second * 20, Count: ServiceBatchSize, NoAck: noAck, Group: consumer.Group, Consumer: consumer.Consumer}
 	return args
 }
-func XGroupEnsureCreatedOneGroup(c context.Context, serviceName string, rds *redis.Client) (err error) {
+func XGroupEnsureCreatedOneGroup(c context.Context, serviceName string, groupName string, rds *redis.Client) (err error) {
 	var (
 		cmdStream      *redis.XInfoStreamCmd
 		cmdXInfoGroups *redis.XInfoGroupsCmd
 		groups         []string
-		group0Exists   bool = false
+		groupExists    bool = false
 	)
 	//if stream key does not exist, create a placeholder stream
 	//other wise, NOGROUP No such key will be returned
@@ -48,18 +49,18 @@ func XGroupEnsureCreatedOneGroup(c context.Context, serviceName string, rds *red
 	//continue if the group already exists
 	if cmdXInfoGroups = rds.XInfoGroups(c, serviceName); cmdXInfoGroups.Err() == nil && len(cmdXInfoGroups.Val()) > 0 {
 		for _, group := range cmdXInfoGroups.Val() {
-			if group.Name == "group0" {
-				group0Exists = true
+			if group.Name == groupName {
+				groupExists = true
 			}
 			groups = append(groups, group.Name)
 		}
-		logger.Info().Str("existing groups :", strings.Join(groups, ",")).Any("group0 exists", group0Exists).Send()
-		if group0Exists {
+		logger.Info().Str("existing groups :", strings.Join(groups, ",")).Any("group exists", groupExists).Send()
+		if groupExists {
 			return nil
 		}
 	}
 	//create a group if none exists
-	if cmd := rds.XGroupCreateMkStream(c, serviceName, "group0", "$"); cmd.Err() != nil {
+	if cmd := rds.XGroupCreateMkStream(c, serviceName, groupName, "$"); cmd.Err() != nil {
 		logger.Info().AnErr("XGroupCreateOne", cmd.Err()).Send()
 		return cmd.Err()
 	}
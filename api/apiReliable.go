@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doptime/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+var DefaultMaxRetry int64 = 5
+var DefaultRetryIdle = time.Minute
+
+// ReliableReclaimInterval is the interval to scan pending entries of reliable apis
+var ReliableReclaimInterval = time.Second * 10
+
+// ReliableDelivery is the at-least-once setting of an api.
+// RetryIdle should be longer than the longest execution time of the api, otherwise a running job may be reclaimed and run twice
+type ReliableDelivery struct {
+	MaxRetry  int64
+	RetryIdle time.Duration
+}
+
+func newReliableDelivery(maxRetry int64, retryIdle time.Duration) *ReliableDelivery {
+	if maxRetry <= 0 {
+		maxRetry = DefaultMaxRetry
+	}
+	if retryIdle <= 0 {
+		retryIdle = DefaultRetryIdle
+	}
+	return &ReliableDelivery{MaxRetry: maxRetry, RetryIdle: retryIdle}
+}
+
+func IsReliable(apiName string) bool {
+	return ApiReliableDelivery.Has(apiName)
+}
+
+// the stream where poison jobs are moved to
+func DeadLetterKey(apiName string) string { return apiName + ":dead" }
+
+// hash of message id => redelivery count
+func retryCounterKey(apiName string) string { return apiName + ":retry" }
+
+// hash of message id => last error message
+func retryErrorKey(apiName string) string { return apiName + ":retryerr" }
+
+// callReliably runs the job and acks it only after success.
+// a failed job stays in the pending entries list, and will be reclaimed by reclaimPendingJobs after RetryIdle
+// expired jobs are acked without running
+func callReliably(rds *redis.Client, apiName string, message redis.XMessage) {
+	if err := runJob(apiName, message); err != nil {
+		logger.Warn().Str("api", apiName).Str("id", message.ID).Err(err).Msg("reliable job failed, left pending for retry")
+		rds.HSet(context.Background(), retryErrorKey(apiName), message.ID, err.Error())
+		return
+	}
+	ackJob(rds, apiName, message.ID)
+}
+
+func ackJob(rds *redis.Client, apiName string, ids ...string) {
+	c := context.Background()
+	pipeline := rds.Pipeline()
+	pipeline.XAck(c, apiName, ConsumerOf(apiName).Group, ids...)
+	pipeline.HDel(c, retryCounterKey(apiName), ids...)
+	pipeline.HDel(c, retryErrorKey(apiName), ids...)
+	if _, err := pipeline.Exec(c); err != nil {
+		logger.Error().Str("api", apiName).Strs("ids", ids).Err(err).Msg("ack reliable job failed")
+	}
+}
+
+// moveToDeadLetter acks the job, and saves it to "<api>:dead" for manual inspection
+func moveToDeadLetter(rds *redis.Client, apiName string, message redis.XMessage, retries int64) {
+	c := context.Background()
+	data, _ := message.Values["data"].(string)
+	lastErr, _ := rds.HGet(c, retryErrorKey(apiName), message.ID).Result()
+	pipeline := rds.TxPipeline()
+	pipeline.XAdd(c, &redis.XAddArgs{Stream: DeadLetterKey(apiName), MaxLen: 4096, Values: []string{
+		"id", message.ID, "data", data, "error", lastErr, "retries", strconv.FormatInt(retries, 10)}})
+	pipeline.XAck(c, apiName, ConsumerOf(apiName).Group, message.ID)
+	pipeline.HDel(c, retryCounterKey(apiName), message.ID)
+	pipeline.HDel(c, retryErrorKey(apiName), message.ID)
+	if _, err := pipeline.Exec(c); err != nil {
+		logger.Error().Str("api", apiName).Str("id", message.ID).Err(err).Msg("move job to dead letter failed")
+		return
+	}
+	logger.Warn().Str("api", apiName).Str("id", message.ID).Int64("retries", retries).Str("error", lastErr).Msg("job moved to dead letter")
+}
+
+// reclaimPendingJobs takes over the jobs left pending by failed calls or dead consumers.
+// XAUTOCLAIM is atomic, so each stale job is reclaimed by exactly one instance
+func reclaimPendingJobs(serviceNames []string, rds *redis.Client) {
+	var (
+		c        = context.Background()
+		messages []redis.XMessage
+		next     string
+		retries  int64
+		err      error
+	)
+	ApiStartingWaiter()
+	for {
+		time.Sleep(ReliableReclaimInterval)
+		for _, apiName := range serviceNames {
+			reliable, ok := ApiReliableDelivery.Get(apiName)
+			if !ok {
+				continue
+			}
+			for start := "0-0"; ; start = next {
+				consumer := ConsumerOf(apiName)
+				args := &redis.XAutoClaimArgs{Stream: apiName, Group: consumer.Group, Consumer: consumer.Consumer, MinIdle: reliable.RetryIdle, Start: start, Count: ServiceBatchSize}
+				if messages, next, err = rds.XAutoClaim(c, args).Result(); err != nil {
+					if !strings.Contains(err.Error(), "NOGROUP") {
+						logger.Error().Str("api", apiName).Err(err).Msg("XAutoClaim failed")
+					}
+					break
+				}
+				for _, message := range messages {
+					//placeholder or CallAt message, nothing to retry
+					if data, _ := message.Values["data"].(string); len(data) == 0 || message.Values["timeAt"] != nil {
+						ackJob(rds, apiName, message.ID)
+						continue
+					}
+					if retries, err = rds.HIncrBy(c, retryCounterKey(apiName), message.ID, 1).Result(); err != nil {
+						logger.Error().Str("api", apiName).Err(err).Msg("increase retry counter failed")
+						continue
+					}
+					if retries > reliable.MaxRetry {
+						moveToDeadLetter(rds, apiName, message, retries-1)
+						continue
+					}
+					runInWorkerPool(apiName, func() { callReliably(rds, apiName, message) })
+				}
+				if next == "0-0" || len(messages) == 0 {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"context"
+	"reflect"
+)
+
+// ApiStream creates an api whose function emits the result in chunks, i.g. tokens of llm.
+// http clients receive the chunks as Server-Sent Events (rt=text/event-stream) or msgpack frames (rt=application/msgpack-stream),
+// rpc.RpcStream callers iterate the chunks as they arrive. other callers receive all chunks as one slice.
+// send returns error if the caller is gone, the function should stop then
+func ApiStream[i any, o any](f func(ctx context.Context, InParameter i, send func(chunk o) error) (err error), options ...optionSetter) (out *ApiCtx[i, []o]) {
+	fWithCtx := func(ctx context.Context, InParameter i) (ret []o, err error) {
+		err = f(ctx, InParameter, func(chunk o) error {
+			ret = append(ret, chunk)
+			return nil
+		})
+		return ret, err
+	}
+	if out = newApi(nil, fWithCtx, reflect.ValueOf(f).Pointer(), options...); len(out.Name) == 0 {
+		return out
+	}
+	out.FuncStream = func(ctx context.Context, InParameter i, send func(chunk interface{}) error) (err error) {
+		return f(ctx, InParameter, func(chunk o) error { return send(chunk) })
+	}
+	return out
+}
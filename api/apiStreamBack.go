@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/doptime/config/cfgredis"
+	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/doptime/utils"
+	"github.com/doptime/doptime/vars"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ReplyStreamTTL is renewed on every chunk, the reply stream is removed if the caller stops reading
+var ReplyStreamTTL = time.Minute
+
+// CallApiLocallyAndStreamBack relays the chunks of the api to the reply stream of the job, one entry per chunk
+func CallApiLocallyAndStreamBack(ctx context.Context, apiName, BackToID string, s []byte) (err error) {
+	var (
+		service httpapi.ApiInterface
+		rds     *redis.Client
+		exists  bool
+		replyTo = utils.ReplyStreamKey(BackToID)
+	)
+	if service, exists = httpapi.ApiViaHttp.Get(apiName); !exists {
+		return fmt.Errorf("service %s not found", apiName)
+	}
+	if rds, exists = cfgredis.Servers.Get(service.GetDataSource()); !exists {
+		return fmt.Errorf("DataSource not defined in enviroment %s", service.GetDataSource())
+	}
+	//the reply is sent even if ctx is done while sending, the caller may still be reading
+	reply := func(values ...string) error {
+		c := context.Background()
+		pipline := rds.Pipeline()
+		pipline.XAdd(c, &redis.XAddArgs{Stream: replyTo, Values: values})
+		pipline.Expire(c, replyTo, ReplyStreamTTL)
+		_, err := pipline.Exec(c)
+		return err
+	}
+	send := func(chunk interface{}) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b, err := msgpack.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		return reply("data", string(b))
+	}
+
+	var _map = map[string]interface{}{}
+	var msgpackNonstruct []byte
+	if err = msgpack.Unmarshal(s, &_map); err != nil {
+		msgpackNonstruct = s
+	}
+	if streamer, ok := service.(httpapi.StreamApiInterface); ok {
+		err = streamer.CallStreamByMap(ctx, _map, msgpackNonstruct, nil, send)
+	} else {
+		var ret interface{}
+		if ret, err = service.CallByMap(ctx, _map, msgpackNonstruct, nil); err == nil {
+			err = send(ret)
+		}
+	}
+	if err != nil {
+		b, _ := msgpack.Marshal(vars.ToApiError(err))
+		reply("error", string(b))
+		return err
+	}
+	return reply("end", "1")
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"sync"
+
+	cmap "github.com/orcaman/concurrent-map/v2"
+)
+
+// GlobalConcurrency caps the running jobs of all apis in the process, 0 means unlimited.
+// it can be set by [Api] MaxConcurrency in toml
+var GlobalConcurrency int64 = 0
+
+var globalWorkerSlots chan struct{}
+
+// ApiWorkerSlots holds the worker slots of apis created WithConcurrency, keyed by api name
+var ApiWorkerSlots = cmap.New[chan struct{}]()
+
+func initGlobalWorkerSlots() {
+	if GlobalConcurrency > 0 {
+		globalWorkerSlots = make(chan struct{}, GlobalConcurrency)
+	}
+}
+
+// acquireWorker blocks until both the api and the global pool have a free slot
+func acquireWorker(apiName string) {
+	if globalWorkerSlots != nil {
+		globalWorkerSlots <- struct{}{}
+	}
+	if slots, ok := ApiWorkerSlots.Get(apiName); ok {
+		slots <- struct{}{}
+	}
+}
+
+func releaseWorker(apiName string) {
+	if slots, ok := ApiWorkerSlots.Get(apiName); ok {
+		<-slots
+	}
+	if globalWorkerSlots != nil {
+		<-globalWorkerSlots
+	}
+	signalWorkerFreed()
+}
+
+// runInWorkerPool runs the job in a new goroutine once a slot is acquired.
+// the caller is blocked while the pool is saturated, which is the backpressure to the stream reader
+func runInWorkerPool(apiName string, job func()) {
+	acquireWorker(apiName)
+	go func() {
+		defer releaseWorker(apiName)
+		job()
+	}()
+}
+
+// workerFreed is closed when a worker is released, so that the readers waiting for free workers wake up
+var workerFreed struct {
+	sync.Mutex
+	ch chan struct{}
+}
+
+// workerFreedChan is closed on the next release of worker, it should be taken before checking the free workers
+func workerFreedChan() <-chan struct{} {
+	workerFreed.Lock()
+	defer workerFreed.Unlock()
+	if workerFreed.ch == nil {
+		workerFreed.ch = make(chan struct{})
+	}
+	return workerFreed.ch
+}
+
+func signalWorkerFreed() {
+	workerFreed.Lock()
+	defer workerFreed.Unlock()
+	if workerFreed.ch != nil {
+		close(workerFreed.ch)
+		workerFreed.ch = nil
+	}
+}
+
+// readableStreams are the apis with free workers, and the count to read per stream, so that the messages read
+// fit in the free workers of every api and, across the streams, of the global pool. the saturated apis are skipped
+// rather than holding back the others. offset rotates the apis, so that the global pool is shared fairly
+func readableStreams(serviceNames []string, offset int) (streams []string, count int64) {
+	count = ServiceBatchSize
+	for i := range serviceNames {
+		apiName := serviceNames[(i+offset)%len(serviceNames)]
+		if slots, ok := ApiWorkerSlots.Get(apiName); ok {
+			free := int64(cap(slots) - len(slots))
+			if free <= 0 {
+				continue
+			}
+			count = min(count, free)
+		}
+		streams = append(streams, apiName)
+	}
+	if globalWorkerSlots != nil && len(streams) > 0 {
+		//COUNT is per stream, so the global free workers are divided among the streams
+		globalFree := int64(cap(globalWorkerSlots) - len(globalWorkerSlots))
+		if globalFree <= 0 {
+			return nil, 0
+		}
+		streams = streams[:min(int64(len(streams)), globalFree)]
+		count = min(count, globalFree/int64(len(streams)))
+	}
+	return streams, count
+}
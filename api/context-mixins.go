@@ -2,6 +2,8 @@ package api
 
 import (
 	"strings"
+
+	"github.com/doptime/doptime/httpserve/httpapi"
 )
 
 // this is to be used in HookParamEnhancer, to quickly fix key & value
@@ -42,3 +44,10 @@ func (ctx *ApiCtx[i, o]) HookResponseModifier(
 	ctx.ResponseModifier = ResponseModifier
 	return ctx
 }
+
+// Intercept appends interceptors to the api, i.g. httpapi.Before, httpapi.After, httpapi.OnError, or any httpapi.Interceptor as around.
+// they run inside the global interceptors, the one appended first is the outer one
+func (ctx *ApiCtx[i, o]) Intercept(interceptors ...httpapi.Interceptor) *ApiCtx[i, o] {
+	ctx.Interceptors = append(ctx.Interceptors, interceptors...)
+	return ctx
+}
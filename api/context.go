@@ -3,18 +3,26 @@ package api
 import (
 	"context"
 
+	"github.com/doptime/doptime/httpserve/httpapi"
 	cmap "github.com/orcaman/concurrent-map/v2"
 )
 
 var ApiServiceBatchSize = cmap.New[int64]()
 
+// ApiReliableDelivery holds the apis that opt in at-least-once delivery, keyed by api name
+var ApiReliableDelivery = cmap.New[*ReliableDelivery]()
+
 // ApiOption is parameter to create an API, RPC, or CallAt
 type ApiCtx[i any, o any] struct {
 	Name         string
 	ApiSourceRds string
 	Ctx          context.Context
 	Func         func(InParameter i) (ret o, err error)
-	Validate     func(pIn interface{}) error
+	// FuncWithCtx is called by http & stream, ctx carries the deadline of the caller
+	FuncWithCtx func(ctx context.Context, InParameter i) (ret o, err error)
+	// FuncStream is set by ApiStream, it sends the result in chunks
+	FuncStream func(ctx context.Context, InParameter i, send func(chunk interface{}) error) (err error)
+	Validate   func(pIn interface{}) error
 	// you can rewrite input parameter before excecute the service
 	ParamEnhancer func(param i) (out i, err error)
 
@@ -23,4 +31,7 @@ type ApiCtx[i any, o any] struct {
 
 	// you can modify the result value to the web client.
 	ResponseModifier func(param i, ret o) (valueToWebclient interface{}, err error)
+
+	// Interceptors wrap the call of the api, after the global ones of httpapi.UseInterceptors
+	Interceptors []httpapi.Interceptor
 }
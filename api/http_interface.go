@@ -3,9 +3,12 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"reflect"
 
+	"github.com/doptime/doptime/httpserve/httpapi"
 	"github.com/doptime/doptime/utils"
+	"github.com/doptime/doptime/vars"
 	"github.com/vmihailenco/msgpack/v5"
 )
 
@@ -17,8 +20,63 @@ func (a *ApiCtx[i, o]) GetDataSource() string {
 }
 
 func (a *ApiCtx[i, o]) CallByMap(ctx context.Context, _map map[string]interface{}, msgpackNonstruct []byte, jsonpackNostruct []byte) (ret interface{}, err error) {
+	var in i
+	if in, err = a.decodeInput(_map, msgpackNonstruct, jsonpackNostruct); err != nil {
+		return nil, err
+	}
+	ret, err = httpapi.Intercept(ctx, a.Name, in, true, a.Interceptors, func(ctx context.Context, pIn interface{}) (interface{}, error) {
+		var ok bool
+		if in, ok = pIn.(i); !ok {
+			return nil, fmt.Errorf("%w: interceptor changed the input of %s to %T", vars.ErrInvalidInput, a.Name, pIn)
+		}
+		//the result of the replayed call is saved already
+		out, replayed, err := a.callIdempotently(ctx, in)
+		//post save the result to db
+		if a.ResultSaver != nil && err == nil && !replayed {
+			err = a.ResultSaver(in, out)
+		}
+		return out, err
+	})
+	//modify the result value to the web client.
+	if a.ResponseModifier != nil && err == nil {
+		out, _ := ret.(o)
+		ret, err = a.ResponseModifier(in, out)
+	}
+	return ret, err
+}
+
+func (a *ApiCtx[i, o]) IsStream() bool {
+	return a.FuncStream != nil
+}
+
+// CallStreamByMap sends the chunks of the stream api. non-stream api sends the whole result as one chunk
+func (a *ApiCtx[i, o]) CallStreamByMap(ctx context.Context, _map map[string]interface{}, msgpackNonstruct []byte, jsonpackNostruct []byte, send func(chunk interface{}) error) (err error) {
+	var (
+		in  i
+		ret interface{}
+	)
+	if a.FuncStream == nil {
+		if ret, err = a.CallByMap(ctx, _map, msgpackNonstruct, jsonpackNostruct); err != nil {
+			return err
+		}
+		return send(ret)
+	}
+	if in, err = a.decodeInput(_map, msgpackNonstruct, jsonpackNostruct); err != nil {
+		return err
+	}
+	_, err = httpapi.Intercept(ctx, a.Name, in, true, a.Interceptors, func(ctx context.Context, pIn interface{}) (interface{}, error) {
+		in, ok := pIn.(i)
+		if !ok {
+			return nil, fmt.Errorf("%w: interceptor changed the input of %s to %T", vars.ErrInvalidInput, a.Name, pIn)
+		}
+		return nil, a.FuncStream(ctx, in, send)
+	})
+	return err
+}
+
+// decodeInput decodes, enhances and validates the input parameter
+func (a *ApiCtx[i, o]) decodeInput(_map map[string]interface{}, msgpackNonstruct []byte, jsonpackNostruct []byte) (in i, err error) {
 	var (
-		in          i
 		pIn         interface{}
 		isTypeInPtr bool = false
 		//datapack DataPacked
@@ -37,13 +95,13 @@ func (a *ApiCtx[i, o]) CallByMap(ctx context.Context, _map map[string]interface{
 	} else if len(jsonpackNostruct) > 0 {
 		err = json.Unmarshal(jsonpackNostruct, pIn)
 	} else if decoder, errMapTostruct := utils.MapToStructDecoder(pIn); errMapTostruct != nil {
-		return nil, errMapTostruct
+		return in, errMapTostruct
 	} else {
 		err = decoder.Decode(_map)
 	}
 
 	if err != nil {
-		return nil, err
+		return in, err
 	} else if !isTypeInPtr {
 		in = *pIn.(*i)
 	}
@@ -51,6 +109,7 @@ func (a *ApiCtx[i, o]) CallByMap(ctx context.Context, _map map[string]interface{
 	//load fill the left fields from db
 	if a.ParamEnhancer != nil {
 		if out, err := a.ParamEnhancer(in); err != nil {
+			return in, err
 		} else if isTypeInPtr {
 			pIn = out
 		} else {
@@ -60,16 +119,7 @@ func (a *ApiCtx[i, o]) CallByMap(ctx context.Context, _map map[string]interface{
 
 	//validate the input if it is struct and has tag "validate"
 	if err = a.Validate(pIn); err != nil {
-		return nil, err
-	}
-	//post save the result to db
-	ret, err = a.Func(in)
-	if a.ResultSaver != nil && err == nil {
-		_ = a.ResultSaver(in, ret.(o))
+		return in, err
 	}
-	//modify the result value to the web client.
-	if a.ResponseModifier != nil {
-		ret, err = a.ResponseModifier(in, ret.(o))
-	}
-	return ret, err
+	return in, nil
 }
@@ -1,9 +1,47 @@
 package api
 
-import "github.com/doptime/logger"
+import (
+	"github.com/doptime/config"
+	"github.com/doptime/doptime/httpserve/httpdoc"
+	"github.com/doptime/logger"
+)
+
+// ConfigApi is the [Api] item in toml
+type ConfigApi struct {
+	ServiceBatchSize int64
+	Group            string
+	Consumer         string
+	// MaxConcurrency caps the running jobs of all apis in the process
+	MaxConcurrency int64
+	// Service & Version name the service in the api docs, Service defaults to the name of the executable
+	Service string
+	Version string
+}
 
 func init() {
-	logger.Info().Msg("Receive Rpc started..")
+	var apiOption = ConfigApi{ServiceBatchSize: ServiceBatchSize, Group: DefaultGroup, Consumer: DefaultConsumer, MaxConcurrency: GlobalConcurrency}
+	config.LoadItemFromToml("Api", &apiOption)
+	if apiOption.ServiceBatchSize > 0 {
+		ServiceBatchSize = apiOption.ServiceBatchSize
+	}
+	if apiOption.MaxConcurrency > 0 {
+		GlobalConcurrency = apiOption.MaxConcurrency
+	}
+	initGlobalWorkerSlots()
+	if apiOption.Group != "" {
+		DefaultGroup = apiOption.Group
+	}
+	if apiOption.Consumer != "" {
+		DefaultConsumer = apiOption.Consumer
+	}
+	//the instance in the doc registry is the consumer of the streams
+	httpdoc.Instance = DefaultConsumer
+	if apiOption.Service != "" {
+		httpdoc.Service = apiOption.Service
+	}
+	httpdoc.Version = apiOption.Version
+
+	logger.Info().Str("group", DefaultGroup).Str("consumer", DefaultConsumer).Msg("Receive Rpc started..")
 	go rpcCallAtTasksLoad()
 	go rpcReceive()
 }
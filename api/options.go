@@ -1,11 +1,33 @@
 package api
 
-import "github.com/doptime/doptime/utils"
+import (
+	"time"
+
+	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/doptime/utils"
+)
 
 // Option is parameter to create an API, RPC, or CallAt
 type Option struct {
 	ApiSourceRds string
 	ApiKey       string
+	// Reliable turns on at-least-once delivery: ack after success, reclaim stale pending jobs, dead-letter poison jobs
+	Reliable  bool
+	MaxRetry  int64
+	RetryIdle time.Duration
+	// Group and Consumer used to read the api stream. empty means DefaultGroup / DefaultConsumer
+	Group    string
+	Consumer string
+	// Concurrency is the max running jobs of the api received from stream. 0 means unlimited
+	Concurrency int64
+	// RateLimits limit the http calls of the api
+	RateLimits []*httpapi.RateLimit
+	// IdempotencyTTL makes the calls of the same input run once in the ttl, unless they carry different idempotency keys
+	IdempotencyTTL time.Duration
+	// CacheTTL caches the results of the api. CacheSize > 0 caches them in the local lru, rather than redis
+	CacheTTL  time.Duration
+	CacheSize int
+	CacheTags []string
 }
 type optionSetter func(*Option)
 
@@ -21,6 +43,78 @@ func WithApiKey(apiKey string) optionSetter {
 	}
 }
 
+// WithReliable makes the api consume its stream with at-least-once semantic.
+// a job is acked only after it succeeds; jobs left pending longer than retryIdle are reclaimed from dead consumers;
+// after maxRetry failed deliveries the job is moved to the "<api>:dead" stream.
+// zero values fallback to DefaultMaxRetry and DefaultRetryIdle
+func WithReliable(maxRetry int64, retryIdle time.Duration) optionSetter {
+	return func(o *Option) {
+		o.Reliable = true
+		o.MaxRetry = maxRetry
+		o.RetryIdle = retryIdle
+	}
+}
+
+// WithGroup reads the api stream with another consumer group, so that separate worker pools (e.g. canary vs stable) each receive all jobs
+func WithGroup(group string) optionSetter {
+	return func(o *Option) {
+		o.Group = group
+	}
+}
+
+// WithConsumer overrides the consumer name, which defaults to hostname-pid
+func WithConsumer(consumer string) optionSetter {
+	return func(o *Option) {
+		o.Consumer = consumer
+	}
+}
+
+// WithConcurrency limits the running jobs of the api received from stream.
+// the stream reader stops pulling while the limit is reached
+func WithConcurrency(n int64) optionSetter {
+	return func(o *Option) {
+		o.Concurrency = n
+	}
+}
+
+// WithRateLimit limits the http calls of the api to limit per window, by sliding window counted in redis.
+// keyBy is "ip", "apikey" (validated by httpserve.ValidateApiKey), or jwt claim such as "@sub"
+func WithRateLimit(limit int64, window time.Duration, keyBy string) optionSetter {
+	return func(o *Option) {
+		o.RateLimits = append(o.RateLimits, &httpapi.RateLimit{Algorithm: httpapi.SlidingWindow, Limit: limit, Window: window, KeyBy: keyBy})
+	}
+}
+
+// WithTokenBucket limits the http calls of the api by token bucket, allowing bursts of capacity calls, refilled at capacity per window
+func WithTokenBucket(capacity int64, window time.Duration, keyBy string) optionSetter {
+	return func(o *Option) {
+		o.RateLimits = append(o.RateLimits, &httpapi.RateLimit{Algorithm: httpapi.TokenBucket, Limit: capacity, Window: window, KeyBy: keyBy})
+	}
+}
+
+// WithIdempotency makes the api idempotent even if the caller sends no Idempotency-Key: the calls of the same input run once,
+// the result is replayed to the others in ttl. the calls with Idempotency-Key keep their results in ttl, instead of DefaultIdempotencyTTL
+func WithIdempotency(ttl time.Duration) optionSetter {
+	return func(o *Option) {
+		o.IdempotencyTTL = ttl
+	}
+}
+
+// WithCache caches the results of the api in redis for ttl, keyed by the hash of the input. it's for the apis which are pure functions of the input.
+// the cache is removed by InvalidateCache with the api name or any of the tags
+func WithCache(ttl time.Duration, tags ...string) optionSetter {
+	return func(o *Option) {
+		o.CacheTTL, o.CacheSize, o.CacheTags = ttl, 0, tags
+	}
+}
+
+// WithLocalCache caches the results of the api in the lru of the process, at most size entries
+func WithLocalCache(ttl time.Duration, size int, tags ...string) optionSetter {
+	return func(o *Option) {
+		o.CacheTTL, o.CacheSize, o.CacheTags = ttl, size, tags
+	}
+}
+
 func (o Option) mergeNewOptions(optionSetters ...optionSetter) (out *Option) {
 	for _, setter := range optionSetters {
 		setter(&o)
@@ -3,6 +3,7 @@ package httpserve
 import (
 	"github.com/doptime/doptime/api"
 	"github.com/doptime/doptime/httpserve/httpdoc"
+	"github.com/doptime/doptime/lib"
 )
 
 type ApiDocs struct {
@@ -13,6 +14,24 @@ type DataDocs struct {
 type Docs struct {
 }
 
+// OpenApi is served at /openapi
+type OpenApi struct {
+}
+
+// ClientSdk is served at /clientsdk?lang=python, go or dart. Package is the package name of the go client
+type ClientSdk struct {
+	Lang    string
+	Package string `json:"package @client"`
+}
+
+// ApiRegistry is served at /apiregistry, the services with versions, instances and the status of apis
+type ApiRegistry struct {
+}
+
+// DataKeys is served at /datakeys, the data keys with the permissions, and the data commands. the api explorer is built on it
+type DataKeys struct {
+}
+
 var ApiApiDocs = api.Api(func(req *ApiDocs) (r string, err error) {
 	return httpdoc.GetApiDocs()
 }).Func
@@ -21,13 +40,36 @@ var ApiDataDocs = api.Api(func(req *DataDocs) (r string, err error) {
 	return httpdoc.GetDataDocs()
 }).Func
 
+var ApiOpenApi = api.Api(func(req *OpenApi) (r string, err error) {
+	return httpdoc.GetOpenApiDocs()
+}).Func
+
+var ApiClientSdk = api.Api(func(req *ClientSdk) (r string, err error) {
+	return httpdoc.GetClientSdk(req.Lang, req.Package)
+}).Func
+
+var ApiApiRegistry = api.Api(func(req *ApiRegistry) (r []*httpdoc.DocsOfService, err error) {
+	return httpdoc.GetApiRegistry()
+}).Func
+
+// ApiDataKeys is registered only if the explorer is enabled in toml, see ConfigExplorer
+var ApiDataKeys func(req *DataKeys) (r *DocsOfData, err error)
+
 var Api_Docs = api.Api(func(req *Docs) (r string, err error) {
 	//create link to api docs or data docs
 	linkToApiDocs := "<a href=\"/apidocs\">API Docs</a>"
 	linkToDataDocs := "<a href=\"/datadocs\">Data Docs</a>"
+	linkToOpenApi := "<a href=\"/openapi\">OpenAPI 3.1</a>"
+	linkToRegistry := "<a href=\"/apiregistry\">API Registry</a>"
+	linkToExplorer := "<a href=\"/explorer/\">API Explorer</a>"
+	linkToClientSdk := "<a href=\"/clientsdk?lang=python\">Python</a>, <a href=\"/clientsdk?lang=go\">Go</a>, <a href=\"/clientsdk?lang=dart\">Dart</a>"
 	return "<html><body>" +
 		"<h1>Welcome to Doptime</h1>" +
 		"<p>Click here to see the " + linkToApiDocs + "</p>" +
 		"<p>Click here to see the " + linkToDataDocs + "</p>" +
+		"<p>Click here to see the " + linkToOpenApi + "</p>" +
+		"<p>Click here to see the " + linkToRegistry + "</p>" +
+		lib.Ternary(explorerOption.Enable, "<p>Click here to try the apis in the "+linkToExplorer+"</p>", "") +
+		"<p>Client SDK: " + linkToClientSdk + "</p>" +
 		"</body></html>", nil
 }).Func
@@ -0,0 +1,177 @@
+package httpserve
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doptime/config/cfghttp"
+	"github.com/doptime/logger"
+	"github.com/doptime/redisdb"
+	"github.com/redis/go-redis/v9"
+)
+
+// ChangeFeedKeyspaceEvents turns on subscribing the keyspace notifications of redis as well,
+// so that the changes not made by doptime are seen. redis should be configured with notify-keyspace-events
+var ChangeFeedKeyspaceEvents = false
+
+// ChangeFeedHeartbeat keeps the idle subscription alive through proxies
+var ChangeFeedHeartbeat = time.Second * 30
+
+// ChangeEvent is sent to the subscribers of the key
+type ChangeEvent struct {
+	Cmd    string   `json:"cmd" msgpack:"cmd"`
+	Key    string   `json:"key" msgpack:"key"`
+	Fields []string `json:"fields,omitempty" msgpack:"fields,omitempty"`
+}
+
+// ChangeChannel is the redis pub/sub channel of the key
+func ChangeChannel(key string) string {
+	return "doptime:change:" + key
+}
+
+// PublishChange notifies the subscribers of the key. apis writing keys directly can call it as well
+func PublishChange(ctx context.Context, rds *redis.Client, cmd, key string, fields ...string) {
+	b, _ := json.Marshal(&ChangeEvent{Cmd: cmd, Key: key, Fields: fields})
+	if err := rds.Publish(ctx, ChangeChannel(key), b).Err(); err != nil {
+		logger.Warn().Str("key", key).Err(err).Msg("publish change failed")
+	}
+}
+
+// IsSubscribeAllowed is true if reading the content of the key is allowed, by the schema type of the key:
+// HGET / HGETALL for hash, ZRANGE for zset, LRANGE for list, SMEMBERS for set, GET for string, XRANGE / XREAD for stream.
+// the other reads, i.g. EXISTS, HLEN or SISMEMBER, do not permit subscribing the changes
+func IsSubscribeAllowed(key, rdsName string) bool {
+	scope := redisdb.KeyScope(key) + ":" + rdsName
+	switch {
+	case redisdb.HttpHashKeyMap.Has(scope):
+		return redisdb.IsAllowedHashOp(key, redisdb.HGet) || redisdb.IsAllowedHashOp(key, redisdb.HGetAll)
+	case redisdb.HttpZSetKeyMap.Has(scope):
+		return redisdb.IsAllowedZSetOp(key, redisdb.ZRange)
+	case redisdb.HttpListKeyMap.Has(scope):
+		return redisdb.IsAllowedListOp(key, redisdb.LRange)
+	case redisdb.HttpSetKeyMap.Has(scope):
+		return redisdb.IsAllowedSetOp(key, redisdb.SMembers)
+	case redisdb.HttpStringKeyMap.Has(scope):
+		return redisdb.IsAllowedStringOp(key, redisdb.Get)
+	case redisdb.HttpStreamKeyMap.Has(scope):
+		return redisdb.IsAllowedStreamOp(key, redisdb.XRange) || redisdb.IsAllowedStreamOp(key, redisdb.XRead)
+	}
+	return false
+}
+
+// SubscribeChanges delivers the changes of the key until ctx is done.
+// fieldPattern filters the fields of hash changes, i.g. "msg:*". changes without fields (DEL, EXPIRE...) are always delivered
+func SubscribeChanges(ctx context.Context, rds *redis.Client, key, fieldPattern string, deliver func(event *ChangeEvent) error) (err error) {
+	channels := []string{ChangeChannel(key)}
+	keyspaceChannel := "__keyspace@" + strconv.Itoa(rds.Options().DB) + "__:" + key
+	if ChangeFeedKeyspaceEvents {
+		channels = append(channels, keyspaceChannel)
+	}
+	pubsub := rds.Subscribe(ctx, channels...)
+	defer pubsub.Close()
+	if _, err = pubsub.Receive(ctx); err != nil {
+		return err
+	}
+	messages, heartbeat := pubsub.Channel(), time.NewTicker(ChangeFeedHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if err = deliver(nil); err != nil {
+				return err
+			}
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			event := &ChangeEvent{}
+			if msg.Channel == keyspaceChannel {
+				event.Cmd, event.Key = strings.ToUpper(msg.Payload), key
+			} else if json.Unmarshal([]byte(msg.Payload), event) != nil {
+				continue
+			}
+			if !matchFields(event.Fields, fieldPattern) {
+				continue
+			}
+			if err = deliver(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func matchFields(fields []string, pattern string) bool {
+	if pattern == "" || len(fields) == 0 {
+		return true
+	}
+	for _, field := range fields {
+		if ok, _ := path.Match(pattern, field); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// changeFeedWriter is implemented by the response writers that push events themselves, i.g. websocket
+type changeFeedWriter interface {
+	PushChange(event *ChangeEvent) error
+}
+
+// responseSubscribe holds the request until the client is gone. http clients receive Server-Sent Events
+func responseSubscribe(w http.ResponseWriter, r *http.Request, svcCtx *DoptimeReqCtx) {
+	var deliver func(event *ChangeEvent) error
+	if feedWriter, ok := w.(changeFeedWriter); ok {
+		deliver = func(event *ChangeEvent) error {
+			if event == nil {
+				return nil
+			}
+			return feedWriter.PushChange(event)
+		}
+	} else {
+		flusher, _ := w.(http.Flusher)
+		//the subscription outlives the write timeout of the server
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		if len(cfghttp.CORES) > 0 {
+			w.Header().Set("Access-Control-Allow-Origin", cfghttp.CORES)
+		}
+		w.Header().Set("Content-Type", ContentTypeEventStream)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		deliver = func(event *ChangeEvent) (err error) {
+			if event == nil {
+				_, err = w.Write([]byte(": ping\n\n"))
+			} else {
+				b, _ := json.Marshal(event)
+				_, err = w.Write([]byte("event: change\ndata: " + string(b) + "\n\n"))
+			}
+			if err == nil && flusher != nil {
+				flusher.Flush()
+			}
+			return err
+		}
+	}
+	if err := SubscribeChanges(r.Context(), svcCtx.RdsClient, svcCtx.Key, svcCtx.Field(), deliver); err != nil {
+		logger.Debug().Str("key", svcCtx.Key).Err(err).Msg("subscription ended")
+	}
+}
+
+func init() {
+	RegisterDataCommand(&DataCommand{Name: SUBSCRIBE, RequireKey: true,
+		Permitted: func(svcCtx *DoptimeReqCtx) bool { return IsSubscribeAllowed(svcCtx.Key, svcCtx.RedisDataSource) },
+		Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+			responseSubscribe(svcCtx.Writer, svcCtx.Request, svcCtx)
+			svcCtx.Responded = true
+			return nil, nil
+		}})
+}
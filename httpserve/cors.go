@@ -20,7 +20,7 @@ func CorsChecked(r *http.Request, w http.ResponseWriter) bool {
 			if cfghttp.CORES == "*" {
 				// Allow all origins
 				w.Header().Set("Access-Control-Allow-Origin", "*")
-			} else if strings.Contains(cfghttp.CORES, origin) {
+			} else if corsAllowed(origin) {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 			}
 		}
@@ -31,3 +31,13 @@ func CorsChecked(r *http.Request, w http.ResponseWriter) bool {
 	}
 	return false
 }
+
+// corsAllowed is true if the origin is one of the comma separated CORES, exactly
+func corsAllowed(origin string) bool {
+	for _, allowed := range strings.Split(cfghttp.CORES, ",") {
+		if allowed = strings.TrimSpace(allowed); allowed == "*" || (allowed != "" && allowed == origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,365 @@
+package httpserve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/doptime/doptime/lib"
+	"github.com/doptime/doptime/vars"
+	"github.com/doptime/logger"
+	"github.com/doptime/redisdb"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// BatchOp is a data command of the batch request. Path is the same as the last part of http url, i.g. "HSET-UserProfile:@sub?f=name".
+// Body is the value of the command, the same as the msgpack body of http
+type BatchOp struct {
+	Path string      `json:"path" msgpack:"path"`
+	Body interface{} `json:"body,omitempty" msgpack:"body,omitempty"`
+}
+
+// BatchRequest is the body of MULTI & PIPELINE, as json or msgpack (Content-Type: application/octet-stream)
+type BatchRequest struct {
+	Ops []BatchOp `json:"ops" msgpack:"ops"`
+	// Watch are the keys to WATCH before MULTI, @tag supported. the transaction fails with conflict if any of them is changed.
+	// PIPELINE doesn't support it
+	Watch []string `json:"watch,omitempty" msgpack:"watch,omitempty"`
+}
+
+// BatchResult is the result of the op, in the order of BatchRequest.Ops
+type BatchResult struct {
+	Data  interface{}    `json:"data,omitempty" msgpack:"data,omitempty"`
+	Error *vars.ApiError `json:"error,omitempty" msgpack:"error,omitempty"`
+}
+
+// BatchMaxOps limits the ops of a MULTI or PIPELINE request
+var BatchMaxOps = 1000
+
+// batchOp is the op with the context of its own, as if it's requested alone
+type batchOp struct {
+	svcCtx *DoptimeReqCtx
+	cmd    *DataCommand
+	reply  QueuedReply
+	// queued is set if the op is added to the pipeline. data & err are returned by the middleware chain of the op
+	queued bool
+	data   interface{}
+	err    error
+}
+
+// batchRun runs the ops through the rate limits & the middleware chain, as if they're requested alone.
+// the innermost handler of the chain checks & queues the op, then waits until the pipeline is executed,
+// so that the middlewares see the reply of the op. the op rejected by them is never sent to redis
+type batchRun struct {
+	chain    *middlewareChain
+	executed chan struct{}
+	// execErr is the result of the queued ops if the pipeline is not executed, i.g. the transaction is aborted
+	execErr error
+	wg      sync.WaitGroup
+}
+
+func newBatchRun() *batchRun {
+	return &batchRun{chain: handlerChain.Load(), executed: make(chan struct{})}
+}
+
+// queue runs the chain of op, until the op is queued to pipe, or the chain returns without queueing it.
+// the ops share the pipeline, so they are queued one by one
+func (run *batchRun) queue(pipe redis.Pipeliner, op *batchOp) {
+	var (
+		once     sync.Once
+		queuedCh = make(chan struct{})
+	)
+	signal := func() { once.Do(func() { close(queuedCh) }) }
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer signal()
+		//the chain runs out of the goroutine of the http server, the panic of middlewares is recovered here
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error().Any("panic", r).Str("cmd", op.svcCtx.Cmd).Str("key", op.svcCtx.Key).Msg("batch op panic")
+				op.err = fmt.Errorf("batch op panic: %v", r)
+			}
+		}()
+		if op.err = checkRateLimits(op.svcCtx); op.err != nil {
+			return
+		}
+		op.data, op.err = run.chain.wrap(func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+			if err := op.cmd.check(svcCtx); err != nil {
+				return nil, err
+			}
+			reply, err := op.cmd.Queue(svcCtx, pipe)
+			if err != nil {
+				return nil, err
+			}
+			op.reply, op.queued = reply, true
+			signal()
+			if <-run.executed; run.execErr != nil {
+				return nil, run.execErr
+			}
+			data, err := op.reply()
+			return data, op.cmd.notFound(err)
+		})(op.svcCtx)
+	}()
+	<-queuedCh
+}
+
+// finish releases the queued ops after the pipeline is executed, or with err if it's not, then waits for their chains to return
+func (run *batchRun) finish(err error) {
+	run.execErr = err
+	close(run.executed)
+	run.wg.Wait()
+}
+
+// queueWithKey runs f with the typed key of svcCtx.Key, got by getKey, i.g. redisdb.GetHttpHashKey
+func queueWithKey[K any](getKey func(key, rdsName string) (K, error), f func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, key K) (QueuedReply, error)) QueueFunc {
+	return func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+		key, err := getKey(svcCtx.Key, svcCtx.RedisDataSource)
+		if err != nil {
+			return nil, err
+		}
+		return f(svcCtx, pipe, key)
+	}
+}
+
+// replyOf reads the reply by result, i.g. pipe.HLen(ctx, key).Result
+func replyOf[T any](result func() (T, error)) QueuedReply {
+	return func() (interface{}, error) { return result() }
+}
+
+// replyValue converts the reply to the value type of the key
+func replyValue(key redisdb.IHttpKey, cmd *redis.StringCmd) QueuedReply {
+	return func() (interface{}, error) {
+		valStr, err := cmd.Result()
+		if err != nil {
+			return nil, err
+		}
+		return deserializeValue(key, valStr)
+	}
+}
+
+// replyValues converts the reply to the value type of the key, by deserializeValues or unmarshalMembers
+func replyValues(key redisdb.IHttpKey, cmd *redis.StringSliceCmd, convert func(key redisdb.IHttpKey, valStrs []string) ([]interface{}, error)) QueuedReply {
+	return func() (interface{}, error) {
+		valStrs, err := cmd.Result()
+		if err != nil {
+			return nil, err
+		}
+		return convert(key, valStrs)
+	}
+}
+
+func parseBatchRequest(svcCtx *DoptimeReqCtx) (batch *BatchRequest, err error) {
+	var body []byte
+	if body, err = io.ReadAll(svcCtx.Request.Body); err != nil {
+		return nil, fmt.Errorf("%w: %v", vars.ErrInvalidInput, err)
+	}
+	batch = &BatchRequest{}
+	if svcCtx.Request.Header.Get("Content-Type") == "application/octet-stream" {
+		err = msgpack.Unmarshal(body, batch)
+	} else {
+		err = json.Unmarshal(body, batch)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", vars.ErrInvalidInput, err)
+	} else if len(batch.Ops) == 0 {
+		return nil, fmt.Errorf("%w: ops required", vars.ErrInvalidInput)
+	} else if len(batch.Ops) > BatchMaxOps {
+		return nil, fmt.Errorf("%w: %d ops, at most %d", vars.ErrInvalidInput, len(batch.Ops), BatchMaxOps)
+	}
+	return batch, nil
+}
+
+// newBatchOp builds the context of the op with the jwt of the batch request.
+// the permission & the params are checked by the chain of the op, after the middlewares
+func newBatchOp(svcCtx *DoptimeReqCtx, op *BatchOp) (_ *batchOp, err error) {
+	var (
+		body       []byte
+		httpReq    *http.Request
+		httpStatus int
+		opCtx      *DoptimeReqCtx
+	)
+	if op.Body != nil {
+		if body, err = msgpack.Marshal(op.Body); err != nil {
+			return nil, fmt.Errorf("%w: %v", vars.ErrInvalidInput, err)
+		}
+	}
+	if httpReq, err = http.NewRequestWithContext(svcCtx.Ctx, http.MethodPost, "/"+strings.TrimPrefix(op.Path, "/"), bytes.NewReader(body)); err != nil {
+		return nil, fmt.Errorf("%w: %v", vars.ErrInvalidInput, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/octet-stream")
+	if jwtToken := svcCtx.Request.Header.Get("Authorization"); len(jwtToken) > 0 {
+		httpReq.Header.Set("Authorization", jwtToken)
+	}
+	httpReq.RemoteAddr, httpReq.Host = svcCtx.Request.RemoteAddr, svcCtx.Request.Host
+	if opCtx, err, httpStatus = NewHttpContext(svcCtx.Ctx, httpReq, svcCtx.Writer); httpStatus != http.StatusOK {
+		return nil, fmt.Errorf("%w: %v", lib.Ternary(httpStatus == http.StatusUnauthorized, vars.ErrJWT, vars.ErrInvalidInput), err)
+	}
+	dataCmd, ok := DataCommands.Get(opCtx.Cmd)
+	if !ok || dataCmd.Queue == nil {
+		return nil, fmt.Errorf("%w: %s can not be batched", ErrBadCommand, opCtx.Cmd)
+	}
+	return &batchOp{svcCtx: opCtx, cmd: dataCmd}, nil
+}
+
+// result is the result of the op returned by its chain, the change is published if it's a succeeded write
+func (op *batchOp) result() (result BatchResult) {
+	if op.err != nil {
+		return BatchResult{Error: vars.ToApiError(op.err)}
+	}
+	if op.queued && op.cmd.Writes {
+		go PublishChange(context.Background(), op.svcCtx.RdsClient, op.svcCtx.Cmd, op.svcCtx.Key, op.svcCtx.Fields...)
+	}
+	return BatchResult{Data: op.data}
+}
+
+func batchResults(ops []*batchOp) []BatchResult {
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = op.result()
+	}
+	return results
+}
+
+// watchKeys are the Watch of the batch with @tag replaced. only the keys operated by the batch can be watched
+func watchKeys(svcCtx *DoptimeReqCtx, batch *BatchRequest, ops []*batchOp) (keys []string, err error) {
+	opKeys := map[string]bool{}
+	for _, op := range ops {
+		opKeys[op.svcCtx.Key] = true
+		//the redis key of string key is Key:field
+		for _, field := range op.svcCtx.Fields {
+			opKeys[stringKeyName(op.svcCtx.Key, field)] = true
+		}
+	}
+	for _, key := range batch.Watch {
+		if key, err = svcCtx.replaceTags(key); err != nil {
+			return nil, err
+		} else if !opKeys[key] {
+			return nil, fmt.Errorf("%w: watch %s, which is not operated by the batch", ErrOperationNotPermited, key)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// multiExec runs the ops in MULTI/EXEC. any op rejected by the rate limits or the middlewares, or failed in permission, params or value,
+// aborts the batch before anything is sent to redis. errors of single commands in EXEC don't roll back the others, they are reported in the result of the op
+func multiExec(svcCtx *DoptimeReqCtx) (interface{}, error) {
+	batch, err := parseBatchRequest(svcCtx)
+	if err != nil {
+		return nil, err
+	}
+	ops := make([]*batchOp, len(batch.Ops))
+	for i := range batch.Ops {
+		if ops[i], err = newBatchOp(svcCtx, &batch.Ops[i]); err != nil {
+			return nil, fmt.Errorf("ops[%d]: %w", i, err)
+		} else if ops[i].svcCtx.RedisDataSource != svcCtx.RedisDataSource {
+			return nil, fmt.Errorf("%w: ops[%d] is on datasource %s, the transaction is on %s", vars.ErrInvalidInput, i, ops[i].svcCtx.RedisDataSource, svcCtx.RedisDataSource)
+		}
+	}
+	keys, err := watchKeys(svcCtx, batch, ops)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		run       = newBatchRun()
+		rejected  error
+		queuedAll bool
+	)
+	queue := func(pipe redis.Pipeliner) error {
+		for i, op := range ops {
+			//the op answered by the middleware without being queued, i.g. from cache, is not part of the transaction
+			if run.queue(pipe, op); !op.queued && op.err != nil {
+				rejected = fmt.Errorf("ops[%d]: %w", i, op.err)
+				return rejected
+			}
+		}
+		queuedAll = true
+		return nil
+	}
+	if len(keys) == 0 {
+		_, err = svcCtx.RdsClient.TxPipelined(svcCtx.Ctx, queue)
+	} else {
+		err = svcCtx.RdsClient.Watch(svcCtx.Ctx, func(tx *redis.Tx) error {
+			_, err := tx.TxPipelined(svcCtx.Ctx, queue)
+			return err
+		}, keys...)
+	}
+	if errors.Is(err, redis.TxFailedErr) {
+		err = fmt.Errorf("%w: watched keys changed, transaction aborted", vars.ErrConflict)
+	} else if rejected != nil {
+		err = rejected
+	} else if queuedAll {
+		//errors of single commands are read from the replies
+		err = nil
+	}
+	//WATCH failed if nothing is queued
+	if run.finish(err); err != nil {
+		return nil, err
+	}
+	return batchResults(ops), nil
+}
+
+// pipelineExec runs the ops in one redis pipeline per datasource, the datasources are run concurrently.
+// it's not atomic, each op succeeds or fails on its own, including the rejections of the rate limits & the middlewares,
+// and the failures of permission, params and value
+func pipelineExec(svcCtx *DoptimeReqCtx) (interface{}, error) {
+	batch, err := parseBatchRequest(svcCtx)
+	if err != nil {
+		return nil, err
+	} else if len(batch.Watch) > 0 {
+		return nil, fmt.Errorf("%w: watch is supported by MULTI only", vars.ErrInvalidInput)
+	}
+	var (
+		results = make([]BatchResult, len(batch.Ops))
+		ops     = make([]*batchOp, len(batch.Ops))
+		// indexes of the ops, keyed by datasource
+		opsOfDs = map[string][]int{}
+		wg      sync.WaitGroup
+	)
+	for i := range batch.Ops {
+		if ops[i], err = newBatchOp(svcCtx, &batch.Ops[i]); err != nil {
+			results[i].Error = vars.ToApiError(err)
+			continue
+		}
+		opsOfDs[ops[i].svcCtx.RedisDataSource] = append(opsOfDs[ops[i].svcCtx.RedisDataSource], i)
+	}
+	for _, indexes := range opsOfDs {
+		wg.Add(1)
+		go func(indexes []int) {
+			defer wg.Done()
+			//the rejected ops are not queued, errors of the commands are read from the replies, one by one
+			run := newBatchRun()
+			ops[indexes[0]].svcCtx.RdsClient.Pipelined(svcCtx.Ctx, func(pipe redis.Pipeliner) error {
+				for _, i := range indexes {
+					run.queue(pipe, ops[i])
+				}
+				return nil
+			})
+			run.finish(nil)
+		}(indexes)
+	}
+	wg.Wait()
+	for i, op := range ops {
+		if op != nil {
+			results[i] = op.result()
+		}
+	}
+	return results, nil
+}
+
+func init() {
+	// POST /MULTI & POST /PIPELINE, the ops are permission checked one by one, as if they're requested alone
+	RegisterDataCommand(
+		&DataCommand{Name: MULTI, Execute: multiExec},
+		&DataCommand{Name: PIPELINE, Execute: pipelineExec},
+	)
+}
@@ -0,0 +1,68 @@
+package httpserve
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/doptime/config/cfgredis"
+	"github.com/doptime/doptime/vars"
+	"github.com/redis/go-redis/v9"
+)
+
+var errBlockedByMiddleware = errors.New("blocked by middleware")
+
+func init() {
+	Use(func(next HandlerFunc) HandlerFunc {
+		return func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+			if svcCtx.Key == "blockedbymiddleware" {
+				return nil, errBlockedByMiddleware
+			}
+			return next(svcCtx)
+		}
+	})
+}
+
+func newBatchCtx(t *testing.T, cmd, body string) *DoptimeReqCtx {
+	if _, ok := cfgredis.Servers.Get("default"); !ok {
+		//the rejected ops are never sent to redis
+		cfgredis.Servers.Set("default", redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"}))
+	}
+	r := httptest.NewRequest(http.MethodPost, "/"+cmd, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	svcCtx, err, httpStatus := NewHttpContext(context.Background(), r, httptest.NewRecorder())
+	if httpStatus != http.StatusOK {
+		t.Fatal(err)
+	}
+	return svcCtx
+}
+
+func TestMultiOpsThroughMiddleware(t *testing.T) {
+	svcCtx := newBatchCtx(t, MULTI, `{"ops":[{"path":"HGET-blockedbymiddleware?f=name"}]}`)
+	//the op is rejected by the middleware, rather than reaching the permission check
+	if _, err := multiExec(svcCtx); !errors.Is(err, errBlockedByMiddleware) {
+		t.Fatalf("the op in MULTI should be rejected by the middleware, got %v", err)
+	}
+}
+
+func TestPipelineOpsThroughMiddleware(t *testing.T) {
+	svcCtx := newBatchCtx(t, PIPELINE, `{"ops":[{"path":"HGET-blockedbymiddleware?f=name"}]}`)
+	result, err := pipelineExec(svcCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results := result.([]BatchResult); results[0].Error == nil || !strings.Contains(results[0].Error.Message, errBlockedByMiddleware.Error()) {
+		t.Fatalf("the op in PIPELINE should be rejected by the middleware, got %+v", results[0])
+	}
+}
+
+func TestBatchMaxOps(t *testing.T) {
+	ops := strings.Repeat(`{"path":"HGET-k?f=a"},`, BatchMaxOps+1)
+	svcCtx := newBatchCtx(t, PIPELINE, `{"ops":[`+strings.TrimSuffix(ops, ",")+`]}`)
+	if _, err := pipelineExec(svcCtx); !errors.Is(err, vars.ErrInvalidInput) {
+		t.Fatalf("too many ops should be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package httpserve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/doptime/doptime/vars"
+	"github.com/doptime/redisdb"
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// LuaKey is a KEYS of lua script. @tag in Key is replaced by jwt, i.g. "Cart:@sub".
+// Op is checked by the redisdb whitelist, the same as the data commands, i.g. uint64(redisdb.HIncrBy)
+type LuaKey struct {
+	Key string
+	Op  uint64
+}
+
+// LuaScript is the named lua script, called by EVAL-Name. it's atomic, for the rules too small to be an api
+type LuaScript struct {
+	Name   string
+	Script *redis.Script
+	Keys   []LuaKey
+	// Args are the ARGV of the script, read from url query in order. the values are converted by Kind
+	Args []DataCmdParam
+	// Writes publishes ChangeEvent of all the keys after success
+	Writes bool
+}
+
+// LuaScripts is keyed by LuaScript.Name
+var LuaScripts = cmap.New[*LuaScript]()
+
+// RegisterLuaScript adds the script, or replaces the one of the same name:
+//
+//	httpserve.RegisterLuaScript(&httpserve.LuaScript{Name: "decrStock",
+//		Script: redis.NewScript(`local n = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+//			if n <= 0 then return -1 end
+//			return redis.call('HINCRBY', KEYS[1], ARGV[1], -1)`),
+//		Keys:   []httpserve.LuaKey{{Key: "Stock", Op: uint64(redisdb.HIncrBy)}},
+//		Args:   []httpserve.DataCmdParam{{Name: "Item", Kind: httpserve.ParamString, Required: true}},
+//		Writes: true})
+func RegisterLuaScript(scripts ...*LuaScript) {
+	for _, script := range scripts {
+		LuaScripts.Set(script.Name, script)
+	}
+}
+
+// keys are the KEYS of the script, with @tag replaced
+func (s *LuaScript) keys(svcCtx *DoptimeReqCtx) (keys []string, err error) {
+	keys = make([]string, len(s.Keys))
+	for i, key := range s.Keys {
+		if keys[i], err = svcCtx.replaceTags(key.Key); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// args are the ARGV of the script. the params should be checked already
+func (s *LuaScript) args(svcCtx *DoptimeReqCtx) []interface{} {
+	args := make([]interface{}, len(s.Args))
+	for i, param := range s.Args {
+		switch param.Kind {
+		case ParamInt:
+			args[i] = svcCtx.FormInt(param.Name)
+		case ParamUint:
+			args[i] = svcCtx.FormUint(param.Name)
+		case ParamFloat:
+			args[i] = svcCtx.FormFloat(param.Name)
+		case ParamDuration:
+			args[i] = svcCtx.FormDuration(param.Name).Milliseconds()
+		case ParamBool:
+			args[i] = svcCtx.FormBool(param.Name)
+		default:
+			args[i] = svcCtx.FormValue(param.Name)
+		}
+	}
+	return args
+}
+
+// run calls the script by EVALSHA. the script is loaded by SCRIPT LOAD if the server doesn't have it, i.g. after restart
+func (s *LuaScript) run(ctx context.Context, rds *redis.Client, keys []string, args []interface{}) (interface{}, error) {
+	result, err := s.Script.EvalSha(ctx, rds, keys, args...).Result()
+	if !errors.Is(err, redis.ErrNoScript) {
+		return result, err
+	}
+	if err = s.Script.Load(ctx, rds).Err(); err != nil {
+		return nil, err
+	}
+	return s.Script.EvalSha(ctx, rds, keys, args...).Result()
+}
+
+// luaScriptOf is the script named by the key of EVAL-Name, with the keys & params checked
+func luaScriptOf(svcCtx *DoptimeReqCtx) (script *LuaScript, keys []string, err error) {
+	var ok bool
+	if script, ok = LuaScripts.Get(svcCtx.Key); !ok {
+		return nil, nil, fmt.Errorf("%w: lua script %s", vars.ErrNotFound, svcCtx.Key)
+	}
+	for _, param := range script.Args {
+		if err = svcCtx.checkParam(param); err != nil {
+			return nil, nil, err
+		}
+	}
+	if keys, err = script.keys(svcCtx); err != nil {
+		return nil, nil, err
+	}
+	return script, keys, nil
+}
+
+// allowLuaScript checks the op of every key of the script. unknown scripts are left to Execute, to be answered as not found
+func allowLuaScript(svcCtx *DoptimeReqCtx) bool {
+	script, ok := LuaScripts.Get(svcCtx.Key)
+	if !ok {
+		return true
+	}
+	keys, err := script.keys(svcCtx)
+	if err != nil {
+		return false
+	}
+	for i, key := range keys {
+		if !redisdb.IsAllowedCommon(key, script.Keys[i].Op) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *LuaScript) publishChanges(rds *redis.Client, keys []string) {
+	if !s.Writes {
+		return
+	}
+	for _, key := range keys {
+		go PublishChange(context.Background(), rds, EVAL, key)
+	}
+}
+
+func init() {
+	RegisterDataCommand(&DataCommand{Name: EVAL, RequireKey: true, Permitted: allowLuaScript,
+		Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+			script, keys, err := luaScriptOf(svcCtx)
+			if err != nil {
+				return nil, err
+			}
+			result, err := script.run(svcCtx.Ctx, svcCtx.RdsClient, keys, script.args(svcCtx))
+			if err == nil {
+				script.publishChanges(svcCtx.RdsClient, keys)
+			}
+			return result, err
+		},
+		// EVAL is queued with the whole script, as EVALSHA can not fall back to SCRIPT LOAD in MULTI & PIPELINE
+		Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+			script, keys, err := luaScriptOf(svcCtx)
+			if err != nil {
+				return nil, err
+			}
+			cmd := script.Script.Eval(svcCtx.Ctx, pipe, keys, script.args(svcCtx)...)
+			return func() (interface{}, error) {
+				result, err := cmd.Result()
+				if err == nil {
+					script.publishChanges(svcCtx.RdsClient, keys)
+				}
+				return result, err
+			}, nil
+		}})
+}
@@ -0,0 +1,214 @@
+package httpserve
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/doptime/redisdb"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func allowHash(op redisdb.HashOp) func(svcCtx *DoptimeReqCtx) bool {
+	return func(svcCtx *DoptimeReqCtx) bool { return redisdb.IsAllowedHashOp(svcCtx.Key, op) }
+}
+
+// withHashKey runs f with the typed hash key of svcCtx.Key
+func withHashKey(f func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (interface{}, error)) HandlerFunc {
+	return func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+		hkey, err := redisdb.GetHttpHashKey(svcCtx.Key, svcCtx.RedisDataSource)
+		if err != nil {
+			return nil, err
+		}
+		return f(svcCtx, hkey)
+	}
+}
+
+var scanParams = []DataCmdParam{{"Cursor", ParamUint, true}, {"Match", ParamString, true}, {"Count", ParamInt, true}}
+
+func init() {
+	RegisterDataCommand(
+		&DataCommand{Name: HGET, RequireKey: true, RequireField: true, Permitted: allowHash(redisdb.HGet),
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (interface{}, error) {
+				return hkey.HGet(svcCtx.Field())
+			}),
+			Queue: queueWithKey(redisdb.GetHttpHashKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, hkey redisdb.IHttpHashKey) (QueuedReply, error) {
+				return replyValue(hkey, pipe.HGet(svcCtx.Ctx, svcCtx.Key, svcCtx.Field())), nil
+			})},
+		&DataCommand{Name: HGETALL, RequireKey: true, Permitted: allowHash(redisdb.HGetAll),
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (interface{}, error) {
+				return hkey.HGetAll()
+			}),
+			Queue: queueWithKey(redisdb.GetHttpHashKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, hkey redisdb.IHttpHashKey) (QueuedReply, error) {
+				cmd := pipe.HGetAll(svcCtx.Ctx, svcCtx.Key)
+				return func() (interface{}, error) {
+					valStrs, err := cmd.Result()
+					if err != nil {
+						return nil, err
+					}
+					values := make(map[string]interface{}, len(valStrs))
+					for field, valStr := range valStrs {
+						if values[field], err = deserializeValue(hkey, valStr); err != nil {
+							return nil, err
+						}
+					}
+					return values, nil
+				}, nil
+			})},
+		&DataCommand{Name: HMGET, RequireKey: true, RequireField: true, Permitted: allowHash(redisdb.HMGET),
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (interface{}, error) {
+				return hkey.HMGET(sliceToInterface(strings.Split(svcCtx.Field(), ","))...)
+			}),
+			Queue: queueWithKey(redisdb.GetHttpHashKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, hkey redisdb.IHttpHashKey) (QueuedReply, error) {
+				cmd := pipe.HMGet(svcCtx.Ctx, svcCtx.Key, strings.Split(svcCtx.Field(), ",")...)
+				return func() (interface{}, error) {
+					vals, err := cmd.Result()
+					if err != nil {
+						return nil, err
+					}
+					values := make([]interface{}, len(vals))
+					for i, val := range vals {
+						if valStr, ok := val.(string); ok {
+							if values[i], err = deserializeValue(hkey, valStr); err != nil {
+								return nil, err
+							}
+						}
+					}
+					return values, nil
+				}, nil
+			})},
+		&DataCommand{Name: HSET, RequireKey: true, RequireField: true, Writes: true, Permitted: allowHash(redisdb.HSet),
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (result interface{}, err error) {
+				if result, err = svcCtx.ToValue(hkey, svcCtx.Body()); err == nil {
+					_, err = hkey.HSet(svcCtx.Field(), result)
+				}
+				return result, err
+			}),
+			Queue: queueWithKey(redisdb.GetHttpHashKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, hkey redisdb.IHttpHashKey) (QueuedReply, error) {
+				valStr, err := svcCtx.storedValue(hkey)
+				if err != nil {
+					return nil, err
+				}
+				return replyOf(pipe.HSet(svcCtx.Ctx, svcCtx.Key, svcCtx.Field(), valStr).Result), nil
+			})},
+		&DataCommand{Name: HMSET, RequireKey: true, Writes: true, Permitted: allowHash(redisdb.HSet),
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (result interface{}, err error) {
+				var (
+					valuesInMsgpack = []string{}
+					values          []interface{}
+				)
+				if err = msgpack.Unmarshal(svcCtx.Body(), &valuesInMsgpack); err != nil {
+					return 0, err
+				} else if len(valuesInMsgpack) != len(svcCtx.Fields) {
+					return 0, errors.New("fields count mismatch")
+				} else if values, err = svcCtx.ToValues(hkey, valuesInMsgpack); err != nil {
+					return 0, err
+				}
+				for i, field := range svcCtx.Fields {
+					if _, err = hkey.HSet(field, values[i]); err != nil {
+						return 0, err
+					}
+				}
+				return svcCtx.Fields, nil
+			})},
+		&DataCommand{Name: HSETNX, RequireKey: true, RequireField: true, Writes: true, Permitted: allowHash(redisdb.HSetNX),
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (interface{}, error) {
+				valStr, err := svcCtx.storedValue(hkey)
+				if err != nil {
+					return nil, err
+				}
+				return svcCtx.RdsClient.HSetNX(svcCtx.Ctx, svcCtx.Key, svcCtx.Field(), valStr).Result()
+			}),
+			Queue: queueWithKey(redisdb.GetHttpHashKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, hkey redisdb.IHttpHashKey) (QueuedReply, error) {
+				valStr, err := svcCtx.storedValue(hkey)
+				if err != nil {
+					return nil, err
+				}
+				return replyOf(pipe.HSetNX(svcCtx.Ctx, svcCtx.Key, svcCtx.Field(), valStr).Result), nil
+			})},
+		&DataCommand{Name: HSTRLEN, RequireKey: true, RequireField: true, Permitted: allowHash(redisdb.HGet),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return svcCtx.RdsClient.HStrLen(svcCtx.Ctx, svcCtx.Key, svcCtx.Field()).Result()
+			}},
+		&DataCommand{Name: HDEL, RequireKey: true, RequireField: true, Writes: true, Permitted: allowHash(redisdb.HDel),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				// HDel 未在 IHttpHashKey 定义，兜底使用 RdsClient
+				return svcCtx.RdsClient.HDel(svcCtx.Ctx, svcCtx.Key, svcCtx.Fields...).Result()
+			},
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.HDel(svcCtx.Ctx, svcCtx.Key, svcCtx.Fields...).Result), nil
+			}},
+		&DataCommand{Name: HLEN, RequireKey: true, Permitted: allowHash(redisdb.HLen),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				// HLen 暂未在 IHttpHashKey 定义，兜底使用 RdsClient
+				return svcCtx.RdsClient.HLen(svcCtx.Ctx, svcCtx.Key).Result()
+			},
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.HLen(svcCtx.Ctx, svcCtx.Key).Result), nil
+			}},
+		&DataCommand{Name: HKEYS, RequireKey: true, Permitted: allowHash(redisdb.HKeys),
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (interface{}, error) {
+				return hkey.HKeys()
+			}),
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.HKeys(svcCtx.Ctx, svcCtx.Key).Result), nil
+			}},
+		&DataCommand{Name: HVALS, RequireKey: true, Permitted: allowHash(redisdb.HVals),
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (interface{}, error) {
+				return hkey.HVals()
+			}),
+			Queue: queueWithKey(redisdb.GetHttpHashKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, hkey redisdb.IHttpHashKey) (QueuedReply, error) {
+				return replyValues(hkey, pipe.HVals(svcCtx.Ctx, svcCtx.Key), deserializeValues), nil
+			})},
+		&DataCommand{Name: HEXISTS, RequireKey: true, RequireField: true, Permitted: allowHash(redisdb.HExists),
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (interface{}, error) {
+				return hkey.HExists(svcCtx.Field())
+			}),
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.HExists(svcCtx.Ctx, svcCtx.Key, svcCtx.Field()).Result), nil
+			}},
+		&DataCommand{Name: HRANDFIELD, RequireKey: true, Permitted: allowHash(redisdb.HRandField),
+			Params: []DataCmdParam{{"Count", ParamInt, true}},
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (interface{}, error) {
+				return hkey.HRandField(int(svcCtx.FormInt("Count")))
+			})},
+		&DataCommand{Name: HRANDFIELDWITHVALUES, RequireKey: true, Permitted: allowHash(redisdb.HRandField),
+			Params: []DataCmdParam{{"Count", ParamInt, true}},
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (interface{}, error) {
+				return hkey.HRandFieldWithValues(int(svcCtx.FormInt("Count")))
+			})},
+		&DataCommand{Name: HINCRBY, RequireKey: true, RequireField: true, Writes: true, Permitted: allowHash(redisdb.HIncrBy),
+			Params: []DataCmdParam{{"Incr", ParamInt, true}},
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return boolResult(svcCtx.RdsClient.HIncrBy(svcCtx.Ctx, svcCtx.Key, svcCtx.Field(), svcCtx.FormInt("Incr")).Err())
+			},
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.HIncrBy(svcCtx.Ctx, svcCtx.Key, svcCtx.Field(), svcCtx.FormInt("Incr")).Result), nil
+			}},
+		&DataCommand{Name: HINCRBYFLOAT, RequireKey: true, RequireField: true, Writes: true, Permitted: allowHash(redisdb.HIncrByFloat),
+			Params: []DataCmdParam{{"Incr", ParamFloat, true}},
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return boolResult(svcCtx.RdsClient.HIncrByFloat(svcCtx.Ctx, svcCtx.Key, svcCtx.Field(), svcCtx.FormFloat("Incr")).Err())
+			},
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.HIncrByFloat(svcCtx.Ctx, svcCtx.Key, svcCtx.Field(), svcCtx.FormFloat("Incr")).Result), nil
+			}},
+		&DataCommand{Name: HSCAN, RequireKey: true, Permitted: allowHash(redisdb.HScan),
+			Params: append(scanParams, DataCmdParam{"NOVALUE", ParamBool, false}),
+			Execute: withHashKey(func(svcCtx *DoptimeReqCtx, hkey redisdb.IHttpHashKey) (interface{}, error) {
+				cursor, match, count := svcCtx.FormUint("Cursor"), svcCtx.FormValue("Match"), svcCtx.FormInt("Count")
+				if svcCtx.FormBool("NOVALUE") {
+					keys, cursorRet, err := hkey.HScanNoValues(cursor, match, count)
+					if err != nil {
+						return nil, err
+					}
+					return map[string]interface{}{"keys": keys, "cursor": cursorRet}, nil
+				}
+				keys, values, cursorRet, err := hkey.HScan(cursor, match, count)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"keys": keys, "values": values, "cursor": cursorRet}, nil
+			})},
+	)
+}
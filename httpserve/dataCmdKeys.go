@@ -0,0 +1,130 @@
+package httpserve
+
+import (
+	"context"
+	"time"
+
+	"github.com/doptime/redisdb"
+	"github.com/redis/go-redis/v9"
+)
+
+// allowCommon checks the operations shared by all types of key, i.g. redisdb.Expire
+func allowCommon(op uint64) func(svcCtx *DoptimeReqCtx) bool {
+	return func(svcCtx *DoptimeReqCtx) bool { return redisdb.IsAllowedCommon(svcCtx.Key, op) }
+}
+
+func allowDB(op redisdb.DBOp) func(svcCtx *DoptimeReqCtx) bool {
+	return func(svcCtx *DoptimeReqCtx) bool { return redisdb.IsAllowedDBOp(op) }
+}
+
+var newKeyParams = []DataCmdParam{{"NewKey", ParamString, true}}
+
+// publishNewKey publishes the change of NewKey once the key is renamed to it. the change of the key is published as other writes
+func publishNewKey(svcCtx *DoptimeReqCtx, renamed bool, err error) error {
+	if renamed && err == nil {
+		go PublishChange(context.Background(), svcCtx.RdsClient, svcCtx.Cmd, svcCtx.FormValue("NewKey"))
+	}
+	return err
+}
+
+func init() {
+	RegisterDataCommand(
+		&DataCommand{Name: DEL, RequireKey: true, Writes: true, Permitted: allowCommon(redisdb.Del),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return boolResult(svcCtx.RdsClient.Del(svcCtx.Ctx, svcCtx.Key).Err())
+			},
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.Del(svcCtx.Ctx, svcCtx.Key).Result), nil
+			}},
+		&DataCommand{Name: UNLINK, RequireKey: true, Writes: true, Permitted: allowCommon(redisdb.Del),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return boolResult(svcCtx.RdsClient.Unlink(svcCtx.Ctx, svcCtx.Key).Err())
+			}},
+		&DataCommand{Name: TOUCH, RequireKey: true, Permitted: allowCommon(redisdb.Exists),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return svcCtx.RdsClient.Touch(svcCtx.Ctx, svcCtx.Key).Result()
+			}},
+		&DataCommand{Name: EXISTS, RequireKey: true, Permitted: allowCommon(redisdb.Exists),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return svcCtx.RdsClient.Exists(svcCtx.Ctx, svcCtx.Key).Result()
+			},
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.Exists(svcCtx.Ctx, svcCtx.Key).Result), nil
+			}},
+		&DataCommand{Name: TYPE, RequireKey: true, Permitted: allowCommon(redisdb.Type),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return svcCtx.RdsClient.Type(svcCtx.Ctx, svcCtx.Key).Result()
+			}},
+		&DataCommand{Name: EXPIRE, RequireKey: true, Writes: true, Permitted: allowCommon(redisdb.Expire),
+			Params: []DataCmdParam{{"Seconds", ParamInt, true}},
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return boolResult(svcCtx.RdsClient.Expire(svcCtx.Ctx, svcCtx.Key, time.Duration(svcCtx.FormInt("Seconds"))*time.Second).Err())
+			},
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.Expire(svcCtx.Ctx, svcCtx.Key, time.Duration(svcCtx.FormInt("Seconds"))*time.Second).Result), nil
+			}},
+		&DataCommand{Name: EXPIREAT, RequireKey: true, Writes: true, Permitted: allowCommon(redisdb.Expire),
+			Params: []DataCmdParam{{"Timestamp", ParamInt, true}},
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return boolResult(svcCtx.RdsClient.ExpireAt(svcCtx.Ctx, svcCtx.Key, time.Unix(svcCtx.FormInt("Timestamp"), 0)).Err())
+			},
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.ExpireAt(svcCtx.Ctx, svcCtx.Key, time.Unix(svcCtx.FormInt("Timestamp"), 0)).Result), nil
+			}},
+		&DataCommand{Name: PERSIST, RequireKey: true, Writes: true, Permitted: allowCommon(redisdb.Persist),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return boolResult(svcCtx.RdsClient.Persist(svcCtx.Ctx, svcCtx.Key).Err())
+			},
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.Persist(svcCtx.Ctx, svcCtx.Key).Result), nil
+			}},
+		&DataCommand{Name: TTL, RequireKey: true, Permitted: allowCommon(redisdb.TTL),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return svcCtx.RdsClient.TTL(svcCtx.Ctx, svcCtx.Key).Result()
+			},
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.TTL(svcCtx.Ctx, svcCtx.Key).Result), nil
+			}},
+		&DataCommand{Name: PTTL, RequireKey: true, Permitted: allowCommon(redisdb.TTL),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return svcCtx.RdsClient.PTTL(svcCtx.Ctx, svcCtx.Key).Result()
+			}},
+		&DataCommand{Name: RENAME, RequireKey: true, Writes: true, Permitted: allowCommon(redisdb.Rename), Params: newKeyParams,
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				err := svcCtx.RdsClient.Rename(svcCtx.Ctx, svcCtx.Key, svcCtx.FormValue("NewKey")).Err()
+				return boolResult(publishNewKey(svcCtx, err == nil, err))
+			}},
+		&DataCommand{Name: RENAMEX, RequireKey: true, Writes: true, Permitted: allowCommon(redisdb.Rename), Params: newKeyParams,
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				renamed, err := svcCtx.RdsClient.RenameNX(svcCtx.Ctx, svcCtx.Key, svcCtx.FormValue("NewKey")).Result()
+				return boolResult(publishNewKey(svcCtx, renamed, err))
+			}},
+		&DataCommand{Name: TIME, Permitted: allowDB(redisdb.DBTime),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				tm, err := svcCtx.RdsClient.Time(svcCtx.Ctx).Result()
+				if err != nil {
+					return nil, err
+				}
+				return tm.UnixMilli(), nil
+			}},
+		// the key of KEYS is the pattern
+		&DataCommand{Name: KEYS, RequireKey: true, Permitted: allowDB(redisdb.DBKeys),
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				return svcCtx.RdsClient.Keys(svcCtx.Ctx, svcCtx.Key).Result()
+			}},
+		&DataCommand{Name: "SEARCH", RequireKey: true,
+			Permitted: func(svcCtx *DoptimeReqCtx) bool { return redisdb.IsAllowedVectorSetOp(svcCtx.Key, redisdb.FtSearch) },
+			Params:    []DataCmdParam{{"Q", ParamString, false}},
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				vectorKey, err := redisdb.GetHttpVectorSetKey(svcCtx.Key, svcCtx.RedisDataSource)
+				if err != nil {
+					return nil, err
+				}
+				count, docs, err := vectorKey.Search(svcCtx.FormValue("Q"))
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"count": count, "docs": docs}, nil
+			}},
+	)
+}
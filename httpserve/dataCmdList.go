@@ -0,0 +1,134 @@
+package httpserve
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/doptime/doptime/vars"
+	"github.com/doptime/redisdb"
+	"github.com/redis/go-redis/v9"
+)
+
+func allowList(op redisdb.ListOp) func(svcCtx *DoptimeReqCtx) bool {
+	return func(svcCtx *DoptimeReqCtx) bool { return redisdb.IsAllowedListOp(svcCtx.Key, op) }
+}
+
+// withListKey runs f with the typed list key of svcCtx.Key
+func withListKey(f func(svcCtx *DoptimeReqCtx, lKey redisdb.IHttpListKey) (interface{}, error)) HandlerFunc {
+	return func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+		lKey, err := redisdb.GetHttpListKey(svcCtx.Key, svcCtx.RedisDataSource)
+		if err != nil {
+			return nil, err
+		}
+		return f(svcCtx, lKey)
+	}
+}
+
+// queueListPush is listPush of batch requests, push is pipe.LPush or pipe.RPush
+func queueListPush(push func(pipe redis.Pipeliner, ctx context.Context, key string, values ...interface{}) *redis.IntCmd) QueueFunc {
+	return queueWithKey(redisdb.GetHttpListKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, lKey redisdb.IHttpListKey) (QueuedReply, error) {
+		valStr, err := svcCtx.storedValue(lKey)
+		if err != nil {
+			return nil, err
+		}
+		return replyOf(push(pipe, svcCtx.Ctx, svcCtx.Key, valStr).Result), nil
+	})
+}
+
+// listPush converts the body to the value type of the list key, then pushes it
+func listPush(push func(lKey redisdb.IHttpListKey, value interface{}) error) HandlerFunc {
+	return withListKey(func(svcCtx *DoptimeReqCtx, lKey redisdb.IHttpListKey) (interface{}, error) {
+		value, err := svcCtx.ToValue(lKey, svcCtx.Body())
+		if err != nil {
+			return nil, err
+		}
+		return boolResult(push(lKey, value))
+	})
+}
+
+var rangeParams = []DataCmdParam{{"Start", ParamInt, true}, {"Stop", ParamInt, true}}
+
+func init() {
+	RegisterDataCommand(
+		&DataCommand{Name: LLEN, RequireKey: true, Permitted: allowList(redisdb.LLen),
+			Execute: withListKey(func(svcCtx *DoptimeReqCtx, lKey redisdb.IHttpListKey) (interface{}, error) {
+				return lKey.LLen()
+			}),
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.LLen(svcCtx.Ctx, svcCtx.Key).Result), nil
+			}},
+		&DataCommand{Name: LRANGE, RequireKey: true, Permitted: allowList(redisdb.LRange), Params: rangeParams,
+			Execute: withListKey(func(svcCtx *DoptimeReqCtx, lKey redisdb.IHttpListKey) (interface{}, error) {
+				return lKey.LRange(svcCtx.FormInt("Start"), svcCtx.FormInt("Stop"))
+			}),
+			Queue: queueWithKey(redisdb.GetHttpListKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, lKey redisdb.IHttpListKey) (QueuedReply, error) {
+				return replyValues(lKey, pipe.LRange(svcCtx.Ctx, svcCtx.Key, svcCtx.FormInt("Start"), svcCtx.FormInt("Stop")), deserializeValues), nil
+			})},
+		&DataCommand{Name: LINDEX, RequireKey: true, Permitted: allowList(redisdb.LIndex),
+			Params: []DataCmdParam{{"Index", ParamInt, true}},
+			Execute: withListKey(func(svcCtx *DoptimeReqCtx, lKey redisdb.IHttpListKey) (interface{}, error) {
+				return lKey.LIndex(svcCtx.FormInt("Index"))
+			})},
+		&DataCommand{Name: LPOP, RequireKey: true, Writes: true, Permitted: allowList(redisdb.LPop),
+			Execute: withListKey(func(svcCtx *DoptimeReqCtx, lKey redisdb.IHttpListKey) (interface{}, error) {
+				return lKey.LPop()
+			}),
+			Queue: queueWithKey(redisdb.GetHttpListKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, lKey redisdb.IHttpListKey) (QueuedReply, error) {
+				return replyValue(lKey, pipe.LPop(svcCtx.Ctx, svcCtx.Key)), nil
+			})},
+		&DataCommand{Name: RPOP, RequireKey: true, Writes: true, Permitted: allowList(redisdb.RPop),
+			Execute: withListKey(func(svcCtx *DoptimeReqCtx, lKey redisdb.IHttpListKey) (interface{}, error) {
+				return lKey.RPop()
+			}),
+			Queue: queueWithKey(redisdb.GetHttpListKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, lKey redisdb.IHttpListKey) (QueuedReply, error) {
+				return replyValue(lKey, pipe.RPop(svcCtx.Ctx, svcCtx.Key)), nil
+			})},
+		&DataCommand{Name: LPUSH, RequireKey: true, Writes: true, Permitted: allowList(redisdb.LPush),
+			Execute: listPush(func(lKey redisdb.IHttpListKey, value interface{}) error { return lKey.LPush(value) }),
+			Queue:   queueListPush(redis.Pipeliner.LPush)},
+		&DataCommand{Name: RPUSH, RequireKey: true, Writes: true, Permitted: allowList(redisdb.RPush),
+			Execute: listPush(func(lKey redisdb.IHttpListKey, value interface{}) error { return lKey.RPush(value) }),
+			Queue:   queueListPush(redis.Pipeliner.RPush)},
+		&DataCommand{Name: LPUSHX, RequireKey: true, Writes: true, Permitted: allowList(redisdb.LPushX),
+			Execute: listPush(func(lKey redisdb.IHttpListKey, value interface{}) error { return lKey.LPushX(value) })},
+		&DataCommand{Name: RPUSHX, RequireKey: true, Writes: true, Permitted: allowList(redisdb.RPushX),
+			Execute: listPush(func(lKey redisdb.IHttpListKey, value interface{}) error { return lKey.RPushX(value) })},
+		&DataCommand{Name: LREM, RequireKey: true, Writes: true, Permitted: allowList(redisdb.LRem),
+			Params: []DataCmdParam{{"Count", ParamInt, true}},
+			Execute: withListKey(func(svcCtx *DoptimeReqCtx, lKey redisdb.IHttpListKey) (interface{}, error) {
+				value, err := svcCtx.ToValue(lKey, svcCtx.Body())
+				if err != nil {
+					return nil, err
+				}
+				return boolResult(lKey.LRem(svcCtx.FormInt("Count"), value))
+			})},
+		&DataCommand{Name: LSET, RequireKey: true, Writes: true, Permitted: allowList(redisdb.LSet),
+			Params: []DataCmdParam{{"Index", ParamInt, true}},
+			Execute: withListKey(func(svcCtx *DoptimeReqCtx, lKey redisdb.IHttpListKey) (interface{}, error) {
+				value, err := svcCtx.ToValue(lKey, svcCtx.Body())
+				if err != nil {
+					return nil, err
+				}
+				return boolResult(lKey.LSet(svcCtx.FormInt("Index"), value))
+			})},
+		// LINSERT puts the body before or after the first element equal to Pivot. Pivot is in the stored format of the value
+		&DataCommand{Name: LINSERT, RequireKey: true, Writes: true, Permitted: allowList(redisdb.LPush | redisdb.RPush),
+			Params: []DataCmdParam{{"Position", ParamString, true}, {"Pivot", ParamString, true}},
+			Execute: withListKey(func(svcCtx *DoptimeReqCtx, lKey redisdb.IHttpListKey) (interface{}, error) {
+				position := strings.ToUpper(svcCtx.FormValue("Position"))
+				if position != "BEFORE" && position != "AFTER" {
+					return nil, fmt.Errorf("%w: Position should be BEFORE or AFTER", vars.ErrParm)
+				}
+				valStr, err := svcCtx.storedValue(lKey)
+				if err != nil {
+					return nil, err
+				}
+				return svcCtx.RdsClient.LInsert(svcCtx.Ctx, svcCtx.Key, position, svcCtx.FormValue("Pivot"), valStr).Result()
+			})},
+		&DataCommand{Name: LTRIM, RequireKey: true, Writes: true, Permitted: allowList(redisdb.LTrim), Params: rangeParams,
+			Execute: withListKey(func(svcCtx *DoptimeReqCtx, lKey redisdb.IHttpListKey) (interface{}, error) {
+				return boolResult(lKey.LTrim(svcCtx.FormInt("Start"), svcCtx.FormInt("Stop")))
+			})},
+	)
+}
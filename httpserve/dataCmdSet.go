@@ -0,0 +1,146 @@
+package httpserve
+
+import (
+	"strings"
+
+	"github.com/doptime/redisdb"
+	"github.com/redis/go-redis/v9"
+)
+
+func allowSet(op redisdb.SetOp) func(svcCtx *DoptimeReqCtx) bool {
+	return func(svcCtx *DoptimeReqCtx) bool { return redisdb.IsAllowedSetOp(svcCtx.Key, op) }
+}
+
+// withSetKey runs f with the typed set key of svcCtx.Key
+func withSetKey(f func(svcCtx *DoptimeReqCtx, skey redisdb.IHttpSetKey) (interface{}, error)) HandlerFunc {
+	return func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+		skey, err := redisdb.GetHttpSetKey(svcCtx.Key, svcCtx.RedisDataSource)
+		if err != nil {
+			return nil, err
+		}
+		return f(svcCtx, skey)
+	}
+}
+
+// setKeys are svcCtx.Key and the keys in Keys of SINTER, SUNION & SDIFF, with @tag replaced
+func setKeys(svcCtx *DoptimeReqCtx) (keys []string, err error) {
+	keys = []string{svcCtx.Key}
+	for _, key := range strings.Split(svcCtx.FormValue("Keys"), ",") {
+		if key = strings.TrimSpace(key); key == "" {
+			continue
+		} else if key, err = svcCtx.replaceTags(key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// allowSetsRead checks SMembers permission of all the keys
+func allowSetsRead(svcCtx *DoptimeReqCtx) bool {
+	keys, err := setKeys(svcCtx)
+	if err != nil {
+		return false
+	}
+	for _, key := range keys {
+		if !redisdb.IsAllowedSetOp(key, redisdb.SMembers) {
+			return false
+		}
+	}
+	return true
+}
+
+// setsOp runs SINTER, SUNION or SDIFF, the members are converted to the value type of svcCtx.Key
+func setsOp(op func(svcCtx *DoptimeReqCtx, keys []string) ([]string, error)) HandlerFunc {
+	return withSetKey(func(svcCtx *DoptimeReqCtx, skey redisdb.IHttpSetKey) (interface{}, error) {
+		keys, err := setKeys(svcCtx)
+		if err != nil {
+			return nil, err
+		}
+		members, err := op(svcCtx, keys)
+		if err != nil {
+			return nil, err
+		}
+		return deserializeValues(skey, members)
+	})
+}
+
+var setsParams = []DataCmdParam{{"Keys", ParamString, true}}
+
+func init() {
+	RegisterDataCommand(
+		&DataCommand{Name: SCARD, RequireKey: true, Permitted: allowSet(redisdb.SCard),
+			Execute: withSetKey(func(svcCtx *DoptimeReqCtx, skey redisdb.IHttpSetKey) (interface{}, error) {
+				return skey.SCard()
+			}),
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.SCard(svcCtx.Ctx, svcCtx.Key).Result), nil
+			}},
+		&DataCommand{Name: SISMEMBER, RequireKey: true, Permitted: allowSet(redisdb.SIsMember),
+			Params: []DataCmdParam{{"Member", ParamString, false}},
+			Execute: withSetKey(func(svcCtx *DoptimeReqCtx, skey redisdb.IHttpSetKey) (interface{}, error) {
+				return skey.SIsMember(svcCtx.FormValue("Member"))
+			}),
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.SIsMember(svcCtx.Ctx, svcCtx.Key, svcCtx.FormValue("Member")).Result), nil
+			}},
+		&DataCommand{Name: SMEMBERS, RequireKey: true, Permitted: allowSet(redisdb.SMembers),
+			Execute: withSetKey(func(svcCtx *DoptimeReqCtx, skey redisdb.IHttpSetKey) (interface{}, error) {
+				return skey.SMembers()
+			}),
+			Queue: queueWithKey(redisdb.GetHttpSetKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, skey redisdb.IHttpSetKey) (QueuedReply, error) {
+				return replyValues(skey, pipe.SMembers(svcCtx.Ctx, svcCtx.Key), deserializeValues), nil
+			})},
+		&DataCommand{Name: SADD, RequireKey: true, Writes: true, Permitted: allowSet(redisdb.SAdd),
+			Execute: withSetKey(func(svcCtx *DoptimeReqCtx, skey redisdb.IHttpSetKey) (interface{}, error) {
+				member, err := svcCtx.ToValue(skey, svcCtx.Body())
+				if err != nil {
+					return nil, err
+				}
+				return boolResult(skey.SAdd(member))
+			}),
+			Queue: queueWithKey(redisdb.GetHttpSetKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, skey redisdb.IHttpSetKey) (QueuedReply, error) {
+				valStr, err := svcCtx.storedValue(skey)
+				if err != nil {
+					return nil, err
+				}
+				return replyOf(pipe.SAdd(svcCtx.Ctx, svcCtx.Key, valStr).Result), nil
+			})},
+		&DataCommand{Name: SREM, RequireKey: true, Writes: true, Permitted: allowSet(redisdb.SRem),
+			Execute: withSetKey(func(svcCtx *DoptimeReqCtx, skey redisdb.IHttpSetKey) (interface{}, error) {
+				member, err := svcCtx.ToValue(skey, svcCtx.Body())
+				if err != nil {
+					return nil, err
+				}
+				return boolResult(skey.SRem(member))
+			}),
+			Queue: queueWithKey(redisdb.GetHttpSetKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, skey redisdb.IHttpSetKey) (QueuedReply, error) {
+				valStr, err := svcCtx.storedValue(skey)
+				if err != nil {
+					return nil, err
+				}
+				return replyOf(pipe.SRem(svcCtx.Ctx, svcCtx.Key, valStr).Result), nil
+			})},
+		// SINTER-Key?Keys=KeyB,KeyC, the same for SUNION & SDIFF
+		&DataCommand{Name: SINTER, RequireKey: true, Permitted: allowSetsRead, Params: setsParams,
+			Execute: setsOp(func(svcCtx *DoptimeReqCtx, keys []string) ([]string, error) {
+				return svcCtx.RdsClient.SInter(svcCtx.Ctx, keys...).Result()
+			})},
+		&DataCommand{Name: SUNION, RequireKey: true, Permitted: allowSetsRead, Params: setsParams,
+			Execute: setsOp(func(svcCtx *DoptimeReqCtx, keys []string) ([]string, error) {
+				return svcCtx.RdsClient.SUnion(svcCtx.Ctx, keys...).Result()
+			})},
+		&DataCommand{Name: SDIFF, RequireKey: true, Permitted: allowSetsRead, Params: setsParams,
+			Execute: setsOp(func(svcCtx *DoptimeReqCtx, keys []string) ([]string, error) {
+				return svcCtx.RdsClient.SDiff(svcCtx.Ctx, keys...).Result()
+			})},
+		&DataCommand{Name: SSCAN, RequireKey: true, Permitted: allowSet(redisdb.SScan), Params: scanParams,
+			Execute: withSetKey(func(svcCtx *DoptimeReqCtx, skey redisdb.IHttpSetKey) (interface{}, error) {
+				values, cursor, err := skey.SScan(svcCtx.FormUint("Cursor"), svcCtx.FormValue("Match"), svcCtx.FormInt("Count"))
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"values": values, "cursor": cursor}, nil
+			})},
+	)
+}
@@ -0,0 +1,95 @@
+package httpserve
+
+import (
+	"fmt"
+
+	"github.com/doptime/doptime/vars"
+	"github.com/doptime/redisdb"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func allowStream(op redisdb.StreamOp) func(svcCtx *DoptimeReqCtx) bool {
+	return func(svcCtx *DoptimeReqCtx) bool { return redisdb.IsAllowedStreamOp(svcCtx.Key, op) }
+}
+
+// withStreamKey runs f with the typed stream key of svcCtx.Key
+func withStreamKey(f func(svcCtx *DoptimeReqCtx, streamKey redisdb.IHttpStreamKey) (interface{}, error)) HandlerFunc {
+	return func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+		streamKey, err := redisdb.GetHttpStreamKey(svcCtx.Key, svcCtx.RedisDataSource)
+		if err != nil {
+			return nil, err
+		}
+		return f(svcCtx, streamKey)
+	}
+}
+
+var (
+	xrangeParams  = []DataCmdParam{{"Start", ParamString, true}, {"Stop", ParamString, true}}
+	xrangeNParams = append(xrangeParams, DataCmdParam{"Count", ParamInt, true})
+	xidParams     = []DataCmdParam{{"ID", ParamString, true}}
+)
+
+// xrangeCount is the Count of XRANGEN & XREVRANGEN, 0 (no limit) for XRANGE & XREVRANGE
+func xrangeCount(svcCtx *DoptimeReqCtx) int64 {
+	if svcCtx.Cmd == XRANGEN || svcCtx.Cmd == XREVRANGEN {
+		return svcCtx.FormInt("Count")
+	}
+	return 0
+}
+
+func init() {
+	xrange := withStreamKey(func(svcCtx *DoptimeReqCtx, streamKey redisdb.IHttpStreamKey) (interface{}, error) {
+		return streamKey.XRange(svcCtx.FormValue("Start"), svcCtx.FormValue("Stop"), xrangeCount(svcCtx))
+	})
+	xrevrange := withStreamKey(func(svcCtx *DoptimeReqCtx, streamKey redisdb.IHttpStreamKey) (interface{}, error) {
+		return streamKey.XRevRange(svcCtx.FormValue("Start"), svcCtx.FormValue("Stop"), xrangeCount(svcCtx))
+	})
+	queueXRange := func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+		if count := xrangeCount(svcCtx); count > 0 {
+			return replyOf(pipe.XRangeN(svcCtx.Ctx, svcCtx.Key, svcCtx.FormValue("Start"), svcCtx.FormValue("Stop"), count).Result), nil
+		}
+		return replyOf(pipe.XRange(svcCtx.Ctx, svcCtx.Key, svcCtx.FormValue("Start"), svcCtx.FormValue("Stop")).Result), nil
+	}
+	queueXRevRange := func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+		if count := xrangeCount(svcCtx); count > 0 {
+			return replyOf(pipe.XRevRangeN(svcCtx.Ctx, svcCtx.Key, svcCtx.FormValue("Start"), svcCtx.FormValue("Stop"), count).Result), nil
+		}
+		return replyOf(pipe.XRevRange(svcCtx.Ctx, svcCtx.Key, svcCtx.FormValue("Start"), svcCtx.FormValue("Stop")).Result), nil
+	}
+	RegisterDataCommand(
+		&DataCommand{Name: XLEN, RequireKey: true, Permitted: allowStream(redisdb.XLen),
+			Execute: withStreamKey(func(svcCtx *DoptimeReqCtx, streamKey redisdb.IHttpStreamKey) (interface{}, error) {
+				return streamKey.XLen()
+			}),
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.XLen(svcCtx.Ctx, svcCtx.Key).Result), nil
+			}},
+		&DataCommand{Name: XRANGE, RequireKey: true, Permitted: allowStream(redisdb.XRange), Params: xrangeParams, Execute: xrange, Queue: queueXRange},
+		&DataCommand{Name: XRANGEN, RequireKey: true, Permitted: allowStream(redisdb.XRange), Params: xrangeNParams, Execute: xrange, Queue: queueXRange},
+		&DataCommand{Name: XREVRANGE, RequireKey: true, Permitted: allowStream(redisdb.XRange), Params: xrangeParams, Execute: xrevrange, Queue: queueXRevRange},
+		&DataCommand{Name: XREVRANGEN, RequireKey: true, Permitted: allowStream(redisdb.XRange), Params: xrangeNParams, Execute: xrevrange, Queue: queueXRevRange},
+		&DataCommand{Name: XREAD, RequireKey: true, Permitted: allowStream(redisdb.XRead),
+			Params: []DataCmdParam{{"Count", ParamInt, true}, {"Block", ParamDuration, true}, {"ID", ParamString, false}},
+			Execute: withStreamKey(func(svcCtx *DoptimeReqCtx, streamKey redisdb.IHttpStreamKey) (interface{}, error) {
+				return streamKey.XRead([]string{svcCtx.Key, svcCtx.FormValue("ID")}, svcCtx.FormInt("Count"), svcCtx.FormDuration("Block"))
+			})},
+		&DataCommand{Name: XADD, RequireKey: true, Writes: true, Permitted: allowStream(redisdb.XAdd), Params: xidParams,
+			Execute: withStreamKey(func(svcCtx *DoptimeReqCtx, streamKey redisdb.IHttpStreamKey) (interface{}, error) {
+				_, err := streamKey.XAdd(svcCtx.FormValue("ID"), svcCtx.Body())
+				return boolResult(err)
+			}),
+			// the body of XADD in batch is the msgpack map of the entry fields
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				values := map[string]interface{}{}
+				if err := msgpack.Unmarshal(svcCtx.Body(), &values); err != nil {
+					return nil, fmt.Errorf("%w: body of XADD should be a map: %v", vars.ErrInvalidInput, err)
+				}
+				return replyOf(pipe.XAdd(svcCtx.Ctx, &redis.XAddArgs{Stream: svcCtx.Key, ID: svcCtx.FormValue("ID"), Values: values}).Result), nil
+			}},
+		&DataCommand{Name: XDEL, RequireKey: true, Writes: true, Permitted: allowStream(redisdb.XDel), Params: xidParams,
+			Execute: withStreamKey(func(svcCtx *DoptimeReqCtx, streamKey redisdb.IHttpStreamKey) (interface{}, error) {
+				return boolResult(streamKey.XDel(svcCtx.FormValue("ID")))
+			})},
+	)
+}
@@ -0,0 +1,236 @@
+package httpserve
+
+import (
+	"errors"
+	"time"
+
+	"github.com/doptime/redisdb"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func allowString(op redisdb.StringOp) func(svcCtx *DoptimeReqCtx) bool {
+	return func(svcCtx *DoptimeReqCtx) bool { return redisdb.IsAllowedStringOp(svcCtx.Key, op) }
+}
+
+// withStringKey runs f with the typed string key of svcCtx.Key
+func withStringKey(f func(svcCtx *DoptimeReqCtx, strKey redisdb.IHttpStringKey) (interface{}, error)) HandlerFunc {
+	return func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+		strKey, err := redisdb.GetHttpStringKey(svcCtx.Key, svcCtx.RedisDataSource)
+		if err != nil {
+			return nil, err
+		}
+		return f(svcCtx, strKey)
+	}
+}
+
+// stringKeyName is the redis key of the field of string key, the same as redisdb.StringKey.Get
+func stringKeyName(key, field string) string {
+	if len(field) == 0 {
+		return key
+	}
+	return key + ":" + field
+}
+
+// rawString runs the command on the redis key of svcCtx.Key & svcCtx.Field(). the value is not converted, i.g. INCR, GETRANGE
+func rawString(f func(svcCtx *DoptimeReqCtx, name string) (interface{}, error)) HandlerFunc {
+	return func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+		return f(svcCtx, stringKeyName(svcCtx.Key, svcCtx.Field()))
+	}
+}
+
+// queueRawString is rawString of batch requests
+func queueRawString(f func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, name string) QueuedReply) QueueFunc {
+	return func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+		return f(svcCtx, pipe, stringKeyName(svcCtx.Key, svcCtx.Field())), nil
+	}
+}
+
+var (
+	incrParams      = []DataCmdParam{{"Incr", ParamInt, true}}
+	offsetParams    = []DataCmdParam{{"Offset", ParamInt, true}}
+	byteRangeParams = []DataCmdParam{{"Start", ParamInt, true}, {"End", ParamInt, true}}
+)
+
+func init() {
+	RegisterDataCommand(
+		&DataCommand{Name: GET, RequireKey: true, Permitted: allowString(redisdb.Get),
+			Execute: withStringKey(func(svcCtx *DoptimeReqCtx, strKey redisdb.IHttpStringKey) (interface{}, error) {
+				return strKey.Get(svcCtx.Field())
+			}),
+			Queue: queueWithKey(redisdb.GetHttpStringKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, strKey redisdb.IHttpStringKey) (QueuedReply, error) {
+				return replyValue(strKey, pipe.Get(svcCtx.Ctx, stringKeyName(svcCtx.Key, svcCtx.Field()))), nil
+			})},
+		&DataCommand{Name: SET, RequireKey: true, Writes: true, Permitted: allowString(redisdb.Set),
+			Execute: withStringKey(func(svcCtx *DoptimeReqCtx, strKey redisdb.IHttpStringKey) (interface{}, error) {
+				value, err := svcCtx.ToValue(strKey, svcCtx.Body())
+				if err != nil {
+					return nil, err
+				}
+				return boolResult(strKey.Set(svcCtx.Field(), value, 0))
+			}),
+			Queue: queueWithKey(redisdb.GetHttpStringKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, strKey redisdb.IHttpStringKey) (QueuedReply, error) {
+				valStr, err := svcCtx.storedValue(strKey)
+				if err != nil {
+					return nil, err
+				}
+				return replyOf(pipe.Set(svcCtx.Ctx, stringKeyName(svcCtx.Key, svcCtx.Field()), valStr, 0).Result), nil
+			})},
+		&DataCommand{Name: SETEX, RequireKey: true, Writes: true, Permitted: allowString(redisdb.Set),
+			Params: []DataCmdParam{{"Seconds", ParamInt, true}},
+			Execute: withStringKey(func(svcCtx *DoptimeReqCtx, strKey redisdb.IHttpStringKey) (interface{}, error) {
+				value, err := svcCtx.ToValue(strKey, svcCtx.Body())
+				if err != nil {
+					return nil, err
+				}
+				return boolResult(strKey.Set(svcCtx.Field(), value, time.Duration(svcCtx.FormInt("Seconds"))*time.Second))
+			}),
+			Queue: queueWithKey(redisdb.GetHttpStringKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, strKey redisdb.IHttpStringKey) (QueuedReply, error) {
+				valStr, err := svcCtx.storedValue(strKey)
+				if err != nil {
+					return nil, err
+				}
+				return replyOf(pipe.Set(svcCtx.Ctx, stringKeyName(svcCtx.Key, svcCtx.Field()), valStr, time.Duration(svcCtx.FormInt("Seconds"))*time.Second).Result), nil
+			})},
+		&DataCommand{Name: SETNX, RequireKey: true, Writes: true, Permitted: allowString(redisdb.Set),
+			Execute: withStringKey(func(svcCtx *DoptimeReqCtx, strKey redisdb.IHttpStringKey) (interface{}, error) {
+				valStr, err := svcCtx.storedValue(strKey)
+				if err != nil {
+					return nil, err
+				}
+				return svcCtx.RdsClient.SetNX(svcCtx.Ctx, stringKeyName(svcCtx.Key, svcCtx.Field()), valStr, 0).Result()
+			}),
+			Queue: queueWithKey(redisdb.GetHttpStringKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, strKey redisdb.IHttpStringKey) (QueuedReply, error) {
+				valStr, err := svcCtx.storedValue(strKey)
+				if err != nil {
+					return nil, err
+				}
+				return replyOf(pipe.SetNX(svcCtx.Ctx, stringKeyName(svcCtx.Key, svcCtx.Field()), valStr, 0).Result), nil
+			})},
+		// MGET-Key?f=a&f=b reads Key:a & Key:b
+		&DataCommand{Name: MGET, RequireKey: true, RequireField: true, Permitted: allowString(redisdb.Get),
+			Execute: withStringKey(func(svcCtx *DoptimeReqCtx, strKey redisdb.IHttpStringKey) (interface{}, error) {
+				names := make([]string, len(svcCtx.Fields))
+				for i, field := range svcCtx.Fields {
+					names[i] = stringKeyName(svcCtx.Key, field)
+				}
+				vals, err := svcCtx.RdsClient.MGet(svcCtx.Ctx, names...).Result()
+				if err != nil {
+					return nil, err
+				}
+				values := make([]interface{}, len(vals))
+				for i, val := range vals {
+					if valStr, ok := val.(string); ok {
+						if values[i], err = deserializeValue(strKey, valStr); err != nil {
+							return nil, err
+						}
+					}
+				}
+				return values, nil
+			})},
+		// MSET-Key?f=a&f=b writes Key:a & Key:b, the body is msgpack array of the values
+		&DataCommand{Name: MSET, RequireKey: true, RequireField: true, Writes: true, Permitted: allowString(redisdb.Set),
+			Execute: withStringKey(func(svcCtx *DoptimeReqCtx, strKey redisdb.IHttpStringKey) (interface{}, error) {
+				var (
+					valuesInMsgpack = []string{}
+					values          []interface{}
+					err             error
+				)
+				if err = msgpack.Unmarshal(svcCtx.Body(), &valuesInMsgpack); err != nil {
+					return nil, err
+				} else if len(valuesInMsgpack) != len(svcCtx.Fields) {
+					return nil, errors.New("fields count mismatch")
+				} else if values, err = svcCtx.ToValues(strKey, valuesInMsgpack); err != nil {
+					return nil, err
+				}
+				pairs := make([]interface{}, 0, len(values)*2)
+				for i, field := range svcCtx.Fields {
+					valStr, err := storedOf(strKey, values[i])
+					if err != nil {
+						return nil, err
+					}
+					pairs = append(pairs, stringKeyName(svcCtx.Key, field), valStr)
+				}
+				return boolResult(svcCtx.RdsClient.MSet(svcCtx.Ctx, pairs...).Err())
+			})},
+		&DataCommand{Name: STRLEN, RequireKey: true, Permitted: allowString(redisdb.Get),
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				return svcCtx.RdsClient.StrLen(svcCtx.Ctx, name).Result()
+			}),
+			Queue: queueRawString(func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, name string) QueuedReply {
+				return replyOf(pipe.StrLen(svcCtx.Ctx, name).Result)
+			})},
+		&DataCommand{Name: INCR, RequireKey: true, Writes: true, Permitted: allowString(redisdb.Set),
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				return svcCtx.RdsClient.Incr(svcCtx.Ctx, name).Result()
+			}),
+			Queue: queueRawString(func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, name string) QueuedReply {
+				return replyOf(pipe.Incr(svcCtx.Ctx, name).Result)
+			})},
+		&DataCommand{Name: DECR, RequireKey: true, Writes: true, Permitted: allowString(redisdb.Set),
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				return svcCtx.RdsClient.Decr(svcCtx.Ctx, name).Result()
+			}),
+			Queue: queueRawString(func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, name string) QueuedReply {
+				return replyOf(pipe.Decr(svcCtx.Ctx, name).Result)
+			})},
+		&DataCommand{Name: INCRBY, RequireKey: true, Writes: true, Permitted: allowString(redisdb.Set), Params: incrParams,
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				return svcCtx.RdsClient.IncrBy(svcCtx.Ctx, name, svcCtx.FormInt("Incr")).Result()
+			}),
+			Queue: queueRawString(func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, name string) QueuedReply {
+				return replyOf(pipe.IncrBy(svcCtx.Ctx, name, svcCtx.FormInt("Incr")).Result)
+			})},
+		&DataCommand{Name: DECRBY, RequireKey: true, Writes: true, Permitted: allowString(redisdb.Set), Params: incrParams,
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				return svcCtx.RdsClient.DecrBy(svcCtx.Ctx, name, svcCtx.FormInt("Incr")).Result()
+			}),
+			Queue: queueRawString(func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, name string) QueuedReply {
+				return replyOf(pipe.DecrBy(svcCtx.Ctx, name, svcCtx.FormInt("Incr")).Result)
+			})},
+		&DataCommand{Name: INCRBYFLOAT, RequireKey: true, Writes: true, Permitted: allowString(redisdb.Set),
+			Params: []DataCmdParam{{"Incr", ParamFloat, true}},
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				return svcCtx.RdsClient.IncrByFloat(svcCtx.Ctx, name, svcCtx.FormFloat("Incr")).Result()
+			}),
+			Queue: queueRawString(func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, name string) QueuedReply {
+				return replyOf(pipe.IncrByFloat(svcCtx.Ctx, name, svcCtx.FormFloat("Incr")).Result)
+			})},
+		&DataCommand{Name: APPEND, RequireKey: true, Writes: true, Permitted: allowString(redisdb.Set),
+			Params: []DataCmdParam{{"Value", ParamString, true}},
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				return svcCtx.RdsClient.Append(svcCtx.Ctx, name, svcCtx.FormValue("Value")).Result()
+			})},
+		&DataCommand{Name: GETRANGE, RequireKey: true, Permitted: allowString(redisdb.Get), Params: byteRangeParams,
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				return svcCtx.RdsClient.GetRange(svcCtx.Ctx, name, svcCtx.FormInt("Start"), svcCtx.FormInt("End")).Result()
+			})},
+		&DataCommand{Name: SETRANGE, RequireKey: true, Writes: true, Permitted: allowString(redisdb.Set),
+			Params: []DataCmdParam{{"Offset", ParamInt, true}, {"Value", ParamString, true}},
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				return svcCtx.RdsClient.SetRange(svcCtx.Ctx, name, svcCtx.FormInt("Offset"), svcCtx.FormValue("Value")).Result()
+			})},
+		&DataCommand{Name: GETBIT, RequireKey: true, Permitted: allowString(redisdb.Get), Params: offsetParams,
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				return svcCtx.RdsClient.GetBit(svcCtx.Ctx, name, svcCtx.FormInt("Offset")).Result()
+			})},
+		&DataCommand{Name: SETBIT, RequireKey: true, Writes: true, Permitted: allowString(redisdb.Set),
+			Params: append(offsetParams, DataCmdParam{"Value", ParamInt, true}),
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				if bit := svcCtx.FormInt("Value"); bit != 0 && bit != 1 {
+					return nil, errors.New("bit value should be 0 or 1")
+				}
+				return svcCtx.RdsClient.SetBit(svcCtx.Ctx, name, svcCtx.FormInt("Offset"), int(svcCtx.FormInt("Value"))).Result()
+			})},
+		// BITCOUNT counts the whole string, unless both Start & End are given
+		&DataCommand{Name: BITCOUNT, RequireKey: true, Permitted: allowString(redisdb.Get),
+			Params: []DataCmdParam{{"Start", ParamInt, false}, {"End", ParamInt, false}},
+			Execute: rawString(func(svcCtx *DoptimeReqCtx, name string) (interface{}, error) {
+				var bitCount *redis.BitCount
+				if svcCtx.FormValue("Start") != "" && svcCtx.FormValue("End") != "" {
+					bitCount = &redis.BitCount{Start: svcCtx.FormInt("Start"), End: svcCtx.FormInt("End")}
+				}
+				return svcCtx.RdsClient.BitCount(svcCtx.Ctx, name, bitCount).Result()
+			})},
+	)
+}
@@ -0,0 +1,223 @@
+package httpserve
+
+import (
+	"strings"
+
+	"github.com/doptime/redisdb"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func allowZSet(op redisdb.ZSetOp) func(svcCtx *DoptimeReqCtx) bool {
+	return func(svcCtx *DoptimeReqCtx) bool { return redisdb.IsAllowedZSetOp(svcCtx.Key, op) }
+}
+
+// withZSetKey runs f with the typed zset key of svcCtx.Key
+func withZSetKey(f func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error)) HandlerFunc {
+	return func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+		zkey, err := redisdb.GetHttpZSetKey(svcCtx.Key, svcCtx.RedisDataSource)
+		if err != nil {
+			return nil, err
+		}
+		return f(svcCtx, zkey)
+	}
+}
+
+func membersWithScores(members interface{}, scores []float64, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"members": members, "scores": scores}, nil
+}
+
+var (
+	zrangeParams   = append(rangeParams, DataCmdParam{"WITHSCORES", ParamBool, false})
+	byScoreParams  = []DataCmdParam{{"Min", ParamString, true}, {"Max", ParamString, true}, {"Offset", ParamInt, true}, {"Count", ParamInt, true}, {"WITHSCORES", ParamBool, false}}
+	minMaxParams   = []DataCmdParam{{"Min", ParamString, true}, {"Max", ParamString, true}}
+	zmemberParams  = []DataCmdParam{{"Member", ParamString, false}}
+	byLexParams    = []DataCmdParam{{"Min", ParamString, true}, {"Max", ParamString, true}, {"Offset", ParamInt, false}, {"Count", ParamInt, false}}
+	popParams      = []DataCmdParam{{"Count", ParamInt, false}}
+	zRangeByOption = func(svcCtx *DoptimeReqCtx) *redis.ZRangeBy {
+		return &redis.ZRangeBy{Min: svcCtx.FormValue("Min"), Max: svcCtx.FormValue("Max"), Offset: svcCtx.FormInt("Offset"), Count: svcCtx.FormInt("Count")}
+	}
+)
+
+// zrangeByLex runs ZRANGEBYLEX or ZREVRANGEBYLEX, the members are converted to the value type of the key
+func zrangeByLex(rangeByLex func(svcCtx *DoptimeReqCtx, opt *redis.ZRangeBy) ([]string, error)) HandlerFunc {
+	return withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+		members, err := rangeByLex(svcCtx, zRangeByOption(svcCtx))
+		if err != nil {
+			return nil, err
+		}
+		return unmarshalMembers(zkey, members)
+	})
+}
+
+// queueZRange is ZRANGE, ZREVRANGE & the BYSCORE ones of batch requests, the members are converted to the value type of the key
+func queueZRange(zrange func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) *redis.ZSliceCmd) QueueFunc {
+	return queueWithKey(redisdb.GetHttpZSetKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, zkey redisdb.IHttpZSetKey) (QueuedReply, error) {
+		cmd := zrange(svcCtx, pipe)
+		withScores := svcCtx.FormBool("WITHSCORES")
+		return func() (interface{}, error) {
+			zs, err := cmd.Result()
+			if err != nil {
+				return nil, err
+			}
+			memberStrs, scores := make([]string, len(zs)), make([]float64, len(zs))
+			for i, z := range zs {
+				memberStrs[i], scores[i] = z.Member.(string), z.Score
+			}
+			members, err := unmarshalMembers(zkey, memberStrs)
+			if !withScores {
+				return members, err
+			}
+			return membersWithScores(members, scores, err)
+		}, nil
+	})
+}
+
+// popCount is Count of ZPOPMIN & ZPOPMAX, 1 by default
+func popCount(svcCtx *DoptimeReqCtx) int64 {
+	return max(svcCtx.FormInt("Count"), 1)
+}
+
+func init() {
+	RegisterDataCommand(
+		&DataCommand{Name: ZCARD, RequireKey: true, Permitted: allowZSet(redisdb.ZCard),
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				return zkey.ZCard()
+			}),
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.ZCard(svcCtx.Ctx, svcCtx.Key).Result), nil
+			}},
+		&DataCommand{Name: ZSCAN, RequireKey: true, Permitted: allowZSet(redisdb.ZScan), Params: scanParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				values, cursor, err := zkey.ZScan(svcCtx.FormUint("Cursor"), svcCtx.FormValue("Match"), svcCtx.FormInt("Count"))
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"values": values, "cursor": cursor}, nil
+			})},
+		&DataCommand{Name: ZRANGE, RequireKey: true, Permitted: allowZSet(redisdb.ZRange), Params: zrangeParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				if svcCtx.FormBool("WITHSCORES") {
+					return membersWithScores(zkey.ZRangeWithScores(svcCtx.FormInt("Start"), svcCtx.FormInt("Stop")))
+				}
+				return zkey.ZRange(svcCtx.FormInt("Start"), svcCtx.FormInt("Stop"))
+			}),
+			Queue: queueZRange(func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) *redis.ZSliceCmd {
+				return pipe.ZRangeWithScores(svcCtx.Ctx, svcCtx.Key, svcCtx.FormInt("Start"), svcCtx.FormInt("Stop"))
+			})},
+		&DataCommand{Name: ZREVRANGE, RequireKey: true, Permitted: allowZSet(redisdb.ZRevRange), Params: zrangeParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				if svcCtx.FormBool("WITHSCORES") {
+					return membersWithScores(zkey.ZRevRangeWithScores(svcCtx.FormInt("Start"), svcCtx.FormInt("Stop")))
+				}
+				return zkey.ZRevRange(svcCtx.FormInt("Start"), svcCtx.FormInt("Stop"))
+			}),
+			Queue: queueZRange(func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) *redis.ZSliceCmd {
+				return pipe.ZRevRangeWithScores(svcCtx.Ctx, svcCtx.Key, svcCtx.FormInt("Start"), svcCtx.FormInt("Stop"))
+			})},
+		&DataCommand{Name: ZRANGEBYSCORE, RequireKey: true, Permitted: allowZSet(redisdb.ZRangeByScore), Params: byScoreParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				if svcCtx.FormBool("WITHSCORES") {
+					return membersWithScores(zkey.ZRangeByScoreWithScores(zRangeByOption(svcCtx)))
+				}
+				return zkey.ZRangeByScore(zRangeByOption(svcCtx))
+			}),
+			Queue: queueZRange(func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) *redis.ZSliceCmd {
+				return pipe.ZRangeByScoreWithScores(svcCtx.Ctx, svcCtx.Key, zRangeByOption(svcCtx))
+			})},
+		&DataCommand{Name: ZREVRANGEBYSCORE, RequireKey: true, Permitted: allowZSet(redisdb.ZRevRangeByScore), Params: byScoreParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				if svcCtx.FormBool("WITHSCORES") {
+					return membersWithScores(zkey.ZRevRangeByScoreWithScores(zRangeByOption(svcCtx)))
+				}
+				return zkey.ZRevRangeByScore(zRangeByOption(svcCtx))
+			}),
+			Queue: queueZRange(func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) *redis.ZSliceCmd {
+				return pipe.ZRevRangeByScoreWithScores(svcCtx.Ctx, svcCtx.Key, zRangeByOption(svcCtx))
+			})},
+		&DataCommand{Name: ZRANK, RequireKey: true, Permitted: allowZSet(redisdb.ZRank), Params: zmemberParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				return zkey.ZRank(svcCtx.FormValue("Member"))
+			})},
+		&DataCommand{Name: ZSCORE, RequireKey: true, Permitted: allowZSet(redisdb.ZScore), Params: zmemberParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				return zkey.ZScore(svcCtx.FormValue("Member"))
+			}),
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.ZScore(svcCtx.Ctx, svcCtx.Key, svcCtx.FormValue("Member")).Result), nil
+			}},
+		&DataCommand{Name: ZREVRANK, RequireKey: true, Permitted: allowZSet(redisdb.ZRank), Params: zmemberParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				return zkey.ZRevRank(svcCtx.FormValue("Member"))
+			})},
+		&DataCommand{Name: ZRANGEBYLEX, RequireKey: true, Permitted: allowZSet(redisdb.ZRange), Params: byLexParams,
+			Execute: zrangeByLex(func(svcCtx *DoptimeReqCtx, opt *redis.ZRangeBy) ([]string, error) {
+				return svcCtx.RdsClient.ZRangeByLex(svcCtx.Ctx, svcCtx.Key, opt).Result()
+			})},
+		&DataCommand{Name: ZREVRANGEBYLEX, RequireKey: true, Permitted: allowZSet(redisdb.ZRevRange), Params: byLexParams,
+			Execute: zrangeByLex(func(svcCtx *DoptimeReqCtx, opt *redis.ZRangeBy) ([]string, error) {
+				return svcCtx.RdsClient.ZRevRangeByLex(svcCtx.Ctx, svcCtx.Key, opt).Result()
+			})},
+		&DataCommand{Name: ZLEXCOUNT, RequireKey: true, Permitted: allowZSet(redisdb.ZCount), Params: minMaxParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				return zkey.ZLexCount(svcCtx.FormValue("Min"), svcCtx.FormValue("Max"))
+			})},
+		&DataCommand{Name: ZPOPMIN, RequireKey: true, Writes: true, Permitted: allowZSet(redisdb.ZRem), Params: popParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				return membersWithScores(zkey.ZPopMin(popCount(svcCtx)))
+			})},
+		&DataCommand{Name: ZPOPMAX, RequireKey: true, Writes: true, Permitted: allowZSet(redisdb.ZRem), Params: popParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				return membersWithScores(zkey.ZPopMax(popCount(svcCtx)))
+			})},
+		&DataCommand{Name: ZCOUNT, RequireKey: true, Permitted: allowZSet(redisdb.ZCount), Params: minMaxParams,
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				return zkey.ZCount(svcCtx.FormValue("Min"), svcCtx.FormValue("Max"))
+			}),
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.ZCount(svcCtx.Ctx, svcCtx.Key, svcCtx.FormValue("Min"), svcCtx.FormValue("Max")).Result), nil
+			}},
+		&DataCommand{Name: ZADD, RequireKey: true, Writes: true, Permitted: allowZSet(redisdb.ZAdd),
+			Params: []DataCmdParam{{"Score", ParamFloat, true}},
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				member, err := svcCtx.ToValue(zkey, svcCtx.Body())
+				if err != nil {
+					return nil, err
+				}
+				return boolResult(zkey.ZAdd(redis.Z{Score: svcCtx.FormFloat("Score"), Member: member}))
+			}),
+			Queue: queueWithKey(redisdb.GetHttpZSetKey, func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner, zkey redisdb.IHttpZSetKey) (QueuedReply, error) {
+				member, err := svcCtx.ToValue(zkey, svcCtx.Body())
+				if err != nil {
+					return nil, err
+				}
+				//members are stored in msgpack, the same as redisdb.ZSetKey.ZAdd
+				memberBytes, err := msgpack.Marshal(member)
+				if err != nil {
+					return nil, err
+				}
+				return replyOf(pipe.ZAdd(svcCtx.Ctx, svcCtx.Key, redis.Z{Score: svcCtx.FormFloat("Score"), Member: memberBytes}).Result), nil
+			})},
+		&DataCommand{Name: ZREM, RequireKey: true, Writes: true, Permitted: allowZSet(redisdb.ZRem),
+			Params: []DataCmdParam{{"Member", ParamString, true}},
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				return boolResult(zkey.ZRem(sliceToInterface(strings.Split(svcCtx.FormValue("Member"), ","))...))
+			})},
+		&DataCommand{Name: ZREMRANGEBYSCORE, RequireKey: true, Writes: true, Permitted: allowZSet(redisdb.ZRemRangeByScore), Params: minMaxParams,
+			Execute: func(svcCtx *DoptimeReqCtx) (interface{}, error) {
+				// 接口未定义，兜底
+				return boolResult(svcCtx.RdsClient.ZRemRangeByScore(svcCtx.Ctx, svcCtx.Key, svcCtx.FormValue("Min"), svcCtx.FormValue("Max")).Err())
+			}},
+		&DataCommand{Name: ZINCRBY, RequireKey: true, Writes: true, Permitted: allowZSet(redisdb.ZIncrBy),
+			Params: []DataCmdParam{{"Member", ParamString, true}, {"Incr", ParamFloat, true}},
+			Execute: withZSetKey(func(svcCtx *DoptimeReqCtx, zkey redisdb.IHttpZSetKey) (interface{}, error) {
+				return zkey.ZIncrBy(svcCtx.FormFloat("Incr"), svcCtx.FormValue("Member"))
+			}),
+			Queue: func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (QueuedReply, error) {
+				return replyOf(pipe.ZIncrBy(svcCtx.Ctx, svcCtx.Key, svcCtx.FormFloat("Incr"), svcCtx.FormValue("Member")).Result), nil
+			}},
+	)
+}
@@ -0,0 +1,181 @@
+package httpserve
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doptime/doptime/vars"
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// ParamKind is the type of the form value of data command
+type ParamKind string
+
+const (
+	ParamString   ParamKind = "string"
+	ParamInt      ParamKind = "int"
+	ParamUint     ParamKind = "uint"
+	ParamFloat    ParamKind = "float"
+	ParamDuration ParamKind = "duration"
+	ParamBool     ParamKind = "bool"
+)
+
+// DataCmdParam is a form value of data command, i.g. Start of LRANGE
+type DataCmdParam struct {
+	Name     string
+	Kind     ParamKind
+	Required bool
+}
+
+// DataCommand is the data operation of CMD-Key url. built-ins and the ones registered by applications share the same table
+type DataCommand struct {
+	Name         string
+	RequireKey   bool
+	RequireField bool
+	// Writes publishes ChangeEvent after success
+	Writes bool
+	// Params are checked before Execute, so that Execute can read them by svcCtx.FormInt ... without checking
+	Params []DataCmdParam
+	// Permitted checks the permission of svcCtx.Key. nil means the command is always permitted
+	Permitted func(svcCtx *DoptimeReqCtx) bool
+	Execute   HandlerFunc
+	// Queue adds the command to the redis pipeline of batch requests, the reply is read after exec.
+	// the commands without Queue can not be batched
+	Queue QueueFunc
+}
+
+// QueueFunc adds the command to pipe. the error aborts the whole batch before anything is sent to redis
+type QueueFunc func(svcCtx *DoptimeReqCtx, pipe redis.Pipeliner) (reply QueuedReply, err error)
+
+// QueuedReply reads the reply of the queued command after the pipeline is executed
+type QueuedReply func() (interface{}, error)
+
+// DataCommands is keyed by the upper case name of command
+var DataCommands = cmap.New[*DataCommand]()
+
+// RegisterDataCommand adds the data command, or replaces the one of the same name:
+//
+//	httpserve.RegisterDataCommand(&httpserve.DataCommand{Name: "HGETJSON", RequireKey: true, RequireField: true,
+//		Permitted: func(svcCtx *httpserve.DoptimeReqCtx) bool { return redisdb.IsAllowedHashOp(svcCtx.Key, redisdb.HGet) },
+//		Execute: func(svcCtx *httpserve.DoptimeReqCtx) (interface{}, error) {
+//			return svcCtx.RdsClient.HGet(svcCtx.Ctx, svcCtx.Key, svcCtx.Field()).Result()
+//		}})
+func RegisterDataCommand(cmds ...*DataCommand) {
+	for _, cmd := range cmds {
+		cmd.Name = strings.ToUpper(cmd.Name)
+		DataCommands.Set(cmd.Name, cmd)
+	}
+}
+
+// run checks the permission and the params, then executes the command
+func (cmd *DataCommand) run(svcCtx *DoptimeReqCtx) (result interface{}, err error) {
+	if err = cmd.check(svcCtx); err != nil {
+		return nil, err
+	}
+	if key := svcCtx.idempotencyKey(); key != "" && cmd.changesData() {
+		return cmd.executeIdempotently(svcCtx, key)
+	}
+	result, err = cmd.Execute(svcCtx)
+	return result, cmd.notFound(err)
+}
+
+// notFound maps redis.Nil of the reads to ErrNotFound (404), i.g. HGET of missing field.
+// the writes keep redis.Nil, i.g. SET NX of existing key is not a missing key; so does EVAL, nil is what the script returns
+func (cmd *DataCommand) notFound(err error) error {
+	if err == redis.Nil && !cmd.Writes && cmd.Name != EVAL {
+		return fmt.Errorf("%w: %v", vars.ErrNotFound, err)
+	}
+	return err
+}
+
+// check checks the permission and the params of the command
+func (cmd *DataCommand) check(svcCtx *DoptimeReqCtx) (err error) {
+	if cmd.Permitted != nil && !cmd.Permitted(svcCtx) {
+		return ErrOperationNotPermited
+	}
+	for _, param := range cmd.Params {
+		if err = svcCtx.checkParam(param); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (svc *DoptimeReqCtx) checkParam(param DataCmdParam) (err error) {
+	value := svc.FormValue(param.Name)
+	if value == "" {
+		if param.Required {
+			return fmt.Errorf("%w: %s required", vars.ErrParm, param.Name)
+		}
+		return nil
+	}
+	switch param.Kind {
+	case ParamInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case ParamUint:
+		_, err = strconv.ParseUint(value, 10, 64)
+	case ParamFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case ParamDuration:
+		_, err = time.ParseDuration(value)
+	case ParamBool:
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: parse %s error: %v", vars.ErrParm, param.Name, err)
+	}
+	return nil
+}
+
+// FormValue is the value of url query or form of the request
+func (svc *DoptimeReqCtx) FormValue(name string) string {
+	if svc.Request == nil {
+		return svc.Queries.Get(name)
+	}
+	return svc.Request.FormValue(name)
+}
+
+// FormInt is the int value of the form, 0 if missing or bad
+func (svc *DoptimeReqCtx) FormInt(name string) int64 {
+	v, _ := strconv.ParseInt(svc.FormValue(name), 10, 64)
+	return v
+}
+
+// FormUint is the uint value of the form, 0 if missing or bad
+func (svc *DoptimeReqCtx) FormUint(name string) uint64 {
+	v, _ := strconv.ParseUint(svc.FormValue(name), 10, 64)
+	return v
+}
+
+// FormFloat is the float value of the form, 0 if missing or bad
+func (svc *DoptimeReqCtx) FormFloat(name string) float64 {
+	v, _ := strconv.ParseFloat(svc.FormValue(name), 64)
+	return v
+}
+
+// FormDuration is the duration value of the form, i.g. "1.5s"
+func (svc *DoptimeReqCtx) FormDuration(name string) time.Duration {
+	v, _ := time.ParseDuration(svc.FormValue(name))
+	return v
+}
+
+// FormBool is true if the form value is "true" or "1"
+func (svc *DoptimeReqCtx) FormBool(name string) bool {
+	v, _ := strconv.ParseBool(svc.FormValue(name))
+	return v
+}
+
+// Body is the msgpack body of the request, nil if the Content-Type is not application/octet-stream
+func (svc *DoptimeReqCtx) Body() []byte {
+	return svc.MsgpackBody(svc.Request, true)
+}
+
+func boolResult(err error) (interface{}, error) {
+	if err != nil {
+		return "false", err
+	}
+	return "true", nil
+}
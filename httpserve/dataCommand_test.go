@@ -0,0 +1,29 @@
+package httpserve
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/doptime/doptime/vars"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestUnsupportedDataCommand(t *testing.T) {
+	svcCtx := newBatchCtx(t, "SORT-foo", "")
+	//the redis commands not implemented are not called as api
+	if _, err := executeCommand(svcCtx); !errors.Is(err, ErrBadCommand) {
+		t.Fatalf("SORT should be a bad command, got %v", err)
+	}
+}
+
+func TestDataCommandNotFound(t *testing.T) {
+	hget, _ := DataCommands.Get(HGET)
+	set, _ := DataCommands.Get(SET)
+	//a miss of the reads is not found, the redis.Nil of the writes is left as is
+	if err := hget.notFound(redis.Nil); !errors.Is(err, vars.ErrNotFound) {
+		t.Errorf("HGET miss = %v, want not found", err)
+	}
+	if err := set.notFound(redis.Nil); err != redis.Nil {
+		t.Errorf("SET nil = %v, want redis.Nil", err)
+	}
+}
@@ -0,0 +1,75 @@
+package httpserve
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+
+	"github.com/doptime/config"
+	"github.com/doptime/config/cfghttp"
+	"github.com/doptime/doptime/api"
+	"github.com/doptime/doptime/httpserve/httpdoc"
+)
+
+// the api explorer is served at /explorer/, under the path of the http server.
+// it lists the apis & data keys of the registry, and calls them against this server
+//
+//go:embed explorer
+var explorerAssets embed.FS
+
+// ConfigExplorer is the [Explorer] item in toml. the explorer & /datakeys list all the apis & data keys,
+// they are served only if enabled, i.g.
+//
+//	[Explorer]
+//	Enable = true
+type ConfigExplorer struct {
+	Enable bool
+}
+
+var explorerOption ConfigExplorer
+
+// DocsOfData are the data keys of the registry, and the data commands of this server, for the api explorer
+type DocsOfData struct {
+	Keys     []*httpdoc.DocsOfDataKey
+	Commands []*DocsOfDataCommand
+}
+
+type DocsOfDataCommand struct {
+	Name         string
+	RequireKey   bool
+	RequireField bool
+	Writes       bool
+	Params       []DataCmdParam
+}
+
+func getDocsOfData() (docs *DocsOfData, err error) {
+	docs = &DocsOfData{Commands: []*DocsOfDataCommand{}}
+	if docs.Keys, err = httpdoc.GetDataKeys(); err != nil {
+		return nil, err
+	}
+	for _, cmd := range DataCommands.Items() {
+		params := cmd.Params
+		if params == nil {
+			params = []DataCmdParam{}
+		}
+		docs.Commands = append(docs.Commands, &DocsOfDataCommand{Name: cmd.Name, RequireKey: cmd.RequireKey, RequireField: cmd.RequireField,
+			Writes: cmd.Writes, Params: params})
+	}
+	sort.Slice(docs.Commands, func(i, j int) bool { return docs.Commands[i].Name < docs.Commands[j].Name })
+	return docs, nil
+}
+
+func init() {
+	config.LoadItemFromToml("Explorer", &explorerOption)
+	if !explorerOption.Enable {
+		return
+	}
+	ApiDataKeys = api.Api(func(req *DataKeys) (r *DocsOfData, err error) {
+		return getDocsOfData()
+	}).Func
+	assets, _ := fs.Sub(explorerAssets, "explorer")
+	prefix := path.Join("/", cfghttp.Path, "explorer") + "/"
+	AddRoute(prefix, http.StripPrefix(prefix, http.FileServer(http.FS(assets))).ServeHTTP)
+}
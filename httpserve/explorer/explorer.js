@@ -0,0 +1,349 @@
+// the api explorer of doptime. the apis are listed from /openapi, the data keys from /datakeys.
+// the calls are sent to the server serving this page, with the jwt pasted
+(function () {
+  "use strict";
+
+  // the path of the http server, i.g. / or /svc/
+  const base = location.pathname.replace(/explorer\/.*$/, "");
+  const $ = (id) => document.getElementById(id);
+  let spec = { paths: {}, components: { schemas: {} } };
+  let data = { keys: [], commands: [] };
+  let selected = null;
+
+  // nodes flattens the children, the nested arrays & the nulls are allowed
+  const nodes = (children) => children.flat(Infinity).filter((c) => c !== undefined && c !== null).map((c) => (c instanceof Node ? c : String(c)));
+
+  function el(tag, attrs, ...children) {
+    const e = document.createElement(tag);
+    for (const [k, v] of Object.entries(attrs || {})) {
+      if (k === "class") e.className = v;
+      else if (k.startsWith("on")) e.addEventListener(k.slice(2), v);
+      else if (v !== undefined && v !== null && v !== false) e.setAttribute(k, v === true ? "" : v);
+    }
+    e.append(...nodes(children));
+    return e;
+  }
+
+  const fill = (target, ...children) => target.replaceChildren(...nodes(children));
+
+  const badge = (status) => el("span", { class: "badge " + (status || "") }, status || "unknown");
+
+  // headers of the calls, with the jwt & the Idempotency-Key
+  function headers(contentType) {
+    const h = {};
+    if (contentType) h["Content-Type"] = contentType;
+    const jwt = $("jwt").value.trim();
+    if (jwt) h["Authorization"] = "Bearer " + jwt.replace(/^Bearer\s+/i, "");
+    const key = $("idempotency").value.trim();
+    if (key) h["Idempotency-Key"] = key;
+    return h;
+  }
+
+  async function send(out, url, init) {
+    fill(out, el("p", { class: "hint" }, "calling " + url + " ..."));
+    const start = performance.now();
+    try {
+      const rsp = await fetch(url, init);
+      const text = await rsp.text();
+      let body = text;
+      try {
+        body = JSON.stringify(JSON.parse(text), null, 2);
+      } catch (e) {}
+      fill(out,
+        el("p", {},
+          el("span", { class: "status " + (rsp.ok ? "ok" : "error") }, rsp.status + " " + rsp.statusText),
+          el("span", { class: "meta" }, "  " + Math.round(performance.now() - start) + " ms, " + (rsp.headers.get("Content-Type") || ""))),
+        el("pre", {}, body));
+    } catch (e) {
+      fill(out, el("p", { class: "status error" }, String(e)));
+    }
+  }
+
+  // schema forms
+
+  function resolve(s) {
+    for (let i = 0; s && s.$ref && i < 32; i++) {
+      s = spec.components.schemas[s.$ref.replace("#/components/schemas/", "")] || {};
+    }
+    return s || {};
+  }
+
+  // field renders the input of the schema. read returns undefined for the empty optional value, so that the default of the server applies
+  function field(schema, required, depth) {
+    const s = resolve(schema);
+    if (s.readOnly) {
+      const input = el("input", { disabled: true, placeholder: "filled from JWT" });
+      return { input, read: () => undefined };
+    }
+    if (s.enum) {
+      const select = el("select", {}, required ? null : el("option", { value: "" }, ""),
+        s.enum.map((v, i) => el("option", { value: i, selected: v === s.default }, JSON.stringify(v))));
+      return { input: select, read: () => (select.value === "" ? undefined : s.enum[+select.value]) };
+    }
+    const type = Array.isArray(s.type) ? s.type.find((t) => t !== "null") : s.type;
+    if (type === "string") {
+      const placeholder = s.format === "date-time" ? "RFC3339, i.g. 2024-01-02T15:04:05Z" : s.contentEncoding === "base64" ? "base64" : "";
+      const input = el("input", { value: s.default, placeholder, pattern: s.pattern });
+      return { input, read: () => (input.value === "" && !required ? undefined : input.value) };
+    }
+    if (type === "integer" || type === "number") {
+      const input = el("input", { type: "number", step: type === "integer" ? "1" : "any", value: s.default, min: s.minimum, max: s.maximum });
+      return { input, read: () => (input.value === "" ? undefined : Number(input.value)) };
+    }
+    if (type === "boolean") {
+      const input = el("input", { type: "checkbox", checked: s.default === true });
+      return { input, read: () => input.checked };
+    }
+    if (type === "object" && s.properties && depth < 4) {
+      return object(s, depth + 1);
+    }
+    //arrays, maps & the others are edited as json
+    const input = el("textarea", { placeholder: "json" }, s.default !== undefined ? JSON.stringify(s.default, null, 2) : "");
+    return {
+      input,
+      read: () => {
+        if (input.value.trim() === "") return undefined;
+        return JSON.parse(input.value);
+      },
+    };
+  }
+
+  function object(s, depth) {
+    const required = new Set(s.required || []);
+    const fields = Object.keys(s.properties).sort().map((name) => {
+      const f = field(s.properties[name], required.has(name), depth);
+      const p = resolve(s.properties[name]);
+      const label = el("label", { class: required.has(name) ? "required" : "" }, name,
+        el("small", {}, [p.type, p.format].filter(Boolean).join(", ")), p.description ? el("small", {}, p.description) : null);
+      return { name, f, row: el("div", { class: "field" }, label, f.input) };
+    });
+    const input = depth > 0 ? el("fieldset", {}, fields.map((x) => x.row)) : el("div", {}, fields.map((x) => x.row));
+    return {
+      input,
+      read: () => {
+        const v = {};
+        for (const x of fields) {
+          const value = x.f.read();
+          if (value !== undefined) v[x.name] = value;
+        }
+        return v;
+      },
+    };
+  }
+
+  // api panel
+
+  function showApi(path, op) {
+    const name = path.replace(/^\//, "");
+    const schema = resolve(((op.requestBody || {}).content || {})["application/json"]?.schema || {});
+    const form = schema.type === "object" && schema.properties ? object(schema, 0) : field(schema, true, 0);
+    const raw = el("textarea", { hidden: true, rows: 12 });
+    const out = el("div");
+    let useRaw = false;
+    const toggle = el("button", {
+      class: "secondary", type: "button",
+      onclick: () => {
+        useRaw = !useRaw;
+        if (useRaw) {
+          try {
+            raw.value = JSON.stringify(form.read() ?? {}, null, 2);
+          } catch (e) {}
+        }
+        raw.hidden = !useRaw;
+        form.input.hidden = useRaw;
+        toggle.textContent = useRaw ? "Form" : "Raw JSON";
+      },
+    }, "Raw JSON");
+    const execute = el("button", {
+      type: "button",
+      onclick: () => {
+        let body;
+        try {
+          body = JSON.stringify(useRaw ? JSON.parse(raw.value || "{}") : form.read() ?? {});
+        } catch (e) {
+          fill(out, el("p", { class: "status error" }, "invalid json: " + e.message));
+          return;
+        }
+        send(out, base + name, { method: "POST", headers: headers("application/json"), body });
+      },
+    }, "Execute");
+    const instances = op["x-doptime-instances"] || [];
+    fill($("panel"),
+      el("h2", {}, "POST " + base + name, badge(op["x-doptime-status"])),
+      el("p", { class: "meta" }, "service " + (op["x-doptime-service"] || "-") + (op["x-doptime-version"] ? " " + op["x-doptime-version"] : "") +
+        ", " + (instances.length ? "served by " + instances.join(", ") : "no live instance")),
+      op.deprecated ? el("p", { class: "status error" }, "removed from the live instances of the service, the call may fail") : null,
+      el("h3", {}, "Request"), form.input, raw,
+      el("div", { class: "actions" }, execute, toggle),
+      el("h3", {}, "Response"), out);
+  }
+
+  // data key panel
+
+  function showKey(key) {
+    const permitted = new Set(key.permissions || []);
+    //the db commands, i.g. TIME, are permitted by _systemdb, and sent without key
+    const isDb = key.keytype === "db";
+    const commands = data.commands.filter((c) => c.requirekey !== isDb);
+    const select = el("select", {},
+      el("optgroup", { label: "permitted" }, commands.filter((c) => permitted.has(c.name)).map((c) => el("option", { value: c.name }, c.name))),
+      el("optgroup", { label: "others" }, commands.filter((c) => !permitted.has(c.name)).map((c) => el("option", { value: c.name }, c.name))));
+    const keyInput = el("input", { value: key.keyname });
+    const fieldInput = el("input", { placeholder: "f, the field or member" });
+    const params = el("div");
+    const query = el("input", { placeholder: "extra query, i.g. ds=default" });
+    const value = el("textarea", { placeholder: "json value, sent as msgpack" });
+    const out = el("div");
+    let paramInputs = [];
+    const row = (label, input) => el("div", { class: "field" }, el("label", {}, label), input);
+    const fieldRow = row("field", fieldInput), valueRow = row("value", value);
+    const onCommand = () => {
+      const cmd = commands.find((c) => c.name === select.value) || {};
+      fieldRow.hidden = !cmd.requirefield;
+      valueRow.hidden = !cmd.writes;
+      paramInputs = (cmd.params || []).map((p) => ({ p, input: el("input", { placeholder: p.kind }) }));
+      fill(params, paramInputs.map(({ p, input }) => el("div", { class: "field" }, el("label", { class: p.required ? "required" : "" }, p.name), input)));
+    };
+    select.addEventListener("change", onCommand);
+    onCommand();
+    const execute = el("button", {
+      type: "button",
+      onclick: () => {
+        const cmd = commands.find((c) => c.name === select.value) || {};
+        const q = new URLSearchParams(query.value.trim());
+        if (cmd.requirefield || fieldInput.value) q.set("f", fieldInput.value);
+        for (const { p, input } of paramInputs) {
+          if (input.value !== "") q.set(p.name, input.value);
+        }
+        const url = base + encodeURIComponent(isDb ? cmd.name : cmd.name + "-" + keyInput.value) + (q.toString() ? "?" + q : "");
+        if (!cmd.writes) {
+          send(out, url, { method: "GET", headers: headers() });
+          return;
+        }
+        let body;
+        try {
+          body = msgpack(value.value.trim() === "" ? null : JSON.parse(value.value));
+        } catch (e) {
+          fill(out, el("p", { class: "status error" }, "invalid json: " + e.message));
+          return;
+        }
+        send(out, url, { method: "POST", headers: headers("application/octet-stream"), body });
+      },
+    }, "Execute");
+    fill($("panel"),
+      el("h2", {}, key.keyname, badge(key.status)),
+      el("p", { class: "meta" }, [key.keytype || "undefined type", key.valuetypename, key.updateat ? "synced " + new Date(key.updateat * 1000).toLocaleString() : ""]
+        .filter(Boolean).join(", ")),
+      el("h3", {}, "Permissions"),
+      permitted.size ? el("div", {}, [...permitted].map((p) => el("span", { class: "chip" }, p))) : el("p", { class: "hint" }, "not permitted by this server"),
+      key.tsinterface ? [el("h3", {}, "Value"), el("pre", {}, key.tsinterface)] : null,
+      el("h3", {}, "Try"),
+      row("command", select), isDb ? null : row("key", keyInput), fieldRow, params, row("query", query), valueRow,
+      el("div", { class: "actions" }, execute),
+      el("h3", {}, "Response"), out);
+  }
+
+  // msgpack encodes the json value, as the data commands read the msgpack body
+  function msgpack(value) {
+    const bytes = [];
+    const utf8 = new TextEncoder();
+    // be writes the big endian two's complement of the integer
+    const be = (n, size) => {
+      const u = BigInt.asUintN(size * 8, BigInt(n));
+      for (let i = size - 1; i >= 0; i--) bytes.push(Number((u >> BigInt(8 * i)) & 0xffn));
+    };
+    const encode = (v) => {
+      if (v === null || v === undefined) bytes.push(0xc0);
+      else if (v === true || v === false) bytes.push(v ? 0xc3 : 0xc2);
+      else if (typeof v === "number" && Number.isSafeInteger(v)) {
+        if (v >= 0 && v < 0x80) bytes.push(v);
+        else if (v < 0 && v >= -32) bytes.push(v & 0xff);
+        else if (v >= 0) {
+          if (v < 0x100) bytes.push(0xcc, v);
+          else if (v < 0x10000) bytes.push(0xcd), be(v, 2);
+          else if (v < 2 ** 32) bytes.push(0xce), be(v, 4);
+          else bytes.push(0xcf), be(v, 8);
+        } else if (v >= -0x80) bytes.push(0xd0), be(v, 1);
+        else if (v >= -0x8000) bytes.push(0xd1), be(v, 2);
+        else if (v >= -0x80000000) bytes.push(0xd2), be(v, 4);
+        else bytes.push(0xd3), be(v, 8);
+      } else if (typeof v === "number") encodeFloat(v);
+      else if (typeof v === "string") {
+        const s = utf8.encode(v);
+        if (s.length < 32) bytes.push(0xa0 | s.length);
+        else if (s.length < 0x100) bytes.push(0xd9, s.length);
+        else if (s.length < 0x10000) bytes.push(0xda), be(s.length, 2);
+        else bytes.push(0xdb), be(s.length, 4);
+        bytes.push(...s);
+      } else if (Array.isArray(v)) {
+        if (v.length < 16) bytes.push(0x90 | v.length);
+        else if (v.length < 0x10000) bytes.push(0xdc), be(v.length, 2);
+        else bytes.push(0xdd), be(v.length, 4);
+        v.forEach(encode);
+      } else {
+        const entries = Object.entries(v);
+        if (entries.length < 16) bytes.push(0x80 | entries.length);
+        else if (entries.length < 0x10000) bytes.push(0xde), be(entries.length, 2);
+        else bytes.push(0xdf), be(entries.length, 4);
+        for (const [k, x] of entries) encode(k), encode(x);
+      }
+    };
+    const encodeFloat = (v) => {
+      const view = new DataView(new ArrayBuffer(8));
+      view.setFloat64(0, v);
+      bytes.push(0xcb, ...new Uint8Array(view.buffer));
+    };
+    encode(value);
+    return new Uint8Array(bytes);
+  }
+
+  // sidebar
+
+  function render() {
+    const filter = $("filter").value.trim().toLowerCase();
+    const link = (text, status, onclick) => {
+      const a = el("a", {
+        class: selected === text ? "selected" : "",
+        onclick: () => {
+          selected = text;
+          render();
+          onclick();
+        },
+      }, el("span", {}, text), badge(status));
+      return a;
+    };
+    const services = {};
+    for (const [path, item] of Object.entries(spec.paths).sort()) {
+      const op = item.post;
+      if (!op || (filter && !path.toLowerCase().includes(filter))) continue;
+      const service = op["x-doptime-service"] || "unnamed service";
+      (services[service] = services[service] || []).push(link(path.slice(1), op["x-doptime-status"], () => showApi(path, op)));
+    }
+    fill($("apis"), el("h2", {}, "APIs"),
+      Object.keys(services).length ? Object.keys(services).sort().map((s) => [el("h3", {}, s), services[s]]) : el("p", { class: "hint" }, "no api"));
+    const keys = data.keys.filter((k) => !filter || k.keyname.toLowerCase().includes(filter));
+    fill($("keys"), el("h2", {}, "Data Keys"),
+      keys.length ? keys.map((k) => link(k.keyname, k.status, () => showKey(k))) : el("p", { class: "hint" }, "no data key"));
+  }
+
+  async function load() {
+    const get = async (name) => {
+      const rsp = await fetch(base + name, { headers: headers() });
+      if (!rsp.ok) throw new Error(name + ": " + rsp.status + " " + (await rsp.text()));
+      return rsp.json();
+    };
+    try {
+      [spec, data] = await Promise.all([get("openapi"), get("datakeys")]);
+    } catch (e) {
+      fill($("panel"), el("p", { class: "status error" }, "load failed, " + e.message));
+    }
+    render();
+  }
+
+  // the jwt is kept for the tab only, it's gone when the tab is closed
+  $("jwt").value = sessionStorage.getItem("doptime.explorer.jwt") || "";
+  $("jwt").addEventListener("change", () => sessionStorage.setItem("doptime.explorer.jwt", $("jwt").value.trim()));
+  $("filter").addEventListener("input", render);
+  $("reload").addEventListener("click", load);
+  load();
+})();
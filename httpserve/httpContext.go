@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/doptime/config/cfgredis"
+	"github.com/doptime/doptime/httpserve/httpapi"
 	"github.com/doptime/doptime/lib"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/redis/go-redis/v9"
@@ -32,6 +33,13 @@ type DoptimeReqCtx struct {
 	RdsClient       *redis.Client
 
 	ReqID string
+
+	Request *http.Request
+	Writer  http.ResponseWriter
+	// ResponseContentType is the rt of the request, middlewares may change it
+	ResponseContentType string
+	// Responded is set if the handler has written the response itself, i.g. stream & SUBSCRIBE
+	Responded bool
 }
 
 func (svc *DoptimeReqCtx) Field() string {
@@ -47,7 +55,7 @@ func NewHttpContext(ctx context.Context, r *http.Request, w http.ResponseWriter)
 		CmdKeyFieldsStr, pathStr, pathLastPart string
 		ok                                     bool
 	)
-	svc = &DoptimeReqCtx{Ctx: ctx, JwtClaims: jwt.MapClaims{}, Params: map[string]interface{}{}}
+	svc = &DoptimeReqCtx{Ctx: ctx, JwtClaims: jwt.MapClaims{}, Params: map[string]interface{}{}, Request: r, Writer: w}
 	//case redis data access
 	//i.g. https://url.com/rSvc/HGET-UserAvatar=fa4Y3oyQk2swURaJ?Queries=*&RspType=image/jpeg
 	//case api command
@@ -61,9 +69,27 @@ func NewHttpContext(ctx context.Context, r *http.Request, w http.ResponseWriter)
 	if CmdKeyFieldsStr, err = url.QueryUnescape(pathLastPart); err != nil {
 		return nil, err, http.StatusBadRequest
 	}
+	//the path with options, as the client sdk calls. i.g. /API-!api:demo-!rt~application%2Fmsgpack
+	//the options are moved to the queries
+	if segments := strings.Split(CmdKeyFieldsStr, "-!"); len(segments) > 1 {
+		queries := r.URL.Query()
+		for _, option := range segments[2:] {
+			if k, v, found := strings.Cut(option, "~"); found {
+				queries.Set(k, v)
+			}
+		}
+		r.URL.RawQuery = queries.Encode()
+		CmdKeyFieldsStr = segments[0] + "-" + segments[1]
+	}
 	//we regard the unknow command or data operation as api command
 	if CmdKeyFields = strings.SplitN(CmdKeyFieldsStr, "-", 2); len(CmdKeyFields) == 1 {
 		CmdKeyFields = []string{"api", CmdKeyFieldsStr}
+		//data commands without key, i.g. /MULTI, unless there's an api of the same name
+		if dataCmd, ok := DataCommands.Get(strings.ToUpper(CmdKeyFieldsStr)); ok && !dataCmd.RequireKey {
+			if _, isApi := httpapi.GetApiByName(CmdKeyFieldsStr); !isApi {
+				CmdKeyFields = []string{CmdKeyFieldsStr}
+			}
+		}
 	} else if len(CmdKeyFields) == 0 {
 		return nil, errors.New("url missing api_name or data_command"), http.StatusBadRequest
 	}
@@ -78,18 +104,15 @@ func NewHttpContext(ctx context.Context, r *http.Request, w http.ResponseWriter)
 		svc.Key = CmdKeyFields[1]
 	}
 
-	// ensure there's a key for certain cmds
-	needed, ok := DataCmdRequireKey[svc.Cmd]
-	if ok && needed && svc.Key == "" {
-		return svc, errors.New("url  key required"), http.StatusBadRequest
-	}
-
-	// field is required for certain data cmds
+	// ensure there's a key & field for certain data cmds
 	svc.Queries = r.URL.Query()
 	svc.Fields = svc.Queries["f"]
-	needed, ok = DataCmdRequireField[svc.Cmd]
-	if ok && needed && svc.Field() == "" {
-		return svc, errors.New("url  field required"), http.StatusBadRequest
+	if dataCmd, ok := DataCommands.Get(svc.Cmd); ok {
+		if dataCmd.RequireKey && svc.Key == "" {
+			return svc, errors.New("url  key required"), http.StatusBadRequest
+		} else if dataCmd.RequireField && svc.Field() == "" {
+			return svc, errors.New("url  field required"), http.StatusBadRequest
+		}
 	}
 
 	//load redis datasource value from form
@@ -0,0 +1,74 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/doptime/doptime/vars"
+	"github.com/doptime/logger"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// DefaultIdempotencyTTL is how long the result of the call with idempotency key is kept for replay
+var DefaultIdempotencyTTL = time.Hour * 24
+
+// idempotentRecord is saved in redis when the call starts, as the lock of the key. Result is set after the call succeeds
+type idempotentRecord struct {
+	// Fingerprint is the hash of the input, the key can not be reused by another input
+	Fingerprint string `msgpack:"f"`
+	Done        bool   `msgpack:"d"`
+	Result      []byte `msgpack:"r,omitempty"`
+}
+
+// Fingerprint is the hash of the input of the call
+func Fingerprint(input []byte) string {
+	sum := sha1.Sum(input)
+	return hex.EncodeToString(sum[:])
+}
+
+// Idempotent runs call once per key, the result is kept in redis for ttl. the duplicates get the saved result (replayed is true),
+// or ErrConflict if the first call is still running, or if the key is used by another input.
+// failed calls are not saved, they can be retried. the lock of the key is released by the deadline of ctx, if the caller is gone
+func Idempotent(ctx context.Context, rds *redis.Client, key, fingerprint string, ttl time.Duration, call func() (result []byte, err error)) (result []byte, replayed bool, err error) {
+	var (
+		b        []byte
+		acquired bool
+		record   idempotentRecord
+		lockTTL  = time.Minute * 2
+	)
+	if deadline, ok := ctx.Deadline(); ok {
+		lockTTL = time.Until(deadline) + time.Second
+	}
+	b, _ = msgpack.Marshal(&idempotentRecord{Fingerprint: fingerprint})
+	if acquired, err = rds.SetNX(ctx, key, b, lockTTL).Result(); err != nil {
+		return nil, false, err
+	} else if acquired {
+		if result, err = call(); err != nil {
+			rds.Del(context.Background(), key)
+			return nil, false, err
+		}
+		b, _ = msgpack.Marshal(&idempotentRecord{Fingerprint: fingerprint, Done: true, Result: result})
+		if err := rds.Set(context.Background(), key, b, ttl).Err(); err != nil {
+			logger.Warn().Err(err).Str("key", key).Msg("idempotent result not saved")
+		}
+		return result, false, nil
+	}
+
+	if b, err = rds.Get(ctx, key).Bytes(); err == redis.Nil {
+		return nil, false, fmt.Errorf("%w: the call of the idempotency key has just failed, retry it", vars.ErrConflict)
+	} else if err != nil {
+		return nil, false, err
+	} else if err = msgpack.Unmarshal(b, &record); err != nil {
+		return nil, false, err
+	}
+	if record.Fingerprint != fingerprint {
+		return nil, false, fmt.Errorf("%w: the idempotency key is used by another input", vars.ErrConflict)
+	} else if !record.Done {
+		return nil, false, fmt.Errorf("%w: the call of the idempotency key is in progress", vars.ErrConflict)
+	}
+	return record.Result, true, nil
+}
@@ -0,0 +1,85 @@
+package httpapi
+
+import (
+	"context"
+	"sync"
+)
+
+// Invoker calls the api with the decoded input, or calls the next interceptor
+type Invoker func(ctx context.Context, in interface{}) (out interface{}, err error)
+
+// Interceptor wraps the call of the api named by name. it may change ctx & in before calling next,
+// change out & err after, or return without calling next:
+//
+//	httpapi.UseInterceptors(func(ctx context.Context, name string, in interface{}, next httpapi.Invoker) (interface{}, error) {
+//		start := time.Now()
+//		out, err := next(ctx, in)
+//		logger.Info().Str("api", name).Dur("cost", time.Since(start)).Err(err).Send()
+//		return out, err
+//	})
+type Interceptor func(ctx context.Context, name string, in interface{}, next Invoker) (out interface{}, err error)
+
+// Before runs f before the call, the call is rejected if f fails. i.g. tenant checks
+func Before(f func(ctx context.Context, name string, in interface{}) error) Interceptor {
+	return func(ctx context.Context, name string, in interface{}, next Invoker) (interface{}, error) {
+		if err := f(ctx, name, in); err != nil {
+			return nil, err
+		}
+		return next(ctx, in)
+	}
+}
+
+// After runs f after the call succeeded, the call fails if f fails. i.g. auditing
+func After(f func(ctx context.Context, name string, in interface{}, out interface{}) error) Interceptor {
+	return func(ctx context.Context, name string, in interface{}, next Invoker) (interface{}, error) {
+		out, err := next(ctx, in)
+		if err != nil {
+			return out, err
+		}
+		return out, f(ctx, name, in, out)
+	}
+}
+
+// OnError runs f after the call failed. the error returned by f replaces the error of the call, nil recovers the call with out
+func OnError(f func(ctx context.Context, name string, in interface{}, err error) (out interface{}, newErr error)) Interceptor {
+	return func(ctx context.Context, name string, in interface{}, next Invoker) (interface{}, error) {
+		out, err := next(ctx, in)
+		if err == nil {
+			return out, nil
+		}
+		return f(ctx, name, in, err)
+	}
+}
+
+var (
+	interceptorsMu     sync.RWMutex
+	globalInterceptors []Interceptor
+)
+
+// UseInterceptors appends interceptors to all the apis, they are run before the interceptors of the api.
+// the interceptor used first is the outermost one
+func UseInterceptors(interceptors ...Interceptor) {
+	interceptorsMu.Lock()
+	defer interceptorsMu.Unlock()
+	globalInterceptors = append(globalInterceptors, interceptors...)
+}
+
+// Intercept calls invoke through the interceptors, global ones first if withGlobal
+func Intercept(ctx context.Context, name string, in interface{}, withGlobal bool, interceptors []Interceptor, invoke Invoker) (interface{}, error) {
+	var chain []Interceptor
+	if withGlobal {
+		interceptorsMu.RLock()
+		chain = append(chain, globalInterceptors...)
+		interceptorsMu.RUnlock()
+	}
+	if chain = append(chain, interceptors...); len(chain) == 0 {
+		return invoke(ctx, in)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		interceptor, next := chain[i], invoke
+		invoke = func(ctx context.Context, in interface{}) (interface{}, error) {
+			return interceptor(ctx, name, in, next)
+		}
+	}
+	return invoke(ctx, in)
+}
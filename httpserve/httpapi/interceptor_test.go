@@ -0,0 +1,49 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIntercept_OrderAndErrors(t *testing.T) {
+	var trace []string
+	around := func(tag string) Interceptor {
+		return func(ctx context.Context, name string, in interface{}, next Invoker) (interface{}, error) {
+			trace = append(trace, tag+">")
+			out, err := next(ctx, in)
+			trace = append(trace, "<"+tag)
+			return out, err
+		}
+	}
+	invoke := func(ctx context.Context, in interface{}) (interface{}, error) {
+		trace = append(trace, "call")
+		return in.(string) + "!", nil
+	}
+	out, err := Intercept(context.Background(), "api:demo", "hi", false, []Interceptor{around("a"), around("b")}, invoke)
+	if err != nil || out != "hi!" || strings.Join(trace, " ") != "a> b> call <b <a" {
+		t.Fatalf("got %v %v, trace %v", out, err, trace)
+	}
+
+	errTenant := errors.New("tenant denied")
+	trace = nil
+	reject := Before(func(ctx context.Context, name string, in interface{}) error { return errTenant })
+	if _, err = Intercept(context.Background(), "api:demo", "hi", false, []Interceptor{reject}, invoke); !errors.Is(err, errTenant) || len(trace) != 0 {
+		t.Fatalf("Before should reject the call, got %v, trace %v", err, trace)
+	}
+
+	errAudit := errors.New("audit failed")
+	audit := After(func(ctx context.Context, name string, in, out interface{}) error { return errAudit })
+	if _, err = Intercept(context.Background(), "api:demo", "hi", false, []Interceptor{audit}, invoke); !errors.Is(err, errAudit) {
+		t.Fatalf("After should fail the call, got %v", err)
+	}
+
+	failed := func(ctx context.Context, in interface{}) (interface{}, error) { return nil, errTenant }
+	recovered := OnError(func(ctx context.Context, name string, in interface{}, err error) (interface{}, error) {
+		return "fallback", nil
+	})
+	if out, err = Intercept(context.Background(), "api:demo", "hi", false, []Interceptor{recovered}, failed); err != nil || out != "fallback" {
+		t.Fatalf("OnError should recover the call, got %v %v", out, err)
+	}
+}
@@ -7,3 +7,10 @@ type ApiInterface interface {
 	CallByMap(ctx context.Context, _map map[string]interface{}, msgpackNonstruct []byte, jsonpackNostruct []byte) (ret interface{}, err error)
 	GetDataSource() string
 }
+
+// StreamApiInterface is implemented by the apis that can send the result in chunks
+type StreamApiInterface interface {
+	ApiInterface
+	IsStream() bool
+	CallStreamByMap(ctx context.Context, _map map[string]interface{}, msgpackNonstruct []byte, jsonpackNostruct []byte, send func(chunk interface{}) error) (err error)
+}
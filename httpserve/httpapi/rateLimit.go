@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/doptime/config/cfgredis"
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// SlidingWindow allows Limit calls in any Window
+	SlidingWindow = "sliding_window"
+	// TokenBucket allows bursts of Limit calls, the tokens are refilled at Limit per Window
+	TokenBucket = "token_bucket"
+)
+
+// RateLimit limits the calls of an api or a data command, counted in redis so that all the instances share the limit
+type RateLimit struct {
+	// Target is the api name (i.g. "api:demo"), the data command (i.g. "KEYS"), or "*" for all
+	Target string
+	// Algorithm is SlidingWindow (default) or TokenBucket
+	Algorithm string
+	Limit     int64
+	Window    time.Duration
+	// KeyBy is who is limited: "ip" (default), "apikey" (the X-Api-Key header validated by httpserve.ValidateApiKey), or jwt claim such as "@sub".
+	// the calls without the claim or the validated header are limited by ip
+	KeyBy string
+	// RdsName is the datasource of the counters, "default" if empty
+	RdsName string
+}
+
+// RateLimits are keyed by Target
+var RateLimits = cmap.New[[]*RateLimit]()
+
+// AddRateLimit adds limits to the target. all the limits of the target, and those of "*", are checked for each call
+func AddRateLimit(limits ...*RateLimit) {
+	for _, limit := range limits {
+		if limit.Target = RateLimitTarget(limit.Target); limit.Algorithm == "" {
+			limit.Algorithm = SlidingWindow
+		}
+		RateLimits.Upsert(limit.Target, []*RateLimit{limit}, func(exist bool, old, new []*RateLimit) []*RateLimit {
+			return append(old, new...)
+		})
+	}
+}
+
+// RateLimitTarget is the api name in lower case, or the data command in upper case
+func RateLimitTarget(target string) string {
+	if strings.HasPrefix(strings.ToLower(target), "api:") {
+		return strings.ToLower(target)
+	}
+	return strings.ToUpper(target)
+}
+
+// sliding window log. KEYS[1] zset of calls; ARGV: now(ms), window(ms), limit, member. returns ms to retry after, 0 if allowed
+var slidingWindowScript = redis.NewScript(`
+local now, window, limit = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - window)
+if redis.call('ZCARD', KEYS[1]) < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return 0
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return math.max(1, tonumber(oldest[2]) + window - now)
+`)
+
+// token bucket. KEYS[1] hash of tokens & ts; ARGV: now(ms), capacity, tokens refilled per ms. returns ms to retry after, 0 if allowed
+var tokenBucketScript = redis.NewScript(`
+local now, capacity, rate = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or capacity
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	retry = math.max(1, math.ceil((1 - tokens) / rate))
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate))
+return retry
+`)
+
+// rateLimitSeq numbers the calls of the process, rateLimitInstance tells the processes apart,
+// so that the calls of the same ms from different instances are different members of the window
+var (
+	rateLimitSeq      atomic.Int64
+	rateLimitInstance = strconv.FormatUint(rand.Uint64(), 36)
+)
+
+// Take counts a call of subject. retryAfter is 0 if the call is allowed
+func (l *RateLimit) Take(ctx context.Context, subject string) (retryAfter time.Duration, err error) {
+	if l.Limit <= 0 || l.Window <= 0 {
+		return 0, nil
+	}
+	rdsName := l.RdsName
+	if rdsName == "" {
+		rdsName = "default"
+	}
+	rds, ok := cfgredis.Servers.Get(rdsName)
+	if !ok {
+		return 0, fmt.Errorf("redis datasource is unconfigured: %s", rdsName)
+	}
+	var (
+		now    = time.Now().UnixMilli()
+		window = l.Window.Milliseconds()
+		key    = "ratelimit:" + l.Target + ":" + l.Algorithm + ":" + subject
+		ms     int64
+	)
+	if l.Algorithm == TokenBucket {
+		ms, err = tokenBucketScript.Run(ctx, rds, []string{key}, now, l.Limit, strconv.FormatFloat(float64(l.Limit)/float64(window), 'f', -1, 64)).Int64()
+	} else {
+		member := strconv.FormatInt(now, 36) + "-" + rateLimitInstance + "-" + strconv.FormatInt(rateLimitSeq.Add(1), 36)
+		ms, err = slidingWindowScript.Run(ctx, rds, []string{key}, now, window, l.Limit, member).Int64()
+	}
+	return time.Duration(ms) * time.Millisecond, err
+}
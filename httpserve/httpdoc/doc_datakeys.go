@@ -0,0 +1,135 @@
+package httpdoc
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/doptime/doptime/lib"
+	"github.com/doptime/redisdb"
+)
+
+// DocsOfDataKey is a data key in the registry. Permissions are the http operations permitted on the key by this service,
+// from redisdb.HttpPermissions; empty if the key is defined by other services only
+type DocsOfDataKey struct {
+	KeyName       string
+	KeyType       string
+	ValueTypeName string
+	// Status is ApiActive if the key is defined in this service or synced in 20 minutes, else ApiStale
+	Status      string
+	UpdateAt    int64
+	Permissions []string
+	TSInterface string
+}
+
+type permissionOp struct {
+	Name string
+	Bit  uint64
+}
+
+// permissionOps are the operations of the permission bits of redisdb, by key type. the bits of different types overlap
+var permissionOps = map[string][]permissionOp{
+	"": {{"DEL", redisdb.Del}, {"EXISTS", redisdb.Exists}, {"EXPIRE", redisdb.Expire}, {"PERSIST", redisdb.Persist},
+		{"TTL", redisdb.TTL}, {"TYPE", redisdb.Type}, {"RENAME", redisdb.Rename}},
+	"hash": {{"HGET", uint64(redisdb.HGet)}, {"HSET", uint64(redisdb.HSet)}, {"HDEL", uint64(redisdb.HDel)}, {"HMGET", uint64(redisdb.HMGET)},
+		{"HEXISTS", uint64(redisdb.HExists)}, {"HGETALL", uint64(redisdb.HGetAll)}, {"HRANDFIELD", uint64(redisdb.HRandField)},
+		{"HRANDFIELDWITHVALUES", uint64(redisdb.HRandFieldWithValues)}, {"HLEN", uint64(redisdb.HLen)}, {"HKEYS", uint64(redisdb.HKeys)},
+		{"HVALS", uint64(redisdb.HVals)}, {"HINCRBY", uint64(redisdb.HIncrBy)}, {"HINCRBYFLOAT", uint64(redisdb.HIncrByFloat)},
+		{"HSETNX", uint64(redisdb.HSetNX)}, {"HSCAN", uint64(redisdb.HScan)}},
+	"list": {{"RPUSH", uint64(redisdb.RPush)}, {"RPUSHX", uint64(redisdb.RPushX)}, {"LPUSH", uint64(redisdb.LPush)}, {"LPUSHX", uint64(redisdb.LPushX)},
+		{"RPOP", uint64(redisdb.RPop)}, {"LPOP", uint64(redisdb.LPop)}, {"LRANGE", uint64(redisdb.LRange)}, {"LREM", uint64(redisdb.LRem)},
+		{"LSET", uint64(redisdb.LSet)}, {"LINDEX", uint64(redisdb.LIndex)}, {"LTRIM", uint64(redisdb.LTrim)}, {"LLEN", uint64(redisdb.LLen)}},
+	"set": {{"SADD", uint64(redisdb.SAdd)}, {"SCARD", uint64(redisdb.SCard)}, {"SREM", uint64(redisdb.SRem)}, {"SISMEMBER", uint64(redisdb.SIsMember)},
+		{"SMEMBERS", uint64(redisdb.SMembers)}, {"SSCAN", uint64(redisdb.SScan)}},
+	"zset": {{"ZADD", uint64(redisdb.ZAdd)}, {"ZREM", uint64(redisdb.ZRem)}, {"ZRANGE", uint64(redisdb.ZRange)}, {"ZRANK", uint64(redisdb.ZRank)},
+		{"ZSCORE", uint64(redisdb.ZScore)}, {"ZCARD", uint64(redisdb.ZCard)}, {"ZCOUNT", uint64(redisdb.ZCount)}, {"ZINCRBY", uint64(redisdb.ZIncrBy)},
+		{"ZSCAN", uint64(redisdb.ZScan)}, {"ZRANGEBYSCORE", uint64(redisdb.ZRangeByScore)}, {"ZREVRANGE", uint64(redisdb.ZRevRange)},
+		{"ZREVRANGEBYSCORE", uint64(redisdb.ZRevRangeByScore)}, {"ZREMRANGEBYSCORE", uint64(redisdb.ZRemRangeByScore)},
+		{"ZRANGEWITHSCORES", uint64(redisdb.ZRangeWithScores)}, {"ZREVRANGEWITHSCORES", uint64(redisdb.ZRevRangeWithScores)}},
+	"string": {{"GET", uint64(redisdb.Get)}, {"SET", uint64(redisdb.Set)}, {"GETALL", uint64(redisdb.StringGetAll)}, {"SETALL", uint64(redisdb.StringSetAll)}},
+	"stream": {{"XADD", uint64(redisdb.XAdd)}, {"XDEL", uint64(redisdb.XDel)}, {"XRANGE", uint64(redisdb.XRange)}, {"XLEN", uint64(redisdb.XLen)},
+		{"XREAD", uint64(redisdb.XRead)}, {"XTRIM", uint64(redisdb.XTrim)}, {"XINFO", uint64(redisdb.XInfo)}},
+	"vset": {{"FT.CREATE", uint64(redisdb.FtCreate)}, {"FT.SEARCH", uint64(redisdb.FtSearch)}, {"FT.AGGREGATE", uint64(redisdb.FtAggregate)},
+		{"FT.DROPINDEX", uint64(redisdb.FtDropIndex)}, {"FT.TAGVALS", uint64(redisdb.FtTagVals)}, {"FT.INFO", uint64(redisdb.FtInfo)}},
+	"db": {{"TIME", uint64(redisdb.DBTime)}, {"KEYS", uint64(redisdb.DBKeys)}},
+}
+
+// PermissionsOf are the names of the operations permitted by mask, the common ones first.
+// the operations of the type are omitted if the type is unknown, i.g. the key is allowed without being defined
+func PermissionsOf(keyType string, mask uint64) []string {
+	ops := []string{}
+	groups := []string{"", keyType}
+	switch keyType {
+	case "":
+		groups = groups[:1]
+	case "db":
+		groups = groups[1:]
+	}
+	for _, group := range groups {
+		for _, op := range permissionOps[group] {
+			if mask&op.Bit != 0 {
+				ops = append(ops, op.Name)
+			}
+		}
+	}
+	return ops
+}
+
+// GetDataKeys lists the data keys in the registry, and the keys permitted in this service without schema, sorted by name
+func GetDataKeys() ([]*DocsOfDataKey, error) {
+	result, err := redisdb.KeyWebDataSchema.HGetAll()
+	if err != nil {
+		return nil, err
+	}
+	var now, local = time.Now().Unix(), localKeyTypes()
+	keys := map[string]*DocsOfDataKey{}
+	for _, v := range result {
+		if v == nil || v.KeyName == "" {
+			continue
+		}
+		_, isLocal := local[redisdb.KeyScope(v.KeyName)]
+		keys[redisdb.KeyScope(v.KeyName)] = &DocsOfDataKey{KeyName: v.KeyName, KeyType: v.KeyType, ValueTypeName: v.ValueTypeName, UpdateAt: v.UpdateAt,
+			Status: lib.Ternary(isLocal || v.UpdateAt >= now-20*60, ApiActive, ApiStale), TSInterface: v.TSInterface}
+	}
+	for scope, keyType := range local {
+		if _, ok := keys[scope]; !ok {
+			keys[scope] = &DocsOfDataKey{KeyName: scope, KeyType: keyType, Status: ApiActive}
+		}
+	}
+	redisdb.HttpPermissions.IterCb(func(scope string, mask uint64) {
+		if _, ok := keys[scope]; !ok {
+			keys[scope] = &DocsOfDataKey{KeyName: scope, KeyType: lib.Ternary(scope == redisdb.SystemDbKey, "db", ""), Status: ApiActive}
+		}
+		keys[scope].Permissions = PermissionsOf(keys[scope].KeyType, mask)
+	})
+	list := make([]*DocsOfDataKey, 0, len(keys))
+	for _, v := range keys {
+		if v.Permissions == nil {
+			v.Permissions = []string{}
+		}
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].KeyName < list[j].KeyName })
+	return list, nil
+}
+
+// localKeyTypes are the types of the data keys defined in this service, by key scope
+func localKeyTypes() map[string]string {
+	types := map[string]string{}
+	add := func(keyType string) func(key string) {
+		return func(key string) {
+			//the key of the maps is the scope and the redis name
+			scope, _, _ := strings.Cut(key, ":")
+			types[scope] = keyType
+		}
+	}
+	hash, str, list, set, zset, stream, vset := add("hash"), add("string"), add("list"), add("set"), add("zset"), add("stream"), add("vset")
+	redisdb.HttpHashKeyMap.IterCb(func(key string, _ redisdb.IHttpHashKey) { hash(key) })
+	redisdb.HttpStringKeyMap.IterCb(func(key string, _ redisdb.IHttpStringKey) { str(key) })
+	redisdb.HttpListKeyMap.IterCb(func(key string, _ redisdb.IHttpListKey) { list(key) })
+	redisdb.HttpSetKeyMap.IterCb(func(key string, _ redisdb.IHttpSetKey) { set(key) })
+	redisdb.HttpZSetKeyMap.IterCb(func(key string, _ redisdb.IHttpZSetKey) { zset(key) })
+	redisdb.HttpStreamKeyMap.IterCb(func(key string, _ redisdb.IHttpStreamKey) { stream(key) })
+	redisdb.HttpVectorSetKeyMap.IterCb(func(key string, _ redisdb.IHttpVectorSetKey) { vset(key) })
+	return types
+}
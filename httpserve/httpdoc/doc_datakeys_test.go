@@ -0,0 +1,26 @@
+package httpdoc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/doptime/redisdb"
+)
+
+func TestPermissionsOf(t *testing.T) {
+	//the bits of hash & list overlap, the names follow the type
+	mask := redisdb.Del | uint64(redisdb.HGet) | uint64(redisdb.HSet)
+	if got, want := PermissionsOf("hash", mask), []string{"DEL", "HGET", "HSET"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hash: got %v, want %v", got, want)
+	}
+	if got := PermissionsOf("list", uint64(redisdb.HGet)); !reflect.DeepEqual(got, []string{"RPUSH"}) {
+		t.Errorf("list: got %v", got)
+	}
+	//the type is unknown if the key is allowed without being defined
+	if got := PermissionsOf("", mask); !reflect.DeepEqual(got, []string{"DEL"}) {
+		t.Errorf("unknown type: got %v", got)
+	}
+	if got := PermissionsOf("db", uint64(redisdb.DBKeys)); !reflect.DeepEqual(got, []string{"KEYS"}) {
+		t.Errorf("db: got %v", got)
+	}
+}
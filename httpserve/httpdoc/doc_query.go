@@ -7,87 +7,72 @@ import (
 	"strings"
 	"time"
 
+	"github.com/doptime/doptime/lib"
 	"github.com/doptime/redisdb"
 )
 
 // GetApiDocs 生成基于 createApi<TIn, TOut> 的 TypeScript 代码
+// 类型由 Go 类型反射生成（注册 API 时生成并同步到 redis），嵌套的结构体生成具名 interface
+// 停止服务的 API 不会被删除，而是标注为 stale 或 removed（@deprecated）
 func GetApiDocs() (string, error) {
-	result, err := KeyApiDataDocs.HGetAll()
+	docs, _, err := registryApiDocs()
 	if err != nil {
 		return "", err
 	}
 
-	var sb strings.Builder
+	var sb, apis strings.Builder
 	// 1. 头部引入 createApi
 	sb.WriteString("import createApi from \"doptime-client\";\n\n")
 
-	var now = time.Now().Unix()
-
-	// 为了保证生成文件内容的稳定性，建议对 map 的 key 进行排序遍历
-	keys := make([]string, 0, len(result))
-	for k := range result {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	for _, k := range keys {
-		v := result[k]
+	defs := map[string]string{}
+	for _, v := range docs {
+		// 处理 API 名称，首字母大写，用于命名类型
+		apiName := strings.TrimPrefix(v.KeyName, "api:")
+		apiNamePascal := strings.ToUpper(apiName[0:1]) + apiName[1:]
+		typeInName, typeOutName := apiNamePascal+"In", apiNamePascal+"Out"
 
-		// 过滤规则：20分钟未更新则忽略
-		if v.UpdateAt < now-20*60 {
-			continue
+		// 2. 合并各 API 的 interface，同名但定义不同的 interface 以 API 名作后缀
+		in, out := "any", "any"
+		if ts := v.TypeScript; ts != nil {
+			exprs := mergeTSDefs(defs, ts.Defs, apiNamePascal, ts.In, ts.Out)
+			in, out = exprs[0], exprs[1]
 		}
-
-		// 处理 API 名称
-		apiName := strings.ReplaceAll(v.KeyName, "api:", "")
-		if len(apiName) < 1 {
-			continue
+		for _, alias := range [][2]string{{typeInName, in}, {typeOutName, out}} {
+			if alias[0] != alias[1] {
+				fmt.Fprintf(&apis, "export type %s = %s;\n", alias[0], alias[1])
+			}
 		}
-		// 首字母大写，用于命名 Interface
-		apiNamePascal := strings.ToUpper(apiName[0:1]) + apiName[1:]
-
-		// 定义接口名称
-		interfaceInName := apiNamePascal + "In"
-		interfaceOutName := apiNamePascal + "Out"
-
-		// 2. 生成 Input Interface 定义
-		// 假设 v.ParamIn 存储的是具体的数据结构或 map[string]interface{}
-		tsInterfaceIn := generateTSInterface(interfaceInName, v.ParamIn)
-		sb.WriteString(tsInterfaceIn + "\n")
-
-		// 3. 生成 Output Interface 定义
-		tsInterfaceOut := generateTSInterface(interfaceOutName, v.ParamOut)
-		sb.WriteString(tsInterfaceOut + "\n")
 
-		// 4. 生成 createApi 调用代码
+		// 3. 生成 createApi 调用代码，带上服务、版本和状态
 		// export const apiGetInfo = createApi<GetInfoIn, GetInfoOut>("getInfo");
-		sb.WriteString(fmt.Sprintf("export const api%s = createApi<%s, %s>(\"%s\");\n",
-			apiNamePascal,
-			interfaceInName,
-			interfaceOutName,
-			apiName,
-		))
-
-		sb.WriteString("\n")
+		fmt.Fprintf(&apis, "%s\n", apiStatusComment(v))
+		fmt.Fprintf(&apis, "export const api%s = createApi<%s, %s>(\"%s\");\n\n", apiNamePascal, typeInName, typeOutName, apiName)
 	}
-
+	writeTSDefs(&sb, defs)
+	sb.WriteString(apis.String())
 	return sb.String(), nil
 }
 
-// GetDataDocs 保持原有逻辑，略微调整以匹配整体风格
+// GetDataDocs 生成数据 key 的 TypeScript 代码
+// 本服务的 key 由 Go 类型反射生成，字段名与 msgpack 标签一致；其它服务的 key 使用 redisdb 生成的 interface
 func GetDataDocs() (string, error) {
 	result, err := redisdb.KeyWebDataSchema.HGetAll()
 	if err != nil {
 		return "", err
 	}
-	var ret strings.Builder
+	var ret, dataKeys strings.Builder
 	ret.WriteString("import { hashKey, stringKey, listKey, setKey, zsetKey, streamKey } from \"doptime-client\"\n\n")
 	var now = time.Now().Unix()
 
-	for k, v := range result {
-		if v.UpdateAt < now-20*60 {
-			continue
-		}
+	keys := make([]string, 0, len(result))
+	for k := range result {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	g := newTSGenerator(TagMsgpack)
+	for _, k := range keys {
+		v := result[k]
 		if len(v.KeyName) < 1 {
 			continue
 		}
@@ -95,8 +80,6 @@ func GetDataDocs() (string, error) {
 		keyWithFirstCharUpper := strings.ToUpper(v.KeyName[0:1]) + v.KeyName[1:]
 		keyWithFirstCharUpper = strings.Split(keyWithFirstCharUpper, ":")[0]
 
-		ret.WriteString(v.TSInterface + "\n")
-
 		// 使用 switch case 稍微整洁一点
 		var classType string
 		switch v.KeyType {
@@ -116,109 +99,55 @@ func GetDataDocs() (string, error) {
 			continue
 		}
 
-		ret.WriteString(fmt.Sprintf("export const key%s = new %s<%s>(\"%s\");\n\n",
-			keyWithFirstCharUpper, classType, v.ValueTypeName, k))
+		valueTypeName := v.ValueTypeName
+		if valueType, ok := localValueType(v.KeyName); ok {
+			valueTypeName = g.typeOf(valueType)
+		} else {
+			ret.WriteString(v.TSInterface + "\n\n")
+		}
+		// 超过 20 分钟未同步的 key 标注为 stale，而不是删除
+		if v.UpdateAt < now-20*60 {
+			fmt.Fprintf(&dataKeys, "/** stale: not synced since %s */\n", time.Unix(v.UpdateAt, 0).UTC().Format(time.RFC3339))
+		}
+		fmt.Fprintf(&dataKeys, "export const key%s = new %s<%s>(\"%s\");\n\n", keyWithFirstCharUpper, classType, valueTypeName, k)
 	}
+	writeTSDefs(&ret, g.defs)
+	ret.WriteString(dataKeys.String())
 	return ret.String(), nil
 }
 
-// --- 辅助工具函数 ---
-
-// generateTSInterface 通过反射将 Go 的结构/Map 值转换为 TypeScript interface 字符串
-func generateTSInterface(interfaceName string, val interface{}) string {
-	if val == nil {
-		return fmt.Sprintf("export type %s = any;", interfaceName)
-	}
-
-	t := reflect.TypeOf(val)
-	v := reflect.ValueOf(val)
-
-	// 如果是指针，获取其指向的元素
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
-		v = v.Elem()
-	}
-
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("export interface %s {\n", interfaceName))
-
-	// 处理 Map (通常 JSON 反序列化后是 map[string]interface{})
-	if t.Kind() == reflect.Map {
-		iter := v.MapRange()
-		for iter.Next() {
-			key := iter.Key().String()
-			val := iter.Value().Interface()
-			tsType := getTSType(val)
-			sb.WriteString(fmt.Sprintf("    %s: %s;\n", key, tsType))
-		}
-	} else if t.Kind() == reflect.Struct {
-		// 处理 Struct
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
-			// 忽略未导出的字段
-			if field.PkgPath != "" {
-				continue
-			}
-
-			jsonTag := field.Tag.Get("json")
-			fieldName := field.Name
-			if jsonTag != "" {
-				parts := strings.Split(jsonTag, ",")
-				if parts[0] == "-" {
-					continue
-				}
-				if parts[0] != "" {
-					fieldName = parts[0]
-				}
-			}
-
-			// 获取字段值的类型
-			fieldVal := v.Field(i).Interface()
-			tsType := getTSType(fieldVal)
-			sb.WriteString(fmt.Sprintf("    %s: %s;\n", fieldName, tsType))
+// localValueType is the value type of the data key defined in this service, by the key name without ":" part
+func localValueType(keyName string) (reflect.Type, bool) {
+	scope := redisdb.KeyScope(keyName) + ":"
+	var found reflect.Type
+	find := func(key string, value interface{ GetValue() interface{} }) {
+		if found == nil && strings.HasPrefix(key, scope) {
+			found = reflect.TypeOf(value.GetValue())
 		}
-	} else {
-		// 如果既不是 Map 也不是 Struct，可能是基本类型，直接用 type 别名
-		return fmt.Sprintf("export type %s = %s;", interfaceName, getTSType(val))
 	}
-
-	sb.WriteString("}")
-	return sb.String()
+	redisdb.HttpHashKeyMap.IterCb(func(key string, v redisdb.IHttpHashKey) { find(key, v) })
+	redisdb.HttpStringKeyMap.IterCb(func(key string, v redisdb.IHttpStringKey) { find(key, v) })
+	redisdb.HttpListKeyMap.IterCb(func(key string, v redisdb.IHttpListKey) { find(key, v) })
+	redisdb.HttpSetKeyMap.IterCb(func(key string, v redisdb.IHttpSetKey) { find(key, v) })
+	redisdb.HttpZSetKeyMap.IterCb(func(key string, v redisdb.IHttpZSetKey) { find(key, v) })
+	redisdb.HttpStreamKeyMap.IterCb(func(key string, v redisdb.IHttpStreamKey) { find(key, v) })
+	return found, found != nil
 }
 
-// getTSType 简单的类型映射辅助函数
-func getTSType(val interface{}) string {
-	if val == nil {
-		return "any"
+// apiStatusComment is the comment of the service, version & status of the api. the removed api is @deprecated
+func apiStatusComment(v *DocsOfApi) string {
+	service := lib.Ternary(v.Service == "", "unknown service", "service "+v.Service)
+	if v.Version != "" {
+		service += " " + v.Version
 	}
-	t := reflect.TypeOf(val)
-	k := t.Kind()
-
-	switch k {
-	case reflect.Bool:
-		return "boolean"
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
-		reflect.Float32, reflect.Float64:
-		return "number"
-	case reflect.String:
-		return "string"
-	case reflect.Slice, reflect.Array:
-		// 处理数组/切片
-		v := reflect.ValueOf(val)
-		if v.Len() > 0 {
-			// 取第一个元素推断类型 (简单处理)
-			elemType := getTSType(v.Index(0).Interface())
-			return elemType + "[]"
+	switch v.Status {
+	case ApiActive:
+		if len(v.Instances) == 0 {
+			return fmt.Sprintf("/** %s, active */", service)
 		}
-		return "any[]"
-	case reflect.Map:
-		// 嵌套对象简单处理为 any，如果需要深度递归，可以在这里递归调用 generateTSInterface 的逻辑
-		// 但为了生成的简洁性，如果不生成嵌套 interface，用 Record 或 object 替代
-		return "Record<string, any>"
-	case reflect.Struct:
-		return "Record<string, any>"
-	default:
-		return "any"
+		return fmt.Sprintf("/** %s, active on %d instance(s) */", service, len(v.Instances))
+	case ApiRemoved:
+		return fmt.Sprintf("/** @deprecated removed from %s */", service)
 	}
+	return fmt.Sprintf("/** stale: no live instance of %s since %s */", service, time.Unix(v.UpdateAt, 0).UTC().Format(time.RFC3339))
 }
@@ -2,13 +2,22 @@ package httpdoc
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/doptime/config/cfgredis"
+	"github.com/doptime/logger"
 	"github.com/doptime/redisdb"
 	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/redis/go-redis/v9"
 	"github.com/vmihailenco/msgpack/v5"
 )
 
@@ -16,24 +25,80 @@ type DocsOfApi struct {
 	KeyName  string
 	ParamIn  interface{}
 	ParamOut interface{}
-	UpdateAt int64
+	// SchemaIn & SchemaOut are the JSON Schema of the types, so that the apis of other services are documented too.
+	// SchemaOutMsgpack is of the result encoded in msgpack, the field names follow the msgpack tag
+	SchemaIn         *Schema
+	SchemaOut        *Schema
+	SchemaOutMsgpack *Schema
+	// TypeScript is generated from the types, rather than ParamIn & ParamOut, which are sample values
+	TypeScript *TSTypes
+	UpdateAt   int64
+
+	// Service & Version are of the service publishing the doc. Hash is the digest of the schemas, which differs between versions of the api.
+	// Instance & StartAt are of the publishing instance, the doc published by the latest started instance is kept
+	Service  string
+	Version  string
+	Hash     string
+	Instance string
+	StartAt  int64
+
+	// Status & Instances are filled when queried: the status of the api, and the live instances serving it
+	Status    string   `msgpack:"-"`
+	Instances []string `msgpack:"-"`
+
+	// the types of the local api, for the client sdk generators
+	paramInType, paramOutType reflect.Type
 }
 
 var KeyApiDataDocs = redisdb.NewHashKey[string, *DocsOfApi](redisdb.Opt.Key("Docs:Api"))
 
 var ApiDocsMap cmap.ConcurrentMap[string, *DocsOfApi] = cmap.New[*DocsOfApi]()
 
+// Service & Version name the service in the doc registry, overwritten by [Api] Service / Version in toml.
+// Instance is unique among replicas, the same as the stream consumer of the apis
+var (
+	Service  = strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	Version  = ""
+	Instance = func() string {
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			hostname = "doptime"
+		}
+		return hostname + "-" + strconv.Itoa(os.Getpid())
+	}()
+)
+
+// DocsHeartbeat is the interval the docs & the heartbeat of the instance are published to every redis.
+// the instance without heartbeat for 3 intervals is regarded as dead; it's removed from the registry after DocsRetention
+var (
+	DocsHeartbeat = time.Second * 30
+	DocsRetention = time.Hour * 24 * 7
+)
+
+var startAt = time.Now().Unix()
+
 var SynAPIRunOnce = sync.Mutex{}
 
+// docsChanged wakes the sync, so that the api registered later is published without waiting the heartbeat
+var docsChanged = make(chan struct{}, 1)
+
 func RegisterApi(Name string, paramInType reflect.Type, paramOutType reflect.Type) (err error) {
 	_, ok := ApiDocsMap.Get(Name)
 	if ok {
 		return nil
 	}
 	webdata := &DocsOfApi{
-		KeyName:  Name,
-		UpdateAt: time.Now().Unix(),
+		KeyName:          Name,
+		SchemaIn:         SchemaOf(paramInType),
+		SchemaOut:        SchemaOf(paramOutType),
+		SchemaOutMsgpack: MsgpackSchemaOf(paramOutType),
+		TypeScript:       TypeScriptOf(paramInType, paramOutType),
+		UpdateAt:         time.Now().Unix(),
+
+		paramInType:  paramInType,
+		paramOutType: paramOutType,
 	}
+	webdata.Hash = hashOfSchemas(webdata.SchemaIn, webdata.SchemaOut, webdata.SchemaOutMsgpack)
 
 	//vType := reflect.TypeOf((*i)(nil)).Elem()
 	if webdata.ParamIn, err = InstantiateType(paramInType); err != nil {
@@ -44,33 +109,89 @@ func RegisterApi(Name string, paramInType reflect.Type, paramOutType reflect.Typ
 		return err
 	}
 	ApiDocsMap.Set(Name, webdata)
+	select {
+	case docsChanged <- struct{}{}:
+	default:
+	}
 	if SynAPIRunOnce.TryLock() {
 		go syncWithRedis()
 	}
 	return nil
 }
 
+func hashOfSchemas(schemas ...*Schema) string {
+	bs, _ := json.Marshal(schemas)
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:8])
+}
+
 func syncWithRedis() {
 	//wait arrival of other schema to be store in map
 	time.Sleep(time.Second)
+	ticker := time.NewTicker(DocsHeartbeat)
+	defer ticker.Stop()
 	for {
-		now := time.Now().Unix()
+		for rdsName, client := range cfgredis.Servers.Items() {
+			if err := publishDocs(context.Background(), client); err != nil {
+				logger.Warn().Err(err).Str("rds", rdsName).Msg("publish api docs failed")
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-docsChanged:
+			time.Sleep(time.Second)
+		}
+	}
+}
 
-		client, ok := cfgredis.Servers.Get("default")
-		if !ok || (ApiDocsMap.Count() == 0) {
-			time.Sleep(time.Minute)
+// publishDocs writes the heartbeat of the instance, and the docs of the apis, to the redis.
+// the doc of other version is overwritten only if it's published by an earlier started or dead instance
+func publishDocs(ctx context.Context, client *redis.Client) error {
+	now := time.Now().Unix()
+	instances, err := hGetAllMsgpack[DocsOfInstance](ctx, client, "Docs:Instance")
+	if err != nil {
+		return err
+	}
+	published, err := hGetAllMsgpack[DocsOfApi](ctx, client, "Docs:Api")
+	if err != nil {
+		return err
+	}
+	self := &DocsOfInstance{Instance: Instance, Service: Service, Version: Version, StartAt: startAt, HeartbeatAt: now, Apis: map[string]string{}}
+	pipe := client.Pipeline()
+	for name, doc := range ApiDocsMap.Items() {
+		self.Apis[name] = doc.Hash
+		if exist := published[name]; exist != nil && exist.Hash != doc.Hash && exist.StartAt > startAt && instances[exist.Instance].isLive(now) {
 			continue
 		}
-		clientpiepie := client.Pipeline()
-		if ok && ApiDocsMap.Count() > 0 {
-			ApiDocsMap.IterCb(func(key string, value *DocsOfApi) {
-				value.UpdateAt = now
-				if bs, err := msgpack.Marshal(value); err == nil {
-					clientpiepie.HSet(context.Background(), "Docs:Api", value.KeyName, string(bs)).Err()
-				}
-			})
+		v := *doc
+		v.UpdateAt, v.Service, v.Version, v.Instance, v.StartAt = now, Service, Version, Instance, startAt
+		if bs, err := msgpack.Marshal(&v); err == nil {
+			pipe.HSet(ctx, "Docs:Api", name, string(bs))
+		}
+	}
+	if bs, err := msgpack.Marshal(self); err == nil {
+		pipe.HSet(ctx, "Docs:Instance", Instance, string(bs))
+	}
+	for name, instance := range instances {
+		if instance == nil || instance.HeartbeatAt < now-int64(DocsRetention/time.Second) {
+			pipe.HDel(ctx, "Docs:Instance", name)
+		}
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func hGetAllMsgpack[T any](ctx context.Context, client *redis.Client, key string) (map[string]*T, error) {
+	values, err := client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*T, len(values))
+	for field, value := range values {
+		var v T
+		if msgpack.Unmarshal([]byte(value), &v) == nil {
+			result[field] = &v
 		}
-		clientpiepie.Exec(context.Background())
-		time.Sleep(time.Minute * 10)
 	}
+	return result, nil
 }
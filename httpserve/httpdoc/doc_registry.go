@@ -0,0 +1,128 @@
+package httpdoc
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/doptime/redisdb"
+)
+
+// the status of the api in the registry
+const (
+	// ApiActive is served by live instances
+	ApiActive = "active"
+	// ApiStale is not served by any live instance, i.g. the service is down, or missed the heartbeats
+	ApiStale = "stale"
+	// ApiRemoved is no longer served by the live instances of its service
+	ApiRemoved = "removed"
+)
+
+// DocsOfInstance is the heartbeat of an instance of the service, with the apis it serves: name to hash of the schemas
+type DocsOfInstance struct {
+	Instance    string
+	Service     string
+	Version     string
+	StartAt     int64
+	HeartbeatAt int64
+	Apis        map[string]string
+}
+
+func (i *DocsOfInstance) isLive(now int64) bool {
+	return i != nil && i.HeartbeatAt >= now-int64(3*DocsHeartbeat/time.Second)
+}
+
+// DocsOfService is a service in the registry, with its instances and apis
+type DocsOfService struct {
+	Service   string
+	Versions  []string
+	Instances []*DocsOfInstance
+	Apis      []*DocsOfApi
+}
+
+var KeyApiInstanceDocs = redisdb.NewHashKey[string, *DocsOfInstance](redisdb.Opt.Key("Docs:Instance"))
+
+// registryApiDocs are the docs of the apis in the registry, with the status & live instances filled. sorted by name.
+// the docs are kept after the services stop, as stale or removed
+func registryApiDocs() (docs []*DocsOfApi, instances map[string]*DocsOfInstance, err error) {
+	result, err := KeyApiDataDocs.HGetAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if instances, err = KeyApiInstanceDocs.HGetAll(); err != nil {
+		return nil, nil, err
+	}
+	var now = time.Now().Unix()
+	live := make([]*DocsOfInstance, 0, len(instances))
+	for _, instance := range instances {
+		if instance.isLive(now) {
+			live = append(live, instance)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].Instance < live[j].Instance })
+	for _, v := range result {
+		if v == nil || len(v.KeyName) <= len("api:") {
+			continue
+		}
+		v.Status, v.Instances = ApiStale, nil
+		serviceLive := false
+		for _, instance := range live {
+			if _, ok := instance.Apis[v.KeyName]; ok {
+				v.Instances = append(v.Instances, instance.Instance)
+			} else if instance.Service == v.Service {
+				serviceLive = true
+			}
+		}
+		switch {
+		case len(v.Instances) > 0:
+			v.Status = ApiActive
+		//the doc published without heartbeat, by the earlier doptime, is refreshed every 10 minutes
+		case v.Service == "" && v.UpdateAt >= now-20*60:
+			v.Status = ApiActive
+		case serviceLive:
+			v.Status = ApiRemoved
+		}
+		docs = append(docs, v)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].KeyName < docs[j].KeyName })
+	return docs, instances, nil
+}
+
+// GetApiRegistry lists the services in the registry, with the versions & instances, and the apis with status
+func GetApiRegistry() ([]*DocsOfService, error) {
+	docs, instances, err := registryApiDocs()
+	if err != nil {
+		return nil, err
+	}
+	services := map[string]*DocsOfService{}
+	serviceOf := func(name string) *DocsOfService {
+		if _, ok := services[name]; !ok {
+			services[name] = &DocsOfService{Service: name, Versions: []string{}, Instances: []*DocsOfInstance{}, Apis: []*DocsOfApi{}}
+		}
+		return services[name]
+	}
+	for _, doc := range docs {
+		s := serviceOf(doc.Service)
+		s.Apis = append(s.Apis, doc)
+	}
+	now := time.Now().Unix()
+	for _, instance := range instances {
+		if !instance.isLive(now) {
+			continue
+		}
+		s := serviceOf(instance.Service)
+		s.Instances = append(s.Instances, instance)
+		if instance.Version != "" {
+			s.Versions = append(s.Versions, instance.Version)
+		}
+	}
+	list := make([]*DocsOfService, 0, len(services))
+	for _, s := range services {
+		sort.Slice(s.Instances, func(i, j int) bool { return s.Instances[i].Instance < s.Instances[j].Instance })
+		sort.Strings(s.Versions)
+		s.Versions = slices.Compact(s.Versions)
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Service < list[j].Service })
+	return list, nil
+}
@@ -0,0 +1,150 @@
+package httpdoc
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/doptime/doptime/lib"
+	"github.com/doptime/doptime/vars"
+)
+
+// OpenApiInfo is the info object of the OpenAPI document
+var OpenApiInfo = struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}{Title: "doptime", Version: "1.0.0"}
+
+type openApiDoc struct {
+	OpenApi    string                 `json:"openapi"`
+	Info       interface{}            `json:"info"`
+	Paths      map[string]interface{} `json:"paths"`
+	Components openApiComponents      `json:"components"`
+	// the jwt is optional to the document, the apis with @claims in input require it
+	Security []map[string][]string `json:"security"`
+}
+
+type openApiComponents struct {
+	Schemas         map[string]*Schema     `json:"schemas"`
+	SecuritySchemes map[string]interface{} `json:"securitySchemes"`
+}
+
+// GetOpenApiDocs generates the OpenAPI 3.1 document of the apis, from the schemas in the doc registry
+func GetOpenApiDocs() (string, error) {
+	docs, _, err := registryApiDocs()
+	if err != nil {
+		return "", err
+	}
+	doc := openApiDoc{
+		OpenApi: "3.1.0",
+		Info:    OpenApiInfo,
+		Paths:   map[string]interface{}{},
+		Components: openApiComponents{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+		Security: []map[string][]string{{"bearerAuth": {}}, {}},
+	}
+	//the error envelope is the def ApiError
+	origins := map[string]string{}
+	hoistDefs(SchemaOf(reflect.TypeOf(vars.ApiError{})), "error", doc.Components.Schemas, origins)
+	for _, v := range docs {
+		name := strings.TrimPrefix(v.KeyName, "api:")
+		in, out := hoistDefs(v.SchemaIn, name, doc.Components.Schemas, origins), hoistDefs(v.SchemaOut, name, doc.Components.Schemas, origins)
+		//the docs of the older instances have no msgpack schema, the response is then documented as json only
+		var outMsgpack *Schema
+		if v.SchemaOutMsgpack != nil {
+			outMsgpack = hoistDefs(v.SchemaOutMsgpack, name+"_msgpack", doc.Components.Schemas, origins)
+		}
+		operation := openApiOperation(name, in, out, outMsgpack)
+		//the registry info, the removed api is deprecated
+		operation["x-doptime-service"], operation["x-doptime-version"], operation["x-doptime-status"] = v.Service, v.Version, v.Status
+		operation["x-doptime-instances"] = lib.Ternary(v.Instances == nil, []string{}, v.Instances)
+		if v.Status == ApiRemoved {
+			operation["deprecated"] = true
+		}
+		doc.Paths["/"+name] = map[string]interface{}{"post": operation}
+	}
+	bs, err := json.MarshalIndent(doc, "", "  ")
+	return string(bs), err
+}
+
+// openApiOperation is the operation of the api. the msgpack response is documented if outMsgpack is given
+func openApiOperation(name string, in, out, outMsgpack *Schema) map[string]interface{} {
+	if in == nil {
+		in = &Schema{}
+	}
+	if out == nil {
+		out = &Schema{}
+	}
+	errorContent := map[string]interface{}{"application/json": map[string]interface{}{"schema": &Schema{Ref: "#/components/schemas/ApiError"}}}
+	outContent := map[string]interface{}{"application/json": map[string]interface{}{"schema": out}}
+	if outMsgpack != nil {
+		outContent["application/msgpack"] = map[string]interface{}{"schema": outMsgpack}
+	}
+	return map[string]interface{}{
+		"operationId": name,
+		"parameters": []map[string]interface{}{
+			{"name": "rt", "in": "query", "description": "response content type, i.g. application/msgpack", "schema": &Schema{Type: "string"}},
+			{"name": "Idempotency-Key", "in": "header", "description": "the call with the same key is executed once", "schema": &Schema{Type: "string"}},
+		},
+		"requestBody": map[string]interface{}{
+			"description": "json, or msgpack as application/octet-stream",
+			"content": map[string]interface{}{
+				"application/json":         map[string]interface{}{"schema": in},
+				"application/octet-stream": map[string]interface{}{"schema": in},
+			},
+		},
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "ok",
+				"content":     outContent,
+			},
+			"default": map[string]interface{}{"description": "error", "content": errorContent},
+		},
+	}
+}
+
+// hoistDefs moves the $defs of s to components, the refs are rewritten. s is copied, the registry is unchanged.
+// origins is the json of the defs in components, a def differing from the one of the same name is renamed with suffix of apiName
+func hoistDefs(s *Schema, apiName string, components map[string]*Schema, origins map[string]string) *Schema {
+	if s == nil {
+		return nil
+	}
+	renamed, origin := map[string]string{}, map[string]string{}
+	for name, def := range s.Defs {
+		bs, _ := json.Marshal(def)
+		renamed[name], origin[name] = name, string(bs)
+		if exist, ok := origins[name]; ok && exist != origin[name] {
+			renamed[name] = name + "_" + apiName
+		}
+	}
+	for name, def := range s.Defs {
+		components[renamed[name]], origins[renamed[name]] = rewriteRefs(def, renamed), origin[name]
+	}
+	s = rewriteRefs(s, renamed)
+	s.Defs = nil
+	return s
+}
+
+// rewriteRefs copies s, with the refs to $defs rewritten to the (renamed) components
+func rewriteRefs(s *Schema, renamed map[string]string) *Schema {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	if name, ok := strings.CutPrefix(c.Ref, "#/$defs/"); ok {
+		c.Ref = "#/components/schemas/" + renamed[name]
+	}
+	if len(s.Properties) > 0 {
+		c.Properties = make(map[string]*Schema, len(s.Properties))
+		for k, p := range s.Properties {
+			c.Properties[k] = rewriteRefs(p, renamed)
+		}
+	}
+	c.Items, c.AdditionalProperties = rewriteRefs(s.Items, renamed), rewriteRefs(s.AdditionalProperties, renamed)
+	return &c
+}
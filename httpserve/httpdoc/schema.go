@@ -0,0 +1,348 @@
+package httpdoc
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the JSON Schema (draft 2020-12, as used by OpenAPI 3.1) of the api types.
+// the named structs are in Defs of the root schema, referred as "#/$defs/Name"
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty" msgpack:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty" msgpack:"type,omitempty"`
+	Format               string             `json:"format,omitempty" msgpack:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty" msgpack:"contentEncoding,omitempty"`
+	Description          string             `json:"description,omitempty" msgpack:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty" msgpack:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty" msgpack:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty" msgpack:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty" msgpack:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty" msgpack:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty" msgpack:"default,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty" msgpack:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty" msgpack:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty" msgpack:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty" msgpack:"exclusiveMaximum,omitempty"`
+	MinLength            *int64             `json:"minLength,omitempty" msgpack:"minLength,omitempty"`
+	MaxLength            *int64             `json:"maxLength,omitempty" msgpack:"maxLength,omitempty"`
+	MinItems             *int64             `json:"minItems,omitempty" msgpack:"minItems,omitempty"`
+	MaxItems             *int64             `json:"maxItems,omitempty" msgpack:"maxItems,omitempty"`
+	MinProperties        *int64             `json:"minProperties,omitempty" msgpack:"minProperties,omitempty"`
+	MaxProperties        *int64             `json:"maxProperties,omitempty" msgpack:"maxProperties,omitempty"`
+	UniqueItems          bool               `json:"uniqueItems,omitempty" msgpack:"uniqueItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty" msgpack:"pattern,omitempty"`
+	// ReadOnly marks the input fields filled by the server, i.g. `json:"@@sub"` from jwt
+	ReadOnly bool               `json:"readOnly,omitempty" msgpack:"readOnly,omitempty"`
+	Defs     map[string]*Schema `json:"$defs,omitempty" msgpack:"$defs,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf builds the JSON Schema of the type, the field names follow the json tag, as mapper decodes the params and encodes the json result
+func SchemaOf(t reflect.Type) *Schema {
+	return schemaOfTag(t, TagJson)
+}
+
+// MsgpackSchemaOf builds the schema of the type encoded in msgpack, the field names follow the msgpack tag, or the go name if untagged
+func MsgpackSchemaOf(t reflect.Type) *Schema {
+	return schemaOfTag(t, TagMsgpack)
+}
+
+func schemaOfTag(t reflect.Type, tag string) *Schema {
+	b := &schemaBuilder{tag: tag, defs: map[string]*Schema{}, names: map[reflect.Type]string{}}
+	s := b.schemaOf(t)
+	if len(b.defs) > 0 {
+		s.Defs = b.defs
+	}
+	return s
+}
+
+type schemaBuilder struct {
+	tag   string
+	defs  map[string]*Schema
+	names map[reflect.Type]string
+}
+
+func (b *schemaBuilder) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == reflect.TypeOf(time.Duration(0)):
+		return &Schema{Type: "integer", Format: "int64", Description: "nanoseconds"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: "integer", Minimum: &zero}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &Schema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		//named structs are defined once, so that recursive types end
+		name, ok := b.names[t]
+		if !ok {
+			name = b.defName(t)
+			b.names[t] = name
+			b.defs[name] = &Schema{}
+			*b.defs[name] = *b.structSchema(t)
+		}
+		return &Schema{Ref: "#/$defs/" + name}
+	}
+	//interface & others accept any value
+	return &Schema{}
+}
+
+// defName is the name of the struct, qualified by package if another struct has the same name,
+// then suffixed by counter if still taken, i.g. Page[A], Page[B], Page[C] are Page, pkg.Page, pkg.Page2
+func (b *schemaBuilder) defName(t reflect.Type) string {
+	name := t.Name()
+	if i := strings.IndexByte(name, '['); i > 0 {
+		name = name[:i]
+	}
+	if _, taken := b.defs[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndexByte(pkg, '/')+1:] + "." + name
+	}
+	for i, base := 2, name; ; i++ {
+		if _, taken := b.defs[name]; !taken {
+			return name
+		}
+		name = base + strconv.Itoa(i)
+	}
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.addFields(s, t)
+	return s
+}
+
+// addFields adds the exported fields of t to s. embedded structs without name are flattened, as the decoder accepts
+func (b *schemaBuilder) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		//the embedded struct of unexported type has exported fields
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, directive := FieldName(field)
+		if b.tag == TagMsgpack {
+			name, directive = msgpackFieldName(field), ""
+		}
+		if name == "-" {
+			continue
+		}
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && field.Tag.Get(b.tag) == "" && fieldType.Kind() == reflect.Struct && fieldType != timeType {
+			b.addFields(s, fieldType)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldSchema := b.schemaOf(field.Type)
+		if description := field.Tag.Get("description"); description != "" {
+			fieldSchema.Description = description
+		}
+		//"@@sub" refers to the param "@sub" filled by the server, "@8080" is the default value
+		if fieldSchema.ReadOnly = strings.HasPrefix(directive, "@@"); !fieldSchema.ReadOnly && len(directive) > 1 {
+			fieldSchema.Default = defaultValue(fieldType, directive[1:])
+		}
+		if applyValidateTag(fieldSchema, fieldType, field.Tag.Get("validate")) && directive == "" {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fieldSchema
+	}
+}
+
+// FieldName is the name of the field in json, by the json tag or the lower case field name, as mapper does.
+// directive is the "@" part of the tag, i.g. "@8080" as default value, or "@@sub" refers to the jwt field
+func FieldName(field reflect.StructField) (name string, directive string) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "-", ""
+	}
+	for i, part := range strings.Fields(tag) {
+		if strings.HasPrefix(part, "@") {
+			directive = part
+		} else if candidate, _, _ := strings.Cut(part, ","); i == 0 && candidate != "" {
+			name = candidate
+		}
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, directive
+}
+
+// msgpackFieldName is the name of the field encoded by msgpack: the msgpack tag, or the go name
+func msgpackFieldName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get(TagMsgpack), ","); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// applyValidateTag maps the validate tag of go-playground/validator to the constraints of s. t is the field type without pointer.
+// rules after "dive" apply to the items. required is true if the field is required
+func applyValidateTag(s *Schema, t reflect.Type, tag string) (required bool) {
+	if tag == "" || tag == "-" {
+		return false
+	}
+	rules := strings.Split(tag, ",")
+	for i, rule := range rules {
+		if rule == "dive" {
+			if item := itemSchemaOf(s); item != nil {
+				itemType := t.Elem()
+				for itemType.Kind() == reflect.Ptr {
+					itemType = itemType.Elem()
+				}
+				applyValidateTag(item, itemType, strings.Join(rules[i+1:], ","))
+			}
+			break
+		}
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "min", "gte":
+			setBound(s, t, param, true, false)
+		case "max", "lte":
+			setBound(s, t, param, false, false)
+		case "gt":
+			setBound(s, t, param, true, true)
+		case "lt":
+			setBound(s, t, param, false, true)
+		case "len":
+			setBound(s, t, param, true, false)
+			setBound(s, t, param, false, false)
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				s.Enum = append(s.Enum, enumValue(t, value))
+			}
+		case "email":
+			s.Format = "email"
+		case "url", "uri", "http_url":
+			s.Format = "uri"
+		case "uuid", "uuid4":
+			s.Format = "uuid"
+		case "ipv4", "ipv6", "hostname":
+			s.Format = name
+		case "alpha":
+			s.Pattern = "^[a-zA-Z]+$"
+		case "alphanum":
+			s.Pattern = "^[a-zA-Z0-9]+$"
+		case "numeric":
+			s.Pattern = `^[-+]?[0-9]+(?:\.[0-9]+)?$`
+		case "unique":
+			s.UniqueItems = true
+		}
+	}
+	return required
+}
+
+// itemSchemaOf is the schema of the items of array or map, it's created for each field, so the constraints are not shared
+func itemSchemaOf(s *Schema) *Schema {
+	if s.Items != nil {
+		return s.Items
+	}
+	return s.AdditionalProperties
+}
+
+// setBound sets the lower or upper bound of s: the length of string, the size of array & map, or the value of number
+func setBound(s *Schema, t reflect.Type, param string, lower, exclusive bool) {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		n, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return
+		}
+		if exclusive && lower {
+			n++
+		} else if exclusive {
+			n--
+		}
+		switch {
+		case t.Kind() == reflect.String || s.ContentEncoding != "":
+			s.MinLength, s.MaxLength = pick(lower, &n, s.MinLength, s.MaxLength)
+		case t.Kind() == reflect.Map:
+			s.MinProperties, s.MaxProperties = pick(lower, &n, s.MinProperties, s.MaxProperties)
+		default:
+			s.MinItems, s.MaxItems = pick(lower, &n, s.MinItems, s.MaxItems)
+		}
+	default:
+		f, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return
+		}
+		switch {
+		case lower && exclusive:
+			s.ExclusiveMinimum = &f
+		case lower:
+			s.Minimum = &f
+		case exclusive:
+			s.ExclusiveMaximum = &f
+		default:
+			s.Maximum = &f
+		}
+	}
+}
+
+func pick(lower bool, n, min, max *int64) (*int64, *int64) {
+	if lower {
+		return n, max
+	}
+	return min, n
+}
+
+// defaultValue is the literal of the default directive, as the type of the field
+func defaultValue(t reflect.Type, value string) interface{} {
+	if t.Kind() == reflect.Bool {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return enumValue(t, value)
+}
+
+func enumValue(t reflect.Type, value string) interface{} {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return value
+}
@@ -0,0 +1,112 @@
+package httpdoc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/doptime/doptime/utils/mapper"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestSchemaOf_ValidateTags(t *testing.T) {
+	type Node struct {
+		Name     string  `json:"name" validate:"required,min=2,max=8"`
+		Children []*Node `json:"children"`
+	}
+	type Input struct {
+		UserId string   `json:"userId @@sub"`
+		Port   int      `json:"port @8080"`
+		Email  string   `validate:"required,email"`
+		Age    int      `json:"age" validate:"gte=0,lt=150"`
+		Kind   string   `validate:"oneof=a b"`
+		Tags   []string `validate:"max=3,dive,alphanum"`
+		Root   *Node
+	}
+	s := SchemaOf(reflect.TypeOf(Input{}))
+	in := s.Defs["Input"]
+	if s.Ref != "#/$defs/Input" || in == nil {
+		t.Fatalf("named struct should be in $defs, got %+v", s)
+	}
+	props := in.Properties
+	if !props["userId"].ReadOnly || props["port"].Default != int64(8080) {
+		t.Errorf("directives not mapped: %+v %+v", props["userId"], props["port"])
+	}
+	if !reflect.DeepEqual(in.Required, []string{"email"}) || props["email"].Format != "email" {
+		t.Errorf("required & format not mapped: %v %+v", in.Required, props["email"])
+	}
+	if age := props["age"]; *age.Minimum != 0 || *age.ExclusiveMaximum != 150 {
+		t.Errorf("number bounds not mapped: %+v", age)
+	}
+	if !reflect.DeepEqual(props["kind"].Enum, []interface{}{"a", "b"}) {
+		t.Errorf("oneof not mapped: %v", props["kind"].Enum)
+	}
+	if tags := props["tags"]; *tags.MaxItems != 3 || tags.Items.Pattern == "" {
+		t.Errorf("array bounds or dive not mapped: %+v", tags)
+	}
+	if node := s.Defs["Node"]; node == nil || *node.Properties["name"].MinLength != 2 || node.Properties["children"].Items.Ref != "#/$defs/Node" {
+		t.Errorf("recursive struct not mapped: %+v", node)
+	}
+}
+
+type page[T any] struct {
+	Items []T `json:"items"`
+}
+
+func TestSchemaOf_GenericNames(t *testing.T) {
+	type Pages struct {
+		A page[int]
+		B page[string]
+		C page[bool]
+	}
+	s := SchemaOf(reflect.TypeOf(Pages{}))
+	//the instantiations of the same generic type are defined separately
+	refs := map[string]bool{}
+	for _, field := range []string{"a", "b", "c"} {
+		ref := s.Defs["Pages"].Properties[field].Ref
+		name := ref[len("#/$defs/"):]
+		if refs[ref] || s.Defs[name] == nil {
+			t.Fatalf("the def of %s should be unique, got %s", field, ref)
+		}
+		refs[ref] = true
+	}
+	if items := s.Defs[s.Defs["Pages"].Properties["c"].Ref[len("#/$defs/"):]].Properties["items"].Items; items.Type != "boolean" {
+		t.Errorf("page[bool] should keep its items type, got %+v", items)
+	}
+}
+
+func TestSchemaOf_OutputNames(t *testing.T) {
+	type Out struct {
+		Name  string
+		Count int `json:"total" msgpack:"count"`
+	}
+	//the json names are the keys of the json result, the msgpack names the keys of the msgpack result
+	bs, err := mapper.Marshal(Out{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := map[string]interface{}{}
+	if err = json.Unmarshal(bs, &encoded); err != nil {
+		t.Fatal(err)
+	}
+	props := SchemaOf(reflect.TypeOf(Out{})).Defs["Out"].Properties
+	for key := range encoded {
+		if props[key] == nil {
+			t.Errorf("json key %q not in the schema %v", key, props)
+		}
+	}
+	bs, _ = msgpack.Marshal(Out{})
+	decoded := map[string]interface{}{}
+	if err = msgpack.Unmarshal(bs, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	props = MsgpackSchemaOf(reflect.TypeOf(Out{})).Defs["Out"].Properties
+	for key := range decoded {
+		if props[key] == nil {
+			t.Errorf("msgpack key %q not in the schema %v", key, props)
+		}
+	}
+	if len(props) != len(decoded) {
+		t.Errorf("msgpack schema %v, want the keys of %v", props, decoded)
+	}
+}
@@ -0,0 +1,274 @@
+package httpdoc
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/doptime/vars"
+)
+
+// the languages of the client sdk
+const (
+	SdkPython = "python"
+	SdkGo     = "go"
+	SdkDart   = "dart"
+)
+
+// GetClientSdk generates the typed client stubs of the apis of this service, in python, go or dart.
+// the stubs call the api by http (/API-!name-!rt~application%2Fmsgpack), or by the redis stream as rpc does.
+// pkg is the package name of the go client
+func GetClientSdk(lang string, pkg string) (string, error) {
+	m := newSdkModel()
+	switch strings.ToLower(lang) {
+	case SdkPython:
+		return m.python(), nil
+	case SdkGo, "golang":
+		if pkg == "" {
+			pkg = "client"
+		}
+		return m.golang(pkg), nil
+	case SdkDart, "flutter":
+		return m.dart(), nil
+	}
+	return "", fmt.Errorf("unsupported sdk language %q, should be python, go or dart: %w", lang, vars.ErrInvalidValue)
+}
+
+// sdkApi is an api for the generators, In & Out are nil if the api is registered without types, i.g. rpc only
+type sdkApi struct {
+	// Name is the api name, i.g. "api:demo"
+	Name    string
+	In, Out reflect.Type
+}
+
+// Method is the api name without "api:", the generators case it as the language does
+func (a *sdkApi) Method() string {
+	return strings.TrimPrefix(a.Name, "api:")
+}
+
+// sdkStruct is the struct sent to (input) or received from (output) the api
+type sdkStruct struct {
+	Name   string
+	Fields []sdkField
+	// Out is true if it's the output struct, the structs of its fields are the output ones
+	Out bool
+}
+
+// sdkField is a field of sdkStruct. Key is the key on the wire: the json tag for input, as mapper decodes;
+// the msgpack tag for output, as the result is encoded
+type sdkField struct {
+	Key  string
+	Type reflect.Type
+}
+
+// sdkModel is the apis & the structs they use. the struct used by both input & output is generated twice,
+// with suffix "Out" for output, if the keys differ
+type sdkModel struct {
+	Apis    []*sdkApi
+	Structs []*sdkStruct
+	// names of the struct types, by direction: 0 input, 1 output
+	names   [2]map[reflect.Type]string
+	structs [2]map[reflect.Type]*sdkStruct
+}
+
+// newSdkModel is the model of the apis served by http, local apis & rpcs
+func newSdkModel() *sdkModel {
+	apiNames := httpapi.ApiViaHttp.Keys()
+	sort.Strings(apiNames)
+	apis := make([]*sdkApi, 0, len(apiNames))
+	for _, name := range apiNames {
+		api := &sdkApi{Name: name}
+		if docs, ok := ApiDocsMap.Get(name); ok && docs.paramInType != nil {
+			api.In, api.Out = docs.paramInType, docs.paramOutType
+		}
+		apis = append(apis, api)
+	}
+	return sdkModelOf(apis)
+}
+
+func sdkModelOf(apis []*sdkApi) *sdkModel {
+	m := &sdkModel{Apis: apis}
+	for i := range m.names {
+		m.names[i], m.structs[i] = map[reflect.Type]string{}, map[reflect.Type]*sdkStruct{}
+	}
+	for _, api := range apis {
+		if api.In != nil {
+			m.collect(api.In, 0)
+			m.collect(api.Out, 1)
+		}
+	}
+	m.resolveNames()
+	return m
+}
+
+// collect adds the named structs reachable from t
+func (m *sdkModel) collect(t reflect.Type, dir int) {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		m.collect(t.Elem(), dir)
+	case reflect.Struct:
+		if _, ok := m.structs[dir][t]; ok || t.Name() == "" || t == timeType {
+			return
+		}
+		s := &sdkStruct{Out: dir == 1}
+		m.structs[dir][t] = s
+		m.addFields(s, t, dir)
+	}
+}
+
+func (m *sdkModel) addFields(s *sdkStruct, t reflect.Type, dir int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		key, directive := FieldName(field)
+		if dir == 1 {
+			key = strings.Split(field.Tag.Get(TagMsgpack), ",")[0]
+			if key == "" {
+				key = field.Name
+			}
+		}
+		//the fields from jwt are filled by the server
+		if key == "-" || (dir == 0 && strings.HasPrefix(directive, "@@")) {
+			continue
+		}
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && field.Tag.Get(tagOf(dir)) == "" && fieldType.Kind() == reflect.Struct && fieldType != timeType {
+			m.addFields(s, fieldType, dir)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		s.Fields = append(s.Fields, sdkField{Key: key, Type: field.Type})
+		m.collect(field.Type, dir)
+	}
+}
+
+// tagOf is the tag naming the fields: json for input, msgpack for output
+func tagOf(dir int) string {
+	if dir == 1 {
+		return TagMsgpack
+	}
+	return TagJson
+}
+
+// resolveNames names the structs by type name, qualified by package if taken. the output struct is named with suffix "Out"
+// if it's also an input struct with different keys
+func (m *sdkModel) resolveNames() {
+	//the types of the client are reserved
+	taken := map[string]bool{"ApiError": true, "Client": true, "DoptimeError": true, "DoptimeClient": true, "RedisCommander": true}
+	nameOf := func(t reflect.Type) string {
+		name := typeIdent(t)
+		if taken[name] {
+			pkg := t.PkgPath()
+			name = sdkNonIdentifier.ReplaceAllString(pkg[strings.LastIndexByte(pkg, '/')+1:], "_") + "_" + name
+		}
+		taken[name] = true
+		return name
+	}
+	for _, t := range sortedTypes(m.structs[0]) {
+		s := m.structs[0][t]
+		s.Name = nameOf(t)
+		m.names[0][t] = s.Name
+		m.Structs = append(m.Structs, s)
+	}
+	for _, t := range sortedTypes(m.structs[1]) {
+		s := m.structs[1][t]
+		if in, ok := m.structs[0][t]; ok && m.sameKeys(t, map[reflect.Type]bool{}) {
+			m.names[1][t] = in.Name
+			continue
+		} else if ok {
+			s.Name = in.Name + "Out"
+		} else {
+			s.Name = nameOf(t)
+		}
+		m.names[1][t] = s.Name
+		m.Structs = append(m.Structs, s)
+	}
+	sort.Slice(m.Structs, func(i, j int) bool { return m.Structs[i].Name < m.Structs[j].Name })
+}
+
+func sortedTypes(structs map[reflect.Type]*sdkStruct) []reflect.Type {
+	types := make([]reflect.Type, 0, len(structs))
+	for t := range structs {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].PkgPath()+"."+types[i].Name() < types[j].PkgPath()+"."+types[j].Name()
+	})
+	return types
+}
+
+// sameKeys is true if the input & output structs of t, and those of its fields, have the same keys
+func (m *sdkModel) sameKeys(t reflect.Type, visited map[reflect.Type]bool) bool {
+	in, out := m.structs[0][t], m.structs[1][t]
+	if visited[t] || in == nil || out == nil {
+		return visited[t] || in == out
+	}
+	visited[t] = true
+	if len(in.Fields) != len(out.Fields) {
+		return false
+	}
+	for i := range in.Fields {
+		if in.Fields[i].Key != out.Fields[i].Key || !m.sameKeys(elemStruct(in.Fields[i].Type), visited) {
+			return false
+		}
+	}
+	return true
+}
+
+// elemStruct is the struct type in pointer, slice or map of t, or nil
+func elemStruct(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// structName is the name of the struct generated for t, "" if t is not a generated struct
+func (m *sdkModel) structName(t reflect.Type, out bool) string {
+	if out {
+		return m.names[1][t]
+	}
+	return m.names[0][t]
+}
+
+var sdkNonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// typeIdent is the name of the type as an identifier, generic arguments are joined by "_"
+func typeIdent(t reflect.Type) string {
+	name := t.Name()
+	if i := strings.IndexByte(name, '['); i > 0 {
+		ident := name[:i]
+		for _, arg := range strings.Split(name[i+1:len(name)-1], ",") {
+			ident += "_" + arg[strings.LastIndexAny(arg, "./")+1:]
+		}
+		name = ident
+	}
+	return strings.Trim(sdkNonIdentifier.ReplaceAllString(name, "_"), "_")
+}
+
+// identifier makes key a valid identifier, avoiding the keywords & the reserved names of the language
+func identifier(key string, reserved ...map[string]bool) string {
+	ident := strings.Trim(sdkNonIdentifier.ReplaceAllString(key, "_"), "_")
+	if ident == "" || (ident[0] >= '0' && ident[0] <= '9') {
+		ident = "f_" + ident
+	}
+	for _, words := range reserved {
+		if words[ident] {
+			return ident + "_"
+		}
+	}
+	return ident
+}
@@ -0,0 +1,287 @@
+package httpdoc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var dartKeywords = map[string]bool{"abstract": true, "as": true, "assert": true, "async": true, "await": true, "break": true, "case": true,
+	"catch": true, "class": true, "const": true, "continue": true, "covariant": true, "default": true, "deferred": true, "do": true,
+	"dynamic": true, "else": true, "enum": true, "export": true, "extends": true, "extension": true, "external": true, "factory": true,
+	"false": true, "final": true, "finally": true, "for": true, "Function": true, "get": true, "hide": true, "if": true, "implements": true,
+	"import": true, "in": true, "interface": true, "is": true, "late": true, "library": true, "mixin": true, "new": true, "null": true,
+	"on": true, "operator": true, "part": true, "required": true, "rethrow": true, "return": true, "set": true, "show": true,
+	"static": true, "super": true, "switch": true, "sync": true, "this": true, "throw": true, "true": true, "try": true, "typedef": true,
+	"var": true, "void": true, "while": true, "with": true, "yield": true,
+	//the methods of the generated classes
+	"toWire": true, "fromWire": true}
+
+// dartClientMembers are the members of DoptimeClient, not to be shadowed by the api methods
+var dartClientMembers = map[string]bool{"call": true, "urlBase": true, "jwt": true, "rds": true, "timeout": true}
+
+const dartSdkHead = `// generated by doptime, the client of the apis. requires: dependencies http, msgpack_dart
+import 'dart:async';
+import 'dart:typed_data';
+
+import 'package:http/http.dart' as http;
+import 'package:msgpack_dart/msgpack_dart.dart' as msgpack;
+
+class DoptimeError implements Exception {
+  final String code;
+  final String message;
+  final dynamic details;
+  final bool retryable;
+
+  DoptimeError(this.code, this.message, [this.details, this.retryable = false]);
+
+  static DoptimeError fromEnvelope(Uint8List b) {
+    final e = msgpack.deserialize(b);
+    if (e is! Map) return DoptimeError('unknown', '$e');
+    return DoptimeError('${e['code'] ?? ''}', '${e['message'] ?? ''}', e['details'], e['retryable'] == true);
+  }
+
+  @override
+  String toString() => '$code: $message';
+}
+
+/// RedisCommander sends a redis command, i.g. ['BLPOP', key, '1'], and returns the reply.
+/// bulk strings should be replied as List<int>, so that msgpack values are kept. adapt it to the redis client of the app
+abstract class RedisCommander {
+  Future<dynamic> send(List<Object> command);
+}
+
+Uint8List? _toBytes(dynamic v) {
+  if (v == null || v is Uint8List) return v;
+  if (v is String) return Uint8List.fromList(v.codeUnits);
+  return Uint8List.fromList(List<int>.from(v));
+}
+
+DateTime? _toDateTime(dynamic v) {
+  if (v is DateTime) return v;
+  if (v is String) return DateTime.tryParse(v);
+  return null;
+}
+
+/// DoptimeClient calls the apis by http if urlBase is set, else by the redis stream as rpc does
+class DoptimeClient {
+  final String urlBase;
+  final String jwt;
+  final RedisCommander? rds;
+  final Duration timeout;
+
+  DoptimeClient({this.urlBase = '', this.jwt = '', this.rds, this.timeout = const Duration(seconds: 20)});
+
+  Future<dynamic> call(String name, dynamic paramIn) async {
+    final data = msgpack.serialize(paramIn);
+    return urlBase.isNotEmpty ? _callHttp(name, data) : _callRpc(name, data);
+  }
+
+  Future<dynamic> _callHttp(String name, Uint8List data) async {
+    final base = urlBase.endsWith('/') ? urlBase.substring(0, urlBase.length - 1) : urlBase;
+    final headers = {'Content-Type': 'application/octet-stream', if (jwt.isNotEmpty) 'Authorization': 'Bearer $jwt'};
+    final resp = await http.post(Uri.parse('$base/API-!$name-!rt~application%2Fmsgpack'), headers: headers, body: data).timeout(timeout);
+    if (resp.statusCode != 200) throw DoptimeError.fromEnvelope(resp.bodyBytes);
+    return msgpack.deserialize(resp.bodyBytes);
+  }
+
+  Future<dynamic> _callRpc(String name, Uint8List data) async {
+    final rds = this.rds;
+    if (rds == null) throw StateError('neither urlBase nor rds of the client is set');
+    final deadline = DateTime.now().add(timeout).millisecondsSinceEpoch.toString();
+    var id = await rds.send(['XADD', name, 'MAXLEN', '~', '4096', '*', 'data', data, 'deadline', deadline]);
+    id = id is String ? id : String.fromCharCodes(List<int>.from(id));
+    final seconds = timeout.inSeconds < 1 ? 1 : timeout.inSeconds;
+    final reply = await rds.send(['BLPOP', id, '$id:err', '$seconds']);
+    if (reply is! List || reply.length < 2) throw TimeoutException(name, timeout);
+    final key = reply[0] is String ? reply[0] : String.fromCharCodes(List<int>.from(reply[0]));
+    if (key == '$id:err') throw DoptimeError.fromEnvelope(_toBytes(reply[1])!);
+    return msgpack.deserialize(_toBytes(reply[1])!);
+  }
+`
+
+func (m *sdkModel) dart() string {
+	var sb strings.Builder
+	sb.WriteString(dartSdkHead)
+	for _, api := range m.Apis {
+		method := identifier(api.Method(), dartKeywords, dartClientMembers)
+		if api.In == nil {
+			fmt.Fprintf(&sb, "\n  Future<dynamic> %s(dynamic paramIn) => call(%s, paramIn);\n", method, dartString(api.Name))
+			continue
+		}
+		fmt.Fprintf(&sb, "\n  Future<%s> %s(%s paramIn) async {\n    final v = await call(%s, %s);\n    return %s;\n  }\n",
+			m.dartType(api.Out, true), method, m.dartType(api.In, false), dartString(api.Name),
+			m.dartToWire("paramIn", api.In, false, false, 0), m.dartFromWire("v", api.Out, true, false, 0))
+	}
+	sb.WriteString("}\n")
+	for _, s := range m.Structs {
+		fmt.Fprintf(&sb, "\nclass %s {\n", s.Name)
+		var toWire, fromWire []string
+		for _, f := range s.Fields {
+			attr := identifier(f.Key, dartKeywords, map[string]bool{s.Name: true})
+			fmt.Fprintf(&sb, "  %s %s%s;\n", m.dartType(f.Type, s.Out), attr, m.dartDefault(f.Type, s.Out))
+			toWire = append(toWire, dartString(f.Key)+": "+m.dartToWire(attr, f.Type, s.Out, false, 0))
+			fromWire = append(fromWire, "\n    .."+attr+" = "+m.dartFromWire("m["+dartString(f.Key)+"]", f.Type, s.Out, false, 0))
+		}
+		fmt.Fprintf(&sb, "\n  Map<String, dynamic> toWire() => {%s};\n", strings.Join(toWire, ", "))
+		fmt.Fprintf(&sb, "\n  static %s fromWire(dynamic m) => %s()%s;\n}\n", s.Name, s.Name, strings.Join(fromWire, ""))
+	}
+	return sb.String()
+}
+
+// dartString is the single quoted string literal of s
+func dartString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, `$`, `\$`).Replace(s) + "'"
+}
+
+func (m *sdkModel) dartType(t reflect.Type, out bool) string {
+	switch {
+	case t == timeType:
+		return "DateTime?"
+	case t.Kind() == reflect.Ptr:
+		elem := m.dartType(t.Elem(), out)
+		if elem == "dynamic" || strings.HasSuffix(elem, "?") {
+			return elem
+		}
+		return elem + "?"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	case reflect.String:
+		return "String"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "Uint8List"
+		}
+		return "List<" + m.dartType(t.Elem(), out) + ">"
+	case reflect.Map:
+		return "Map<" + m.dartType(t.Key(), out) + ", " + m.dartType(t.Elem(), out) + ">"
+	case reflect.Struct:
+		if name := m.structName(t, out); name != "" {
+			return name
+		}
+		return "Map<String, dynamic>"
+	}
+	return "dynamic"
+}
+
+// dartDefault is the initializer of the field, "" if it's nullable
+func (m *sdkModel) dartDefault(t reflect.Type, out bool) string {
+	if t == timeType {
+		return ""
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return " = false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return " = 0"
+	case reflect.Float32, reflect.Float64:
+		return " = 0.0"
+	case reflect.String:
+		return " = ''"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return " = Uint8List(0)"
+		}
+		return " = []"
+	case reflect.Map:
+		return " = {}"
+	case reflect.Struct:
+		if name := m.structName(t, out); name != "" {
+			return " = " + name + "()"
+		}
+		return " = {}"
+	}
+	return ""
+}
+
+// dartNeedsConv is true if the value of t is not sent to msgpack as is
+func (m *sdkModel) dartNeedsConv(t reflect.Type, out bool) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return m.dartNeedsConv(t.Elem(), out)
+	case reflect.Struct:
+		return t == timeType || m.structName(t, out) != ""
+	}
+	return false
+}
+
+// dartToWire is the expression converting v of type t to the msgpack value. depth names the closure params
+func (m *sdkModel) dartToWire(v string, t reflect.Type, out bool, nullable bool, depth int) string {
+	if t.Kind() == reflect.Ptr {
+		return m.dartToWire(v, t.Elem(), out, true, depth)
+	}
+	if !m.dartNeedsConv(t, out) {
+		return v
+	}
+	dot, e := ".", fmt.Sprintf("e%d", depth)
+	if nullable || t == timeType {
+		dot = "?."
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return v + dot + "map((" + e + ") => " + m.dartToWire(e, t.Elem(), out, false, depth+1) + ").toList()"
+	case reflect.Map:
+		return v + dot + "map((k, " + e + ") => MapEntry(k, " + m.dartToWire(e, t.Elem(), out, false, depth+1) + "))"
+	case reflect.Struct:
+		if t == timeType {
+			return v + "?.toUtc().toIso8601String()"
+		}
+		return v + dot + "toWire()"
+	}
+	return v
+}
+
+// dartFromWire is the expression converting the msgpack value v to type t. the expression is nullable if nullable is true,
+// else the zero value is used for null
+func (m *sdkModel) dartFromWire(v string, t reflect.Type, out bool, nullable bool, depth int) string {
+	if t == timeType {
+		return "_toDateTime(" + v + ")"
+	}
+	if t.Kind() == reflect.Ptr {
+		return m.dartFromWire(v, t.Elem(), out, true, depth)
+	}
+	orZero := func(expr, zero string) string {
+		if nullable {
+			return expr
+		}
+		return expr + " ?? " + zero
+	}
+	e := fmt.Sprintf("e%d", depth)
+	switch t.Kind() {
+	case reflect.Bool:
+		return orZero("("+v+" as bool?)", "false")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return orZero("("+v+" as num?)?.toInt()", "0")
+	case reflect.Float32, reflect.Float64:
+		return orZero("("+v+" as num?)?.toDouble()", "0.0")
+	case reflect.String:
+		return orZero("("+v+" as String?)", "''")
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return orZero("_toBytes("+v+")", "Uint8List(0)")
+		}
+		return orZero("("+v+" as List?)?.map<"+m.dartType(t.Elem(), out)+">(("+e+") => "+m.dartFromWire(e, t.Elem(), out, false, depth+1)+").toList()", "[]")
+	case reflect.Map:
+		k, mapType := fmt.Sprintf("k%d", depth), m.dartType(t.Key(), out)+", "+m.dartType(t.Elem(), out)
+		return orZero("("+v+" as Map?)?.map<"+mapType+">(("+k+", "+e+") => MapEntry("+m.dartFromWire(k, t.Key(), out, false, depth+1)+", "+
+			m.dartFromWire(e, t.Elem(), out, false, depth+1)+"))", "{}")
+	case reflect.Struct:
+		name := m.structName(t, out)
+		if name == "" {
+			return orZero("("+v+" as Map?)?.cast<String, dynamic>()", "{}")
+		} else if nullable {
+			return v + " == null ? null : " + name + ".fromWire(" + v + ")"
+		}
+		return name + ".fromWire(" + v + " ?? const {})"
+	}
+	return v
+}
@@ -0,0 +1,178 @@
+package httpdoc
+
+import (
+	"fmt"
+	"go/format"
+	"reflect"
+	"strings"
+)
+
+const goSdkClient = `
+// ApiError is the error envelope of the failed call
+type ApiError struct {
+	Code      string      ` + "`msgpack:\"code\"`" + `
+	Message   string      ` + "`msgpack:\"message\"`" + `
+	Details   interface{} ` + "`msgpack:\"details,omitempty\"`" + `
+	Retryable bool        ` + "`msgpack:\"retryable\"`" + `
+}
+
+func (e *ApiError) Error() string { return e.Code + ": " + e.Message }
+
+// Client calls the apis by http if UrlBase is set, else by the redis stream of Rds, as doptime rpc does
+type Client struct {
+	UrlBase string
+	Jwt     string
+	Rds     *redis.Client
+	// Timeout is used if ctx has no deadline, 20s if not set
+	Timeout    time.Duration
+	HttpClient *http.Client
+}
+
+// Call calls the api named name, out is the pointer to the result
+func (c *Client) Call(ctx context.Context, name string, in interface{}, out interface{}) (err error) {
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = 20 * time.Second
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	data, err := msgpack.Marshal(in)
+	if err != nil {
+		return err
+	}
+	var result []byte
+	if c.UrlBase != "" {
+		result, err = c.callHttp(ctx, name, data)
+	} else {
+		result, err = c.callRpc(ctx, name, data)
+	}
+	if err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(result, out)
+}
+
+func (c *Client) callHttp(ctx context.Context, name string, data []byte) ([]byte, error) {
+	url := strings.TrimRight(c.UrlBase, "/") + "/API-!" + name + "-!rt~application%2Fmsgpack"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if c.Jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Jwt)
+	}
+	httpClient := c.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode == http.StatusOK {
+		return body, err
+	}
+	apiErr := &ApiError{}
+	if err = msgpack.Unmarshal(body, apiErr); err != nil || apiErr.Code == "" {
+		return nil, fmt.Errorf("http status %d: %s", resp.StatusCode, body)
+	}
+	return nil, apiErr
+}
+
+func (c *Client) callRpc(ctx context.Context, name string, data []byte) ([]byte, error) {
+	if c.Rds == nil {
+		return nil, errors.New("neither UrlBase nor Rds of the client is set")
+	}
+	deadline, _ := ctx.Deadline()
+	values := []string{"data", string(data), "deadline", strconv.FormatInt(deadline.UnixMilli(), 10)}
+	id, err := c.Rds.XAdd(ctx, &redis.XAddArgs{Stream: name, Values: values, MaxLen: 4096}).Result()
+	if err != nil {
+		return nil, err
+	}
+	results, err := c.Rds.BLPop(ctx, time.Until(deadline), id, id+":err").Result()
+	if err == redis.Nil || ctx.Err() != nil {
+		return nil, context.DeadlineExceeded
+	} else if err != nil {
+		return nil, err
+	}
+	if results[0] == id+":err" {
+		apiErr := &ApiError{}
+		if err = msgpack.Unmarshal([]byte(results[1]), apiErr); err != nil {
+			return nil, err
+		}
+		return nil, apiErr
+	}
+	return []byte(results[1]), nil
+}
+`
+
+// goClientMembers are the members of Client, not to be shadowed by the api methods
+var goClientMembers = map[string]bool{"Call": true, "UrlBase": true, "Jwt": true, "Rds": true, "Timeout": true, "HttpClient": true}
+
+func (m *sdkModel) golang(pkg string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// Code generated by doptime. DO NOT EDIT.\n\n// Package %s calls the apis by http, or by the redis stream as doptime rpc does\npackage %s\n\n", pkg, pkg)
+	sb.WriteString("import (\n\t\"bytes\"\n\t\"context\"\n\t\"errors\"\n\t\"fmt\"\n\t\"io\"\n\t\"net/http\"\n\t\"strconv\"\n\t\"strings\"\n\t\"time\"\n\n" +
+		"\t\"github.com/redis/go-redis/v9\"\n\t\"github.com/vmihailenco/msgpack/v5\"\n)\n")
+	sb.WriteString(goSdkClient)
+	for _, s := range m.Structs {
+		fmt.Fprintf(&sb, "\ntype %s struct {\n", s.Name)
+		for _, f := range s.Fields {
+			fmt.Fprintf(&sb, "\t%s %s `msgpack:%q`\n", exportedIdentifier(f.Key), m.goType(f.Type, s.Out), f.Key)
+		}
+		sb.WriteString("}\n")
+	}
+	for _, api := range m.Apis {
+		in, out := "interface{}", "interface{}"
+		if api.In != nil {
+			in, out = m.goType(api.In, false), m.goType(api.Out, true)
+		}
+		method := exportedIdentifier(api.Method())
+		if goClientMembers[method] {
+			method += "_"
+		}
+		fmt.Fprintf(&sb, "\n// %s calls %s\nfunc (c *Client) %s(ctx context.Context, in %s) (out %s, err error) {\n\terr = c.Call(ctx, %q, in, &out)\n\treturn out, err\n}\n",
+			method, api.Name, method, in, out, api.Name)
+	}
+	if src, err := format.Source([]byte(sb.String())); err == nil {
+		return string(src)
+	}
+	return sb.String()
+}
+
+func (m *sdkModel) goType(t reflect.Type, out bool) string {
+	if t == timeType {
+		return "time.Time"
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + m.goType(t.Elem(), out)
+	case reflect.Slice:
+		return "[]" + m.goType(t.Elem(), out)
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), m.goType(t.Elem(), out))
+	case reflect.Map:
+		return "map[" + m.goType(t.Key(), out) + "]" + m.goType(t.Elem(), out)
+	case reflect.Struct:
+		if name := m.structName(t, out); name != "" {
+			return name
+		}
+		return "map[string]interface{}"
+	case reflect.Bool, reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return t.Kind().String()
+	}
+	return "interface{}"
+}
+
+// exportedIdentifier is the identifier of key with the first letter in upper case
+func exportedIdentifier(key string) string {
+	ident := identifier(key)
+	return strings.ToUpper(ident[:1]) + ident[1:]
+}
@@ -0,0 +1,197 @@
+package httpdoc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var pythonKeywords = map[string]bool{"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true, "async": true,
+	"await": true, "break": true, "class": true, "continue": true, "def": true, "del": true, "elif": true, "else": true, "except": true,
+	"finally": true, "for": true, "from": true, "global": true, "if": true, "import": true, "in": true, "is": true, "lambda": true,
+	"nonlocal": true, "not": true, "or": true, "pass": true, "raise": true, "return": true, "try": true, "while": true, "with": true, "yield": true,
+	//the names used in the class body of the dataclass
+	"field": true, "typing": true, "datetime": true, "Any": true, "Dict": true, "List": true, "Optional": true,
+	"bool": true, "bytes": true, "float": true, "int": true, "str": true}
+
+// pythonClientMembers are the members of Client, not to be shadowed by the api methods
+var pythonClientMembers = map[string]bool{"call": true, "url_base": true, "jwt": true, "rds": true, "timeout": true}
+
+const pythonSdkHead = `# generated by doptime, the client of the apis. requires: pip install msgpack redis
+import dataclasses
+import datetime
+import time
+import typing
+import urllib.error
+import urllib.request
+from dataclasses import dataclass, field
+from typing import Any, Dict, List, Optional
+
+import msgpack
+
+
+class ApiError(Exception):
+    def __init__(self, code: str, message: str, details: Any = None, retryable: bool = False):
+        super().__init__(f"{code}: {message}")
+        self.code, self.message, self.details, self.retryable = code, message, details, retryable
+
+    @staticmethod
+    def from_envelope(b: bytes) -> "ApiError":
+        e = msgpack.unpackb(b, raw=False)
+        if not isinstance(e, dict):
+            return ApiError("unknown", str(e))
+        return ApiError(e.get("code", ""), e.get("message", ""), e.get("details"), e.get("retryable", False))
+
+
+def _to_wire(v: Any) -> Any:
+    if dataclasses.is_dataclass(v):
+        return {key: _to_wire(getattr(v, attr)) for attr, key in v._keys.items()}
+    if isinstance(v, list):
+        return [_to_wire(x) for x in v]
+    if isinstance(v, dict):
+        return {k: _to_wire(x) for k, x in v.items()}
+    return v
+
+
+def _from_wire(tp: Any, v: Any) -> Any:
+    if isinstance(tp, str):
+        tp = globals()[tp]
+    if isinstance(tp, typing.ForwardRef):
+        tp = globals()[tp.__forward_arg__]
+    if v is None:
+        return None
+    origin, args = typing.get_origin(tp), typing.get_args(tp)
+    if origin is typing.Union:
+        return _from_wire(next(a for a in args if a is not type(None)), v)
+    if origin is list:
+        return [_from_wire(args[0], x) for x in v]
+    if origin is dict:
+        return {k: _from_wire(args[1], x) for k, x in v.items()}
+    if dataclasses.is_dataclass(tp):
+        hints = typing.get_type_hints(tp)
+        return tp(**{attr: _from_wire(hints[attr], v[key]) for attr, key in tp._keys.items() if key in v})
+    return v
+`
+
+const pythonSdkClient = `
+
+class Client:
+    """calls the apis by http if url_base is set, else by the redis stream as rpc does. rds is the redis.Redis of the apis"""
+
+    def __init__(self, url_base: str = "", jwt: str = "", rds: Any = None, timeout: float = 20):
+        self.url_base, self.jwt, self.rds, self.timeout = url_base.rstrip("/"), jwt, rds, timeout
+
+    def call(self, name: str, param_in: Any) -> Any:
+        data = msgpack.packb(_to_wire(param_in), use_bin_type=True)
+        if self.url_base:
+            return self._call_http(name, data)
+        return self._call_rpc(name, data)
+
+    def _call_http(self, name: str, data: bytes) -> Any:
+        req = urllib.request.Request(self.url_base + "/API-!" + name + "-!rt~application%2Fmsgpack", data=data, method="POST")
+        req.add_header("Content-Type", "application/octet-stream")
+        if self.jwt:
+            req.add_header("Authorization", "Bearer " + self.jwt)
+        try:
+            with urllib.request.urlopen(req, timeout=self.timeout) as resp:
+                return msgpack.unpackb(resp.read(), raw=False, timestamp=3)
+        except urllib.error.HTTPError as e:
+            raise ApiError.from_envelope(e.read()) from None
+
+    def _call_rpc(self, name: str, data: bytes) -> Any:
+        deadline = str(int((time.time() + self.timeout) * 1000))
+        msg_id = self.rds.xadd(name, {"data": data, "deadline": deadline}, maxlen=4096, approximate=True)
+        msg_id = msg_id.decode() if isinstance(msg_id, bytes) else msg_id
+        result = self.rds.blpop([msg_id, msg_id + ":err"], timeout=max(1, int(self.timeout)))
+        if result is None:
+            raise TimeoutError(name)
+        key, value = result
+        key = key.decode() if isinstance(key, bytes) else key
+        if key.endswith(":err"):
+            raise ApiError.from_envelope(value)
+        return msgpack.unpackb(value, raw=False, timestamp=3)
+`
+
+func (m *sdkModel) python() string {
+	var sb strings.Builder
+	sb.WriteString(pythonSdkHead)
+	for _, s := range m.Structs {
+		fmt.Fprintf(&sb, "\n\n@dataclass\nclass %s:\n", s.Name)
+		var keys []string
+		for _, f := range s.Fields {
+			attr := identifier(f.Key, pythonKeywords)
+			keys = append(keys, fmt.Sprintf("%q: %q", attr, f.Key))
+			fmt.Fprintf(&sb, "    %s: %s = %s\n", attr, m.pythonType(f.Type, s.Out), pythonDefault(f.Type))
+		}
+		fmt.Fprintf(&sb, "    _keys: typing.ClassVar[Dict[str, str]] = {%s}\n", strings.Join(keys, ", "))
+	}
+	sb.WriteString(pythonSdkClient)
+	for _, api := range m.Apis {
+		in, out := "Any", "Any"
+		if api.In != nil {
+			in, out = m.pythonType(api.In, false), m.pythonType(api.Out, true)
+		}
+		method := identifier(api.Method(), pythonKeywords, pythonClientMembers)
+		fmt.Fprintf(&sb, "\n    def %s(self, param_in: %s) -> %s:\n        return _from_wire(%s, self.call(%q, param_in))\n", method, in, out, out, api.Name)
+	}
+	return sb.String()
+}
+
+func (m *sdkModel) pythonType(t reflect.Type, out bool) string {
+	switch {
+	case t == timeType:
+		return "Optional[datetime.datetime]"
+	case t.Kind() == reflect.Ptr:
+		elem := m.pythonType(t.Elem(), out)
+		if strings.HasPrefix(elem, "Optional[") {
+			return elem
+		}
+		return "Optional[" + elem + "]"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.String:
+		return "str"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes"
+		}
+		return "List[" + m.pythonType(t.Elem(), out) + "]"
+	case reflect.Map:
+		return "Dict[" + m.pythonType(t.Key(), out) + ", " + m.pythonType(t.Elem(), out) + "]"
+	case reflect.Struct:
+		if name := m.structName(t, out); name != "" {
+			return "Optional[\"" + name + "\"]"
+		}
+		return "Dict[str, Any]"
+	}
+	return "Any"
+}
+
+func pythonDefault(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "False"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "0"
+	case reflect.Float32, reflect.Float64:
+		return "0.0"
+	case reflect.String:
+		return `""`
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return `b""`
+		}
+		return "field(default_factory=list)"
+	case reflect.Map:
+		return "field(default_factory=dict)"
+	}
+	return "None"
+}
@@ -0,0 +1,67 @@
+package httpdoc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sdkNode struct {
+	Name     string     `json:"name"`
+	Children []*sdkNode `json:"children"`
+}
+
+type sdkInput struct {
+	UserId string    `json:"userId @@sub"`
+	Class  string    `json:"class" msgpack:"class"`
+	At     time.Time `json:"at"`
+	Root   *sdkNode  `json:"root"`
+}
+
+func TestClientSdk(t *testing.T) {
+	m := sdkModelOf([]*sdkApi{
+		{Name: "api:demo", In: reflect.TypeOf(&sdkInput{}), Out: reflect.TypeOf(&sdkNode{})},
+		{Name: "api:call"},
+	})
+	//sdkNode is both input & output, with the keys of json & msgpack
+	var names []string
+	for _, s := range m.Structs {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "sdkInput,sdkNode,sdkNodeOut" {
+		t.Fatalf("unexpected structs: %v", names)
+	}
+	cases := map[string][]string{
+		m.python(): {
+			"class sdkInput:\n    class_: str = \"\"\n    at: Optional[datetime.datetime] = None\n    root: Optional[\"sdkNode\"] = None",
+			"_keys: typing.ClassVar[Dict[str, str]] = {\"Name\": \"Name\", \"Children\": \"Children\"}",
+			"def demo(self, param_in: Optional[\"sdkInput\"]) -> Optional[\"sdkNodeOut\"]:",
+			"def call_(self, param_in: Any) -> Any:",
+		},
+		m.golang("client"): {
+			"package client",
+			"Class string    `msgpack:\"class\"`",
+			"Children []*sdkNodeOut `msgpack:\"Children\"`",
+			"func (c *Client) Demo(ctx context.Context, in *sdkInput) (out *sdkNodeOut, err error) {",
+			"func (c *Client) Call_(ctx context.Context, in interface{}) (out interface{}, err error) {",
+		},
+		m.dart(): {
+			"Future<sdkNodeOut?> demo(sdkInput? paramIn) async {",
+			"return v == null ? null : sdkNodeOut.fromWire(v);",
+			"Map<String, dynamic> toWire() => {'class': class_, 'at': at?.toUtc().toIso8601String(), 'root': root?.toWire()};",
+			"..Children = (m['Children'] as List?)?.map<sdkNodeOut?>((e0) => e0 == null ? null : sdkNodeOut.fromWire(e0)).toList() ?? [];",
+			"Future<dynamic> call_(dynamic paramIn) => call('api:call', paramIn);",
+		},
+	}
+	for src, wants := range cases {
+		for _, want := range wants {
+			if !strings.Contains(src, want) {
+				t.Errorf("missing %q in:\n%s", want, src)
+			}
+		}
+	}
+	if strings.Contains(m.python(), "user_id") || strings.Contains(m.python(), "userId") {
+		t.Error("the field filled from jwt should not be in the sdk")
+	}
+}
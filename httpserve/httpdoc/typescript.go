@@ -0,0 +1,273 @@
+package httpdoc
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/doptime/doptime/lib"
+)
+
+// TSTypes are the TypeScript types of an api. In & Out are type expressions, i.g. "DemoInput" or "string[]",
+// the interfaces they refer to are in Defs, keyed by name
+type TSTypes struct {
+	In   string
+	Out  string
+	Defs map[string]string
+}
+
+// the field names follow the tag: "json" as mapper decodes the api params, or "msgpack" as the values of data keys are stored
+const (
+	TagJson    = "json"
+	TagMsgpack = "msgpack"
+)
+
+// tsGenerator emits TypeScript of go types. named structs become interfaces in defs, so that nested & recursive types keep their names
+type tsGenerator struct {
+	tag   string
+	defs  map[string]string
+	names map[reflect.Type]string
+}
+
+func newTSGenerator(tag string) *tsGenerator {
+	return &tsGenerator{tag: tag, defs: map[string]string{}, names: map[reflect.Type]string{}}
+}
+
+// TypeScriptOf generates the TypeScript of the in & out types of an api. the fields of in are named as mapper decodes the params,
+// the fields of out as the result is encoded in msgpack, the same as the client sdks. the interface of out is suffixed by "Out"
+// if it differs from the one of in
+func TypeScriptOf(paramInType, paramOutType reflect.Type) *TSTypes {
+	in, out := newTSGenerator(TagJson), newTSGenerator(TagMsgpack)
+	ts := &TSTypes{In: in.typeOf(paramInType), Defs: in.defs}
+	ts.Out = mergeTSDefs(ts.Defs, out.defs, "Out", out.typeOf(paramOutType))[0]
+	return ts
+}
+
+func (g *tsGenerator) typeOf(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType && g.tag == TagMsgpack:
+		return "Date"
+	case t == timeType:
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return lib.Ternary(g.tag == TagMsgpack, "Uint8Array", "string")
+		}
+		elem := g.typeOf(t.Elem())
+		if strings.ContainsAny(elem, "| ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return "Record<string, " + g.typeOf(t.Elem()) + ">"
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structBody(t, "")
+		}
+		name, ok := g.names[t]
+		if !ok {
+			name = g.interfaceName(t)
+			g.names[t] = name
+			g.defs[name] = ""
+			var extends []string
+			body := g.structBody(t, "", &extends)
+			decl := "export interface " + name
+			if len(extends) > 0 {
+				decl += " extends " + strings.Join(extends, ", ")
+			}
+			g.defs[name] = decl + " " + body
+		}
+		return name
+	}
+	return "any"
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_$]+`)
+
+// interfaceName is the name of the struct, generic arguments are joined by "_". qualified by package if the name is taken
+func (g *tsGenerator) interfaceName(t reflect.Type) string {
+	name := strings.Trim(nonIdentifier.ReplaceAllString(t.Name(), "_"), "_")
+	if i := strings.IndexByte(t.Name(), '['); i > 0 {
+		name = t.Name()[:i]
+		for _, arg := range strings.Split(t.Name()[i+1:len(t.Name())-1], ",") {
+			arg = arg[strings.LastIndexAny(arg, "./")+1:]
+			name += "_" + strings.Trim(nonIdentifier.ReplaceAllString(arg, "_"), "_")
+		}
+	}
+	if _, taken := g.defs[name]; taken {
+		pkg := t.PkgPath()
+		name = nonIdentifier.ReplaceAllString(pkg[strings.LastIndexByte(pkg, '/')+1:], "_") + "_" + name
+	}
+	return name
+}
+
+// structBody is the members of the struct. embedded named structs are in extends if it's given, else they are flattened
+func (g *tsGenerator) structBody(t reflect.Type, indent string, extends ...*[]string) string {
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	g.writeFields(&sb, t, indent+"    ", extends...)
+	sb.WriteString(indent + "}")
+	return sb.String()
+}
+
+func (g *tsGenerator) writeFields(sb *strings.Builder, t reflect.Type, indent string, extends ...*[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		//the embedded struct of unexported type has exported fields
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, optional, directive := g.fieldName(field)
+		if name == "-" {
+			continue
+		}
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && field.Tag.Get(g.tag) == "" && fieldType.Kind() == reflect.Struct && fieldType != timeType {
+			if len(extends) > 0 && fieldType.Name() != "" {
+				*extends[0] = append(*extends[0], g.typeOf(fieldType))
+			} else {
+				g.writeFields(sb, fieldType, indent, extends...)
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		tsType := g.typeOf(field.Type)
+		if enum := enumOf(fieldType, field.Tag.Get("validate")); enum != "" {
+			tsType = enum
+		}
+		if doc := jsDocOf(field, directive); doc != "" {
+			sb.WriteString(indent + doc + "\n")
+		}
+		optional = optional || field.Type.Kind() == reflect.Ptr || directive != ""
+		sb.WriteString(indent + quoteTSKey(name) + lib.Ternary(optional, "?: ", ": ") + tsType + ";\n")
+	}
+}
+
+// fieldName is the name by the tag of the generator, optional if omitempty. directive is the default value of mapper, i.g. "@8080"
+func (g *tsGenerator) fieldName(field reflect.StructField) (name string, optional bool, directive string) {
+	if g.tag == TagMsgpack {
+		tag := field.Tag.Get(TagMsgpack)
+		if tag == "-" {
+			return "-", false, ""
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		return name, strings.Contains(","+options+",", ",omitempty,") || strings.Contains(","+options+",", ",omitzero,"), ""
+	}
+	name, directive = FieldName(field)
+	for _, part := range strings.Fields(field.Tag.Get(TagJson)) {
+		if _, options, _ := strings.Cut(part, ","); !strings.HasPrefix(part, "@") && strings.Contains(","+options+",", ",omitempty,") {
+			optional = true
+		}
+	}
+	return name, optional, directive
+}
+
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+func quoteTSKey(name string) string {
+	if tsIdentifier.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// enumOf is the union of the oneof values in validate tag, i.g. `"a" | "b"`
+func enumOf(t reflect.Type, validate string) string {
+	for _, rule := range strings.Split(validate, ",") {
+		if rule == "dive" {
+			break
+		}
+		if values, ok := strings.CutPrefix(rule, "oneof="); ok {
+			var union []string
+			for _, value := range strings.Fields(values) {
+				if v, isString := enumValue(t, value).(string); isString {
+					union = append(union, strconv.Quote(v))
+				} else {
+					union = append(union, value)
+				}
+			}
+			return strings.Join(union, " | ")
+		}
+	}
+	return ""
+}
+
+// jsDocOf is the comment of the field, from the description, the default value and the validate rules
+func jsDocOf(field reflect.StructField, directive string) string {
+	var doc []string
+	if description := field.Tag.Get("description"); description != "" {
+		doc = append(doc, description)
+	}
+	if strings.HasPrefix(directive, "@@") {
+		doc = append(doc, "filled by the server from "+directive[1:])
+	} else if len(directive) > 1 {
+		doc = append(doc, "@default "+directive[1:])
+	}
+	if validate := field.Tag.Get("validate"); validate != "" && validate != "-" {
+		doc = append(doc, "@validate "+validate)
+	}
+	if len(doc) == 0 {
+		return ""
+	}
+	return "/** " + strings.ReplaceAll(strings.Join(doc, " "), "*/", "* /") + " */"
+}
+
+// mergeTSDefs adds defs to all, the interface conflicting with the one of the same name is renamed with suffix.
+// the renamed names are replaced in exprs, which are returned
+func mergeTSDefs(all map[string]string, defs map[string]string, suffix string, exprs ...string) []string {
+	var renames []string
+	for name, decl := range defs {
+		if exist, ok := all[name]; ok && exist != decl {
+			renames = append(renames, name)
+		}
+	}
+	rename := func(s string) string {
+		for _, name := range renames {
+			s = regexp.MustCompile(`\b`+regexp.QuoteMeta(name)+`\b`).ReplaceAllString(s, name+"_"+suffix)
+		}
+		return s
+	}
+	for name, decl := range defs {
+		all[rename(name)] = rename(decl)
+	}
+	for i := range exprs {
+		exprs[i] = rename(exprs[i])
+	}
+	return exprs
+}
+
+// writeTSDefs writes the interfaces sorted by name
+func writeTSDefs(sb *strings.Builder, defs map[string]string) {
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(sb, "%s\n\n", defs[name])
+	}
+}
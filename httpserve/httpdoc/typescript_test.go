@@ -0,0 +1,83 @@
+package httpdoc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tsBase struct {
+	Tenant string `json:"tenant" description:"tenant id"`
+}
+
+type tsNode struct {
+	Name     string    `json:"name"`
+	Children []*tsNode `json:"children,omitempty"`
+}
+
+type tsInput struct {
+	tsBase
+	UserId string            `json:"userId @@sub"`
+	Kind   string            `json:"kind" validate:"required,oneof=a b"`
+	Level  int               `validate:"oneof=1 2"`
+	Note   *string           `json:"note"`
+	At     time.Time         `json:"at"`
+	Root   *tsNode           `json:"root"`
+	Nodes  map[string]tsNode `json:"nodes"`
+	Any    interface{}       `json:"any"`
+	Ids    []int64           `msgpack:"ids,omitempty"`
+}
+
+func TestTypeScriptOf(t *testing.T) {
+	ts := TypeScriptOf(reflect.TypeOf(&tsInput{}), reflect.TypeOf([]*tsNode{}))
+	//tsNode of out is named by msgpack, it differs from the one of in
+	if ts.In != "tsInput" || ts.Out != "tsNode_Out[]" {
+		t.Fatalf("unexpected type expressions: %s %s", ts.In, ts.Out)
+	}
+	in := ts.Defs["tsInput"]
+	for _, want := range []string{
+		"export interface tsInput extends tsBase {",
+		"/** filled by the server from @sub */",
+		"userId?: string;",
+		`kind: "a" | "b";`,
+		"level: 1 | 2;",
+		"note?: string;",
+		"at: string;",
+		"root?: tsNode;",
+		"nodes: Record<string, tsNode>;",
+		"any: any;",
+		"ids: number[];",
+	} {
+		if !strings.Contains(in, want) {
+			t.Errorf("%q not in\n%s", want, in)
+		}
+	}
+	if node := ts.Defs["tsNode"]; !strings.Contains(node, "children?: tsNode[];") {
+		t.Errorf("recursive type not generated:\n%s", node)
+	}
+	if base := ts.Defs["tsBase"]; !strings.Contains(base, "/** tenant id */") {
+		t.Errorf("jsdoc not generated:\n%s", base)
+	}
+
+	g := newTSGenerator(TagMsgpack)
+	g.typeOf(reflect.TypeOf(tsInput{}))
+	if in := g.defs["tsInput"]; !strings.Contains(in, "ids?: number[];") || !strings.Contains(in, "UserId: string;") || !strings.Contains(in, "At: Date;") {
+		t.Errorf("msgpack names not used:\n%s", in)
+	}
+}
+
+func TestTypeScriptOf_OutputNames(t *testing.T) {
+	type untaggedOut struct {
+		Name  string
+		Count int `msgpack:"count"`
+	}
+	ts := TypeScriptOf(reflect.TypeOf(tsNode{}), reflect.TypeOf(untaggedOut{}))
+	//the result is encoded in msgpack, untagged fields keep the go name
+	if out := ts.Defs[ts.Out]; !strings.Contains(out, "Name: string;") || !strings.Contains(out, "count: number;") {
+		t.Errorf("output fields should be named as encoded:\n%s", out)
+	}
+	if out := ts.Defs["tsNode_Out"]; out != "" {
+		t.Errorf("unexpected out interface:\n%s", out)
+	}
+}
@@ -0,0 +1,47 @@
+package httpserve
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/doptime/utils"
+	"github.com/doptime/doptime/vars"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// idempotencyKey is the Idempotency-Key of the request, scoped by the user, so that it can not replay the result of others
+func (svc *DoptimeReqCtx) idempotencyKey() string {
+	key := svc.Request.Header.Get(utils.IdempotencyHeader)
+	if sub, ok := svc.JwtClaims["sub"]; ok && key != "" {
+		return fmt.Sprint(sub) + ":" + key
+	}
+	return key
+}
+
+// changesData is true for the commands honoring Idempotency-Key, the reads are not worth the round trips
+func (cmd *DataCommand) changesData() bool {
+	return cmd.Writes || cmd.Name == MULTI || cmd.Name == PIPELINE || cmd.Name == EVAL
+}
+
+// executeIdempotently runs the command once per key, the retries get the result of the first call
+func (cmd *DataCommand) executeIdempotently(svcCtx *DoptimeReqCtx, key string) (result interface{}, err error) {
+	body, err := io.ReadAll(svcCtx.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", vars.ErrInvalidInput, err)
+	}
+	svcCtx.Request.Body = io.NopCloser(bytes.NewReader(body))
+	fingerprint := httpapi.Fingerprint([]byte(svcCtx.Cmd + "\n" + svcCtx.Key + "\n" + svcCtx.Request.URL.RawQuery + "\n" + string(body)))
+	b, replayed, err := httpapi.Idempotent(svcCtx.Ctx, svcCtx.RdsClient, "idempotency:"+svcCtx.Cmd+":"+key, fingerprint, httpapi.DefaultIdempotencyTTL, func() ([]byte, error) {
+		if result, err = cmd.Execute(svcCtx); err != nil {
+			return nil, err
+		}
+		return msgpack.Marshal(result)
+	})
+	if err != nil || !replayed {
+		return result, err
+	}
+	result = nil
+	return result, msgpack.Unmarshal(b, &result)
+}
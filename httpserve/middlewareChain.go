@@ -0,0 +1,55 @@
+package httpserve
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// HandlerFunc runs the api or the data command of the request.
+// the result is marshaled by rt of the request after the chain returns
+type HandlerFunc func(svcCtx *DoptimeReqCtx) (result interface{}, err error)
+
+// Middleware wraps the handler. it sees the parsed request (svcCtx.Cmd, svcCtx.Key, svcCtx.JwtClaims ...)
+// before the command runs, and the result & error before they are marshaled:
+//
+//	httpserve.Use(func(next httpserve.HandlerFunc) httpserve.HandlerFunc {
+//		return func(svcCtx *httpserve.DoptimeReqCtx) (interface{}, error) {
+//			start := time.Now()
+//			result, err := next(svcCtx)
+//			logger.Info().Str("cmd", svcCtx.Cmd).Str("key", svcCtx.Key).Dur("cost", time.Since(start)).Err(err).Send()
+//			return result, err
+//		}
+//	})
+type Middleware func(next HandlerFunc) HandlerFunc
+
+type middlewareChain struct {
+	middlewares []Middleware
+	handler     HandlerFunc
+}
+
+var (
+	middlewareMu sync.Mutex
+	handlerChain atomic.Pointer[middlewareChain]
+)
+
+// Use appends middlewares to the chain of both api & data commands.
+// the middleware used first is the outermost one
+func Use(middlewares ...Middleware) {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	chain := &middlewareChain{middlewares: append(append([]Middleware{}, handlerChain.Load().middlewares...), middlewares...)}
+	chain.handler = chain.wrap(executeCommand)
+	handlerChain.Store(chain)
+}
+
+// wrap wraps handler with the middlewares of the chain, i.g. the queueing of the ops of MULTI & PIPELINE
+func (chain *middlewareChain) wrap(handler HandlerFunc) HandlerFunc {
+	for i := len(chain.middlewares) - 1; i >= 0; i-- {
+		handler = chain.middlewares[i](handler)
+	}
+	return handler
+}
+
+func init() {
+	handlerChain.Store(&middlewareChain{handler: executeCommand})
+}
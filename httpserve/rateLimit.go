@@ -0,0 +1,93 @@
+package httpserve
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/doptime/config"
+	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/doptime/utils"
+	"github.com/doptime/doptime/vars"
+	"github.com/doptime/logger"
+)
+
+// ConfigRateLimit is the [[RateLimit]] item in toml, i.g.
+//
+//	[[RateLimit]]
+//	Target = "api:sendSms"
+//	Algorithm = "token_bucket"
+//	Limit = 5
+//	Window = "1m"
+//	KeyBy = "@sub"
+type ConfigRateLimit struct {
+	Target    string
+	Algorithm string
+	Limit     int64
+	// Window is the duration string, i.g. "1s", "1m", "1h"
+	Window  string
+	KeyBy   string
+	RdsName string
+}
+
+// ValidateApiKey authenticates the X-Api-Key header for the limits with KeyBy "apikey".
+// the limits run before the middlewares, the header is trusted only if it's validated here, or the call is limited by ip.
+// otherwise a client gets a fresh bucket by changing the header
+var ValidateApiKey func(svcCtx *DoptimeReqCtx, apiKey string) bool
+
+// rateLimitSubject is who makes the call, by KeyBy of the limit
+func rateLimitSubject(svcCtx *DoptimeReqCtx, keyBy string) string {
+	switch {
+	case keyBy == "apikey":
+		if apiKey := svcCtx.Request.Header.Get("X-Api-Key"); apiKey != "" && ValidateApiKey != nil && ValidateApiKey(svcCtx, apiKey) {
+			return "apikey:" + apiKey
+		}
+	case len(keyBy) > 1 && keyBy[0] == '@':
+		if claim, ok := svcCtx.JwtClaims[keyBy[1:]]; ok && claim != nil {
+			return keyBy + ":" + fmt.Sprint(claim)
+		}
+	}
+	ip, _, err := net.SplitHostPort(svcCtx.Request.RemoteAddr)
+	if err != nil {
+		ip = svcCtx.Request.RemoteAddr
+	}
+	return "ip:" + ip
+}
+
+// checkRateLimits takes a call from all the limits of the api or the data command, and those of "*".
+// it's called for the request, and for each op of MULTI & PIPELINE with the Cmd of the op
+// Retry-After is set if the call is rejected. the limits are skipped if redis fails, the service keeps available
+func checkRateLimits(svcCtx *DoptimeReqCtx) error {
+	target := svcCtx.Cmd
+	if _, isDataCmd := DataCommands.Get(svcCtx.Cmd); !isDataCmd {
+		target = utils.ApiName(svcCtx.Key)
+	}
+	for _, target := range []string{target, "*"} {
+		limits, _ := httpapi.RateLimits.Get(target)
+		for _, limit := range limits {
+			retryAfter, err := limit.Take(svcCtx.Ctx, rateLimitSubject(svcCtx, limit.KeyBy))
+			if err != nil {
+				logger.Warn().Err(err).Str("target", limit.Target).Msg("rate limit skipped")
+			} else if retryAfter > 0 {
+				svcCtx.Writer.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+				return fmt.Errorf("%w: %s, retry after %v", vars.ErrTooManyRequests, limit.Target, retryAfter)
+			}
+		}
+	}
+	return nil
+}
+
+func init() {
+	var configs []ConfigRateLimit
+	config.LoadItemFromToml("RateLimit", &configs)
+	for _, c := range configs {
+		window, err := time.ParseDuration(c.Window)
+		if err != nil || c.Limit <= 0 || c.Target == "" {
+			logger.Error().Str("target", c.Target).Str("window", c.Window).Int64("limit", c.Limit).Msg("invalid RateLimit in toml, ignored")
+			continue
+		}
+		httpapi.AddRateLimit(&httpapi.RateLimit{Target: c.Target, Algorithm: c.Algorithm, Limit: c.Limit, Window: window, KeyBy: c.KeyBy, RdsName: c.RdsName})
+	}
+}
@@ -0,0 +1,26 @@
+package httpserve
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimitSubjectApiKey(t *testing.T) {
+	r := httptest.NewRequest("GET", "/HGET-k?f=a", nil)
+	r.RemoteAddr = "10.0.0.1:5678"
+	r.Header.Set("X-Api-Key", "k1")
+	svcCtx := &DoptimeReqCtx{Request: r}
+	//the header is not trusted without validation
+	if got := rateLimitSubject(svcCtx, "apikey"); got != "ip:10.0.0.1" {
+		t.Errorf("unvalidated api key: got %s", got)
+	}
+	ValidateApiKey = func(svcCtx *DoptimeReqCtx, apiKey string) bool { return apiKey == "k1" }
+	defer func() { ValidateApiKey = nil }()
+	if got := rateLimitSubject(svcCtx, "apikey"); got != "apikey:k1" {
+		t.Errorf("validated api key: got %s", got)
+	}
+	r.Header.Set("X-Api-Key", "k2")
+	if got := rateLimitSubject(svcCtx, "apikey"); got != "ip:10.0.0.1" {
+		t.Errorf("invalid api key: got %s", got)
+	}
+}
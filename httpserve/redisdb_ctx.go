@@ -2,7 +2,9 @@ package httpserve
 
 import (
 	"reflect"
+	"strconv"
 
+	"github.com/doptime/doptime/lib"
 	"github.com/doptime/doptime/utils/mapper"
 	"github.com/doptime/redisdb"
 	"github.com/vmihailenco/msgpack/v5"
@@ -59,3 +61,113 @@ func isPtr(v interface{}) bool {
 	}
 	return reflect.ValueOf(v).Kind() == reflect.Ptr
 }
+
+// serializeValue stores the value the same way as redisdb: primitives in plain text, others in msgpack.
+// it is used by the commands not covered by the typed keys, i.g. HSETNX, SETNX, MSET
+func serializeValue(val interface{}) (string, error) {
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	}
+	b, err := msgpack.Marshal(val)
+	return string(b), err
+}
+
+// deserializeValues converts the stored values to the value type of the key
+func deserializeValues(key redisdb.IHttpKey, valStrs []string) (values []interface{}, err error) {
+	values = make([]interface{}, len(valStrs))
+	for i, valStr := range valStrs {
+		if values[i], err = deserializeValue(key, valStr); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func deserializeValue(key redisdb.IHttpKey, valStr string) (interface{}, error) {
+	val := key.GetValue()
+	if val == nil {
+		return valStr, nil
+	} else if isPtr(val) {
+		return val, msgpack.Unmarshal([]byte(valStr), val)
+	}
+	var (
+		rv  = reflect.New(reflect.TypeOf(val)).Elem()
+		err error
+	)
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(valStr)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(valStr, 10, 64)
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(valStr, 10, 64)
+		rv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(valStr, 64)
+		rv.SetFloat(f)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(valStr)
+		rv.SetBool(b)
+	default:
+		err = msgpack.Unmarshal([]byte(valStr), rv.Addr().Interface())
+	}
+	return rv.Interface(), err
+}
+
+// storedValue converts the body to the value type of the key, in the stored format.
+// the modifiers of the value are applied the same as the typed keys do
+func (req *DoptimeReqCtx) storedValue(key redisdb.IHttpKey) (string, error) {
+	value, err := req.ToValue(key, req.Body())
+	if err != nil {
+		return "", err
+	}
+	return storedOf(key, value)
+}
+
+// storedOf is the stored format of the value of the key, with the modifiers applied. i.g. the values of MSET
+func storedOf(key redisdb.IHttpKey, value interface{}) (string, error) {
+	if key.GetUseModer() {
+		if err := redisdb.ApplyModifiers(value); err != nil {
+			return "", err
+		}
+	}
+	return serializeValue(value)
+}
+
+// unmarshalMembers converts the zset members to the value type of the key. members are always msgpack, the same as redisdb.ZSetKey
+func unmarshalMembers(key redisdb.IHttpKey, members []string) (values []interface{}, err error) {
+	val := key.GetValue()
+	if val == nil {
+		return sliceToInterface(members), nil
+	}
+	valType := reflect.TypeOf(val)
+	if isPtr(val) {
+		valType = valType.Elem()
+	}
+	values = make([]interface{}, len(members))
+	for i, member := range members {
+		rv := reflect.New(valType)
+		if err = msgpack.Unmarshal([]byte(member), rv.Interface()); err != nil {
+			return nil, err
+		}
+		values[i] = lib.Ternary(isPtr(val), rv.Interface(), rv.Elem().Interface())
+	}
+	return values, nil
+}
@@ -1,380 +1,149 @@
 package httpserve
 
-const (
-	HGET                 string = "HGET"
-	HSET                 string = "HSET"
-	HMSET                string = "HMSET"
-	HDEL                 string = "HDEL"
-	HGETALL              string = "HGETALL"
-	HMGET                string = "HMGET"
-	HKEY                 string = "HKEY"
-	HKEYS                string = "HKEYS"
-	HVALS                string = "HVALS"
-	HLEN                 string = "HLEN"
-	HSTRLEN              string = "HSTRLEN"
-	HINCRBY              string = "HINCRBY"
-	HINCRBYFLOAT         string = "HINCRBYFLOAT"
-	HSETNX               string = "HSETNX"
-	HEXISTS              string = "HEXISTS"
-	HRANDFIELD           string = "HRANDFIELD"
-	HRANDFIELDWITHVALUES string = "HRANDFIELDWITHVALUES"
-	HSCAN                string = "HSCAN"
-	APPEND               string = "APPEND"
-	BITCOUNT             string = "BITCOUNT"
-	BITFIELD             string = "BITFIELD"
-	BITOP                string = "BITOP"
-	BITPOS               string = "BITPOS"
-	DECR                 string = "DECR"
-	DECRBY               string = "DECRBY"
-	GET                  string = "GET"
-	GETBIT               string = "GETBIT"
-	GETRANGE             string = "GETRANGE"
-	GETSET               string = "GETSET"
-	INCR                 string = "INCR"
-	INCRBY               string = "INCRBY"
-	INCRBYFLOAT          string = "INCRBYFLOAT"
-	MGET                 string = "MGET"
-	MSET                 string = "MSET"
-	MSETNX               string = "MSETNX"
-	PSETEX               string = "PSETEX"
-	SET                  string = "SET"
-	SETBIT               string = "SETBIT"
-	SETEX                string = "SETEX"
-	SETNX                string = "SETNX"
-	SETRANGE             string = "SETRANGE"
-	STRLEN               string = "STRLEN"
-	DEL                  string = "DEL"
-	DUMP                 string = "DUMP"
-	EXISTS               string = "EXISTS"
-	EXPIRE               string = "EXPIRE"
-	EXPIREAT             string = "EXPIREAT"
-	KEYS                 string = "KEYS"
-	MIGRATE              string = "MIGRATE"
-	MOVE                 string = "MOVE"
-	OBJECT               string = "OBJECT"
-	PERSIST              string = "PERSIST"
-	PEXPIRE              string = "PEXPIRE"
-	PEXPIREAT            string = "PEXPIREAT"
-	PTTL                 string = "PTTL"
-	RANDOMKEY            string = "RANDOMKEY"
-	RENAME               string = "RENAME"
-	RENAMEX              string = "RENAMEX"
-	RENAMENX             string = "RENAMENX"
-	RESTORE              string = "RESTORE"
-	SORT                 string = "SORT"
-	TOUCH                string = "TOUCH"
-	TTL                  string = "TTL"
-	TYPE                 string = "TYPE"
-	UNLINK               string = "UNLINK"
-	WAIT                 string = "WAIT"
-	BLPOP                string = "BLPOP"
-	BRPOP                string = "BRPOP"
-	BRPOPLPUSH           string = "BRPOPLPUSH"
-	LINDEX               string = "LINDEX"
-	LINSERT              string = "LINSERT"
-	LLEN                 string = "LLEN"
-	XLEN                 string = "XLEN"
-	LPOP                 string = "LPOP"
-	LPUSH                string = "LPUSH"
-	LPUSHX               string = "LPUSHX"
-	LRANGE               string = "LRANGE"
-	LREM                 string = "LREM"
-	LSET                 string = "LSET"
-	LTRIM                string = "LTRIM"
-	RPOP                 string = "RPOP"
-	RPOPLPUSH            string = "RPOPLPUSH"
-	RPUSH                string = "RPUSH"
-	RPUSHX               string = "RPUSHX"
-	SADD                 string = "SADD"
-	SCARD                string = "SCARD"
-	SCAN                 string = "SCAN"
-	SDIFF                string = "SDIFF"
-	SDIFFSTORE           string = "SDIFFSTORE"
-	SINTER               string = "SINTER"
-	SINTERSTORE          string = "SINTERSTORE"
-	SISMEMBER            string = "SISMEMBER"
-	SMEMBERS             string = "SMEMBERS"
-	SMOVE                string = "SMOVE"
-	SPOP                 string = "SPOP"
-	SRANDMEMBER          string = "SRANDMEMBER"
-	SREM                 string = "SREM"
-	SSCAN                string = "SSCAN"
-	SUNION               string = "SUNION"
-	SUNIONSTORE          string = "SUNIONSTORE"
-	ZADD                 string = "ZADD"
-	ZCARD                string = "ZCARD"
-	ZCOUNT               string = "ZCOUNT"
-	ZINCRBY              string = "ZINCRBY"
-	ZINTERSTORE          string = "ZINTERSTORE"
-	ZLEXCOUNT            string = "ZLEXCOUNT"
-	ZPOPMAX              string = "ZPOPMAX"
-	ZPOPMIN              string = "ZPOPMIN"
-	ZRANGE               string = "ZRANGE"
-	ZRANGEBYLEX          string = "ZRANGEBYLEX"
-	ZRANGEBYSCORE        string = "ZRANGEBYSCORE"
-	ZRANK                string = "ZRANK"
-	ZREM                 string = "ZREM"
-	ZREMRANGEBYLEX       string = "ZREMRANGEBYLEX"
-	ZREMRANGEBYRANK      string = "ZREMRANGEBYRANK"
-	ZREMRANGEBYSCORE     string = "ZREMRANGEBYSCORE"
-	ZREVRANGE            string = "ZREVRANGE"
-	ZREVRANGEBYLEX       string = "ZREVRANGEBYLEX"
-	ZREVRANGEBYSCORE     string = "ZREVRANGEBYSCORE"
-	ZREVRANK             string = "ZREVRANK"
-	ZSCAN                string = "ZSCAN"
-	ZSCORE               string = "ZSCORE"
-	ZUNIONSTORE          string = "ZUNIONSTORE"
-	XRANGE               string = "XRANGE"
-	XRANGEN              string = "XRANGEN"
-	XREVRANGE            string = "XREVRANGE"
-	XREVRANGEN           string = "XREVRANGEN"
-	XREAD                string = "XREAD"
-	XADD                 string = "XADD"
-	XDEL                 string = "XDEL"
-	TIME                 string = "TIME"
-)
+// reservedDataCmds are the names of the redis commands declared below. the ones not in DataCommands are answered
+// with ErrBadCommand, rather than being called as api, i.g. /SORT-foo is not the api foo
+var reservedDataCmds = map[string]struct{}{}
 
-var DataCmdRequireKey = map[string]bool{
-	HGET:                 true,
-	HSET:                 true,
-	HMSET:                true,
-	HDEL:                 true,
-	HGETALL:              true,
-	HKEY:                 true,
-	HKEYS:                true,
-	HVALS:                true,
-	HLEN:                 true,
-	HSTRLEN:              true,
-	HINCRBY:              true,
-	HINCRBYFLOAT:         true,
-	HRANDFIELD:           true,
-	HRANDFIELDWITHVALUES: true,
-	HSETNX:               true,
-	HEXISTS:              true,
-	HSCAN:                true,
-	APPEND:               true,
-	BITCOUNT:             true,
-	BITFIELD:             true,
-	BITOP:                true,
-	BITPOS:               true,
-	DECR:                 true,
-	DECRBY:               true,
-	GET:                  true,
-	GETBIT:               true,
-	GETRANGE:             true,
-	GETSET:               true,
-	INCR:                 true,
-	INCRBY:               true,
-	INCRBYFLOAT:          true,
-	MGET:                 true,
-	MSET:                 true,
-	MSETNX:               true,
-	PSETEX:               true,
-	SET:                  true,
-	SETBIT:               true,
-	SETEX:                true,
-	SETNX:                true,
-	SETRANGE:             true,
-	STRLEN:               true,
-	DEL:                  true,
-	DUMP:                 true,
-	EXISTS:               true,
-	EXPIRE:               true,
-	EXPIREAT:             true,
-	KEYS:                 true,
-	MIGRATE:              true,
-	MOVE:                 true,
-	OBJECT:               true,
-	PERSIST:              true,
-	PEXPIRE:              true,
-	PEXPIREAT:            true,
-	PTTL:                 true,
-	RANDOMKEY:            true,
-	RENAME:               true,
-	RENAMENX:             true,
-	RESTORE:              true,
-	SORT:                 true,
-	TOUCH:                true,
-	TTL:                  true,
-	TYPE:                 true,
-	UNLINK:               true,
-	WAIT:                 true,
-	BLPOP:                true,
-	BRPOP:                true,
-	BRPOPLPUSH:           true,
-	LINDEX:               true,
-	LINSERT:              true,
-	LLEN:                 true,
-	LPOP:                 true,
-	LPUSH:                true,
-	LPUSHX:               true,
-	LRANGE:               true,
-	LREM:                 true,
-	LSET:                 true,
-	LTRIM:                true,
-	RPOP:                 true,
-	RPOPLPUSH:            true,
-	RPUSH:                true,
-	RPUSHX:               true,
-	SADD:                 true,
-	SCARD:                true,
-	SDIFF:                true,
-	SDIFFSTORE:           true,
-	SINTER:               true,
-	SINTERSTORE:          true,
-	SISMEMBER:            true,
-	SMEMBERS:             true,
-	SMOVE:                true,
-	SPOP:                 true,
-	SRANDMEMBER:          true,
-	SREM:                 true,
-	SSCAN:                true,
-	SUNION:               true,
-	SUNIONSTORE:          true,
-	TIME:                 false,
-	ZADD:                 true,
-	ZCARD:                true,
-	ZCOUNT:               true,
-	ZINCRBY:              true,
-	ZINTERSTORE:          true,
-	ZLEXCOUNT:            true,
-	ZPOPMAX:              true,
-	ZPOPMIN:              true,
-	ZRANGE:               true,
-	ZRANGEBYLEX:          true,
-	ZRANGEBYSCORE:        true,
-	ZRANK:                true,
-	ZREM:                 true,
-	ZREMRANGEBYLEX:       true,
-	ZREMRANGEBYRANK:      true,
-	ZREMRANGEBYSCORE:     true,
-	ZREVRANGE:            true,
-	ZREVRANGEBYLEX:       true,
-	ZREVRANGEBYSCORE:     true,
-	ZREVRANK:             true,
-	ZSCAN:                true,
-	ZSCORE:               true,
-	ZUNIONSTORE:          true,
-	XRANGEN:              true,
-	XREVRANGE:            true,
+// reserve adds the command to reservedDataCmds, so that the names are declared once
+func reserve(cmd string) string {
+	reservedDataCmds[cmd] = struct{}{}
+	return cmd
 }
 
-var DataCmdRequireField = map[string]bool{
-	HGET:                 true,
-	HSET:                 true,
-	HDEL:                 true,
-	HMGET:                true,
-	HINCRBY:              true,
-	HINCRBYFLOAT:         true,
-	HSETNX:               true,
-	HEXISTS:              true,
-	HSCAN:                false,
-	HSTRLEN:              true,
-	HRANDFIELD:           false,
-	HRANDFIELDWITHVALUES: false,
-	// 非哈希命令
-	APPEND:           false,
-	BITCOUNT:         false,
-	BITFIELD:         false,
-	BITOP:            false,
-	BITPOS:           false,
-	DECR:             false,
-	DECRBY:           false,
-	GET:              false,
-	GETBIT:           false,
-	GETRANGE:         false,
-	GETSET:           false,
-	INCR:             false,
-	INCRBY:           false,
-	INCRBYFLOAT:      false,
-	MGET:             false,
-	MSET:             false,
-	MSETNX:           false,
-	PSETEX:           false,
-	SET:              false,
-	SETBIT:           false,
-	SETEX:            false,
-	SETNX:            false,
-	SETRANGE:         false,
-	STRLEN:           false,
-	DEL:              false,
-	DUMP:             false,
-	EXISTS:           false,
-	EXPIRE:           false,
-	EXPIREAT:         false,
-	KEYS:             false,
-	MIGRATE:          false,
-	MOVE:             false,
-	OBJECT:           false,
-	PERSIST:          false,
-	PEXPIRE:          false,
-	PEXPIREAT:        false,
-	PTTL:             false,
-	RANDOMKEY:        false,
-	RENAME:           false,
-	RENAMENX:         false,
-	RESTORE:          false,
-	SORT:             false,
-	TOUCH:            false,
-	TTL:              false,
-	TYPE:             false,
-	UNLINK:           false,
-	WAIT:             false,
-	BLPOP:            false,
-	BRPOP:            false,
-	BRPOPLPUSH:       false,
-	LINDEX:           false,
-	LINSERT:          false,
-	LLEN:             false,
-	LPOP:             false,
-	LPUSH:            false,
-	LPUSHX:           false,
-	LRANGE:           false,
-	LREM:             false,
-	LSET:             false,
-	LTRIM:            false,
-	RPOP:             false,
-	RPOPLPUSH:        false,
-	RPUSH:            false,
-	RPUSHX:           false,
-	SADD:             false,
-	SCARD:            false,
-	SDIFF:            false,
-	SDIFFSTORE:       false,
-	SINTER:           false,
-	SINTERSTORE:      false,
-	SISMEMBER:        false,
-	SMEMBERS:         false,
-	SMOVE:            false,
-	SPOP:             false,
-	SRANDMEMBER:      false,
-	SREM:             false,
-	SSCAN:            false,
-	SUNION:           false,
-	SUNIONSTORE:      false,
-	ZADD:             false,
-	ZCARD:            false,
-	ZCOUNT:           false,
-	ZINCRBY:          false,
-	ZINTERSTORE:      false,
-	ZLEXCOUNT:        false,
-	ZPOPMAX:          false,
-	ZPOPMIN:          false,
-	ZRANGE:           false,
-	ZRANGEBYLEX:      false,
-	ZRANGEBYSCORE:    false,
-	ZRANK:            false,
-	ZREM:             false,
-	ZREMRANGEBYLEX:   false,
-	ZREMRANGEBYRANK:  false,
-	ZREMRANGEBYSCORE: false,
-	ZREVRANGE:        false,
-	ZREVRANGEBYLEX:   false,
-	ZREVRANGEBYSCORE: false,
-	ZREVRANK:         false,
-	ZSCAN:            false,
-	ZSCORE:           false,
-	ZUNIONSTORE:      false,
-	XRANGEN:          false,
-	XREVRANGE:        false,
-}
+var (
+	HGET                 = reserve("HGET")
+	HSET                 = reserve("HSET")
+	HMSET                = reserve("HMSET")
+	HDEL                 = reserve("HDEL")
+	HGETALL              = reserve("HGETALL")
+	HMGET                = reserve("HMGET")
+	HKEY                 = reserve("HKEY")
+	HKEYS                = reserve("HKEYS")
+	HVALS                = reserve("HVALS")
+	HLEN                 = reserve("HLEN")
+	HSTRLEN              = reserve("HSTRLEN")
+	HINCRBY              = reserve("HINCRBY")
+	HINCRBYFLOAT         = reserve("HINCRBYFLOAT")
+	HSETNX               = reserve("HSETNX")
+	HEXISTS              = reserve("HEXISTS")
+	HRANDFIELD           = reserve("HRANDFIELD")
+	HRANDFIELDWITHVALUES = reserve("HRANDFIELDWITHVALUES")
+	HSCAN                = reserve("HSCAN")
+	APPEND               = reserve("APPEND")
+	BITCOUNT             = reserve("BITCOUNT")
+	BITFIELD             = reserve("BITFIELD")
+	BITOP                = reserve("BITOP")
+	BITPOS               = reserve("BITPOS")
+	DECR                 = reserve("DECR")
+	DECRBY               = reserve("DECRBY")
+	GET                  = reserve("GET")
+	GETBIT               = reserve("GETBIT")
+	GETRANGE             = reserve("GETRANGE")
+	GETSET               = reserve("GETSET")
+	INCR                 = reserve("INCR")
+	INCRBY               = reserve("INCRBY")
+	INCRBYFLOAT          = reserve("INCRBYFLOAT")
+	MGET                 = reserve("MGET")
+	MSET                 = reserve("MSET")
+	MSETNX               = reserve("MSETNX")
+	PSETEX               = reserve("PSETEX")
+	SET                  = reserve("SET")
+	SETBIT               = reserve("SETBIT")
+	SETEX                = reserve("SETEX")
+	SETNX                = reserve("SETNX")
+	SETRANGE             = reserve("SETRANGE")
+	STRLEN               = reserve("STRLEN")
+	DEL                  = reserve("DEL")
+	DUMP                 = reserve("DUMP")
+	EXISTS               = reserve("EXISTS")
+	EXPIRE               = reserve("EXPIRE")
+	EXPIREAT             = reserve("EXPIREAT")
+	KEYS                 = reserve("KEYS")
+	MIGRATE              = reserve("MIGRATE")
+	MOVE                 = reserve("MOVE")
+	OBJECT               = reserve("OBJECT")
+	PERSIST              = reserve("PERSIST")
+	PEXPIRE              = reserve("PEXPIRE")
+	PEXPIREAT            = reserve("PEXPIREAT")
+	PTTL                 = reserve("PTTL")
+	RANDOMKEY            = reserve("RANDOMKEY")
+	RENAME               = reserve("RENAME")
+	RENAMEX              = reserve("RENAMEX")
+	RENAMENX             = reserve("RENAMENX")
+	RESTORE              = reserve("RESTORE")
+	SORT                 = reserve("SORT")
+	TOUCH                = reserve("TOUCH")
+	TTL                  = reserve("TTL")
+	TYPE                 = reserve("TYPE")
+	UNLINK               = reserve("UNLINK")
+	WAIT                 = reserve("WAIT")
+	BLPOP                = reserve("BLPOP")
+	BRPOP                = reserve("BRPOP")
+	BRPOPLPUSH           = reserve("BRPOPLPUSH")
+	LINDEX               = reserve("LINDEX")
+	LINSERT              = reserve("LINSERT")
+	LLEN                 = reserve("LLEN")
+	XLEN                 = reserve("XLEN")
+	LPOP                 = reserve("LPOP")
+	LPUSH                = reserve("LPUSH")
+	LPUSHX               = reserve("LPUSHX")
+	LRANGE               = reserve("LRANGE")
+	LREM                 = reserve("LREM")
+	LSET                 = reserve("LSET")
+	LTRIM                = reserve("LTRIM")
+	RPOP                 = reserve("RPOP")
+	RPOPLPUSH            = reserve("RPOPLPUSH")
+	RPUSH                = reserve("RPUSH")
+	RPUSHX               = reserve("RPUSHX")
+	SADD                 = reserve("SADD")
+	SCARD                = reserve("SCARD")
+	SCAN                 = reserve("SCAN")
+	SDIFF                = reserve("SDIFF")
+	SDIFFSTORE           = reserve("SDIFFSTORE")
+	SINTER               = reserve("SINTER")
+	SINTERSTORE          = reserve("SINTERSTORE")
+	SISMEMBER            = reserve("SISMEMBER")
+	SMEMBERS             = reserve("SMEMBERS")
+	SMOVE                = reserve("SMOVE")
+	SPOP                 = reserve("SPOP")
+	SRANDMEMBER          = reserve("SRANDMEMBER")
+	SREM                 = reserve("SREM")
+	SSCAN                = reserve("SSCAN")
+	SUNION               = reserve("SUNION")
+	SUNIONSTORE          = reserve("SUNIONSTORE")
+	ZADD                 = reserve("ZADD")
+	ZCARD                = reserve("ZCARD")
+	ZCOUNT               = reserve("ZCOUNT")
+	ZINCRBY              = reserve("ZINCRBY")
+	ZINTERSTORE          = reserve("ZINTERSTORE")
+	ZLEXCOUNT            = reserve("ZLEXCOUNT")
+	ZPOPMAX              = reserve("ZPOPMAX")
+	ZPOPMIN              = reserve("ZPOPMIN")
+	ZRANGE               = reserve("ZRANGE")
+	ZRANGEBYLEX          = reserve("ZRANGEBYLEX")
+	ZRANGEBYSCORE        = reserve("ZRANGEBYSCORE")
+	ZRANK                = reserve("ZRANK")
+	ZREM                 = reserve("ZREM")
+	ZREMRANGEBYLEX       = reserve("ZREMRANGEBYLEX")
+	ZREMRANGEBYRANK      = reserve("ZREMRANGEBYRANK")
+	ZREMRANGEBYSCORE     = reserve("ZREMRANGEBYSCORE")
+	ZREVRANGE            = reserve("ZREVRANGE")
+	ZREVRANGEBYLEX       = reserve("ZREVRANGEBYLEX")
+	ZREVRANGEBYSCORE     = reserve("ZREVRANGEBYSCORE")
+	ZREVRANK             = reserve("ZREVRANK")
+	ZSCAN                = reserve("ZSCAN")
+	ZSCORE               = reserve("ZSCORE")
+	ZUNIONSTORE          = reserve("ZUNIONSTORE")
+	XRANGE               = reserve("XRANGE")
+	XRANGEN              = reserve("XRANGEN")
+	XREVRANGE            = reserve("XREVRANGE")
+	XREVRANGEN           = reserve("XREVRANGEN")
+	XREAD                = reserve("XREAD")
+	XADD                 = reserve("XADD")
+	XDEL                 = reserve("XDEL")
+	TIME                 = reserve("TIME")
+	SUBSCRIBE            = reserve("SUBSCRIBE")
+	MULTI                = reserve("MULTI")
+	PIPELINE             = reserve("PIPELINE")
+	EVAL                 = reserve("EVAL")
+)
@@ -0,0 +1,11 @@
+package httpserve
+
+import "github.com/doptime/config/cfghttp"
+
+// the path is empty without toml. it's set before the init of the package starts the server, which can not route ""
+var _ = func() bool {
+	if cfghttp.Path == "" {
+		cfghttp.Path = "/"
+	}
+	return true
+}()
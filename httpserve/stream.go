@@ -0,0 +1,102 @@
+package httpserve
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/doptime/config/cfghttp"
+	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/doptime/utils/mapper"
+	"github.com/doptime/doptime/vars"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	ContentTypeEventStream   = "text/event-stream"
+	ContentTypeMsgpackStream = "application/msgpack-stream"
+)
+
+// IsStreamResponse is true if the client asks for chunks, by rt or Accept header
+func IsStreamResponse(r *http.Request, responseContentType string) bool {
+	return responseContentType == ContentTypeEventStream || responseContentType == ContentTypeMsgpackStream ||
+		strings.Contains(r.Header.Get("Accept"), ContentTypeEventStream)
+}
+
+// streamChunkWriter is implemented by the response writers that push the chunks themselves, i.g. websocket
+type streamChunkWriter interface {
+	PushChunk(chunk interface{}) error
+}
+
+// streamFrame is the msgpack frame of chunked response, one of Data or Error is set
+type streamFrame struct {
+	Data  interface{}    `msgpack:"data,omitempty"`
+	Error *vars.ApiError `msgpack:"error,omitempty"`
+}
+
+// responseStream writes the chunks of stream api as they are sent.
+// rt=application/msgpack-stream: concatenated msgpack frames {data} ... [{error}]
+// otherwise Server-Sent Events: "data: <json>" ... then "event: end" or "event: error"
+func responseStream(ctx context.Context, w http.ResponseWriter, api httpapi.StreamApiInterface, svcCtx *DoptimeReqCtx, msgpackNonstruct, jsonpackNostruct []byte, responseContentType string) {
+	var (
+		flusher, _ = w.(http.Flusher)
+		isMsgpack  = responseContentType == ContentTypeMsgpackStream
+		write      func(event string, data []byte) error
+	)
+	if len(cfghttp.CORES) > 0 {
+		w.Header().Set("Access-Control-Allow-Origin", cfghttp.CORES)
+	}
+	if isMsgpack {
+		w.Header().Set("Content-Type", ContentTypeMsgpackStream)
+		write = func(event string, data []byte) error {
+			_, err := w.Write(data)
+			return err
+		}
+	} else {
+		w.Header().Set("Content-Type", ContentTypeEventStream)
+		w.Header().Set("Cache-Control", "no-cache")
+		write = func(event string, data []byte) (err error) {
+			if len(event) > 0 {
+				_, err = w.Write([]byte("event: " + event + "\n"))
+			}
+			if err == nil {
+				_, err = w.Write([]byte("data: " + string(data) + "\n\n"))
+			}
+			return err
+		}
+	}
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(chunk interface{}) (err error) {
+		var b []byte
+		if isMsgpack {
+			b, err = msgpack.Marshal(streamFrame{Data: chunk})
+		} else {
+			b, err = mapper.Marshal(chunk)
+		}
+		if err != nil {
+			return err
+		}
+		if err = write("", b); err == nil && flusher != nil {
+			flusher.Flush()
+		}
+		return err
+	}
+
+	var b []byte
+	if err := api.CallStreamByMap(ctx, svcCtx.Params, msgpackNonstruct, jsonpackNostruct, send); err != nil {
+		if isMsgpack {
+			b, _ = msgpack.Marshal(streamFrame{Error: vars.ToApiError(err)})
+		} else {
+			b, _ = json.Marshal(vars.ToApiError(err))
+		}
+		write("error", b)
+	} else if !isMsgpack {
+		write("end", []byte("{}"))
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
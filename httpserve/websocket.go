@@ -0,0 +1,281 @@
+package httpserve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/doptime/config/cfghttp"
+	"github.com/doptime/doptime/lib"
+	"github.com/doptime/doptime/vars"
+	"github.com/doptime/logger"
+	"github.com/golang-jwt/jwt/v5"
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/net/websocket"
+)
+
+// WsPath is the websocket gateway. one connection multiplexes the requests of CMD-Key urls,
+// with the same permission checks and jwt context as http
+var WsPath = "/ws"
+
+// WsRequest is sent by the client, as json in text frame or msgpack in binary frame.
+// Path is the same as the last part of http url, i.g. "HGET-UserAvatar?f=fa4Y3oyQk2swURaJ"
+type WsRequest struct {
+	ID     string      `json:"id" msgpack:"id"`
+	Path   string      `json:"path" msgpack:"path"`
+	Method string      `json:"method,omitempty" msgpack:"method,omitempty"`
+	Body   interface{} `json:"body,omitempty" msgpack:"body,omitempty"`
+	// Cancel stops the running request of the same ID, i.g. SUBSCRIBE
+	Cancel bool `json:"cancel,omitempty" msgpack:"cancel,omitempty"`
+	// binary is the frame type of the request, the body is msgpack if true
+	binary bool
+}
+
+// WsReply answers the request of the same ID. pushed messages have empty ID and non-empty Event
+type WsReply struct {
+	ID     string         `json:"id,omitempty" msgpack:"id,omitempty"`
+	Event  string         `json:"event,omitempty" msgpack:"event,omitempty"`
+	Status int            `json:"status,omitempty" msgpack:"status,omitempty"`
+	Data   interface{}    `json:"data,omitempty" msgpack:"data,omitempty"`
+	Error  *vars.ApiError `json:"error,omitempty" msgpack:"error,omitempty"`
+}
+
+// WsConn is a connected client. Claims is parsed from the jwt of the handshake
+type WsConn struct {
+	ID     string
+	Claims jwt.MapClaims
+	Ctx    context.Context
+	ws     *websocket.Conn
+	// msgpack if the last frame of the client is binary, for the pushed messages. replies follow the frame of their request
+	binary atomic.Bool
+	mu     sync.Mutex
+	// cancel of the running requests, keyed by request id
+	running cmap.ConcurrentMap[string, context.CancelFunc]
+}
+
+// WsConns is keyed by WsConn.ID
+var WsConns = cmap.New[*WsConn]()
+
+var wsConnCounter atomic.Int64
+
+func (c *WsConn) send(reply *WsReply, binary bool) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if binary {
+		var b []byte
+		if b, err = msgpack.Marshal(reply); err == nil {
+			err = websocket.Message.Send(c.ws, b)
+		}
+		return err
+	}
+	var b []byte
+	if b, err = json.Marshal(reply); err == nil {
+		err = websocket.Message.Send(c.ws, string(b))
+	}
+	return err
+}
+
+// Push sends the event to the client, without request
+func (c *WsConn) Push(event string, data interface{}) error {
+	return c.send(&WsReply{Event: event, Data: data}, c.binary.Load())
+}
+
+// WsPush sends the event to all the connected clients that match
+func WsPush(match func(c *WsConn) bool, event string, data interface{}) {
+	for item := range WsConns.IterBuffered() {
+		if match == nil || match(item.Val) {
+			item.Val.Push(event, data)
+		}
+	}
+}
+
+// bufferedResponse captures the response of the http handler, to be sent as WsReply
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	conn   *WsConn
+	id     string
+	binary bool
+}
+
+// PushChange sends the change of SUBSCRIBE request, with the id of the request
+func (r *bufferedResponse) PushChange(event *ChangeEvent) error {
+	return r.conn.send(&WsReply{ID: r.id, Event: "change", Data: event}, r.binary)
+}
+
+// PushChunk sends the chunk of stream api, with the id of the request. the reply of the request ends the stream
+func (r *bufferedResponse) PushChunk(chunk interface{}) error {
+	return r.conn.send(&WsReply{ID: r.id, Event: "chunk", Data: chunk}, r.binary)
+}
+
+func (r *bufferedResponse) Header() http.Header { return r.header }
+func (r *bufferedResponse) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+func (r *bufferedResponse) WriteHeader(status int) { r.status = status }
+
+func wsHandshake(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" || corsAllowed(origin) {
+		return nil
+	}
+	//same origin
+	if strings.HasSuffix(origin, "://"+r.Host) {
+		return nil
+	}
+	return ErrOperationNotPermited
+}
+
+func wsServe(ws *websocket.Conn) {
+	var (
+		r         = ws.Request()
+		ctx, stop = context.WithCancel(r.Context())
+		conn      = &WsConn{ID: strconv.FormatInt(wsConnCounter.Add(1), 36), Ctx: ctx, ws: ws, running: cmap.New[context.CancelFunc]()}
+		jwtToken  = r.Header.Get("Authorization")
+	)
+	defer stop()
+	//browsers can not set header of websocket, so the jwt is allowed in query
+	if len(jwtToken) == 0 && len(r.URL.Query().Get("jwt")) > 0 {
+		jwtToken = "Bearer " + r.URL.Query().Get("jwt")
+	}
+	if len(jwtToken) > 0 {
+		svc := &DoptimeReqCtx{}
+		if err := svc.ParseJwtClaim(&http.Request{Header: http.Header{"Authorization": {jwtToken}}}); err != nil {
+			conn.send(&WsReply{Event: "error", Status: http.StatusUnauthorized, Error: vars.ToApiError(err)}, conn.binary.Load())
+			return
+		}
+		conn.Claims = svc.JwtClaims
+	}
+	WsConns.Set(conn.ID, conn)
+	defer WsConns.Remove(conn.ID)
+
+	for {
+		var (
+			req = &WsRequest{}
+			err error
+		)
+		//bad frame is answered, other errors mean the connection is broken
+		if err = wsRequestCodec.Receive(ws, &wsFrame{conn: conn, req: req}); err != nil && !errors.Is(err, vars.ErrInvalidInput) {
+			return
+		} else if err != nil {
+			conn.send(&WsReply{Status: http.StatusBadRequest, Error: vars.ToApiError(err)}, conn.binary.Load())
+			continue
+		}
+		if req.Cancel {
+			if cancel, ok := conn.running.Get(req.ID); ok {
+				cancel()
+			}
+			continue
+		}
+		go conn.serveRequest(r, jwtToken, req)
+	}
+}
+
+type wsFrame struct {
+	conn *WsConn
+	req  *WsRequest
+}
+
+// wsRequestCodec decodes the request by the type of the frame: binary is msgpack, text is json
+var wsRequestCodec = websocket.Codec{Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+	frame := v.(*wsFrame)
+	var err error
+	frame.req.binary = payloadType == websocket.BinaryFrame
+	if frame.conn.binary.Store(frame.req.binary); frame.req.binary {
+		err = msgpack.Unmarshal(data, frame.req)
+	} else {
+		err = json.Unmarshal(data, frame.req)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", vars.ErrInvalidInput, err)
+	}
+	return nil
+}}
+
+// serveRequest runs the request by the http handler, so that the semantics are exactly the same as http
+func (c *WsConn) serveRequest(upgrade *http.Request, jwtToken string, req *WsRequest) {
+	var (
+		body        []byte
+		contentType = "application/json"
+		binary      = req.binary
+		err         error
+		httpReq     *http.Request
+		reply       = &WsReply{ID: req.ID}
+	)
+	if req.Body != nil {
+		if binary {
+			body, err = msgpack.Marshal(req.Body)
+			contentType = "application/octet-stream"
+		} else {
+			body, err = json.Marshal(req.Body)
+		}
+	}
+	ctx, cancel := context.WithCancel(c.Ctx)
+	defer cancel()
+	if len(req.ID) > 0 {
+		c.running.Set(req.ID, cancel)
+		defer c.running.Remove(req.ID)
+	}
+	url := strings.TrimSuffix(cfghttp.Path, "/") + "/" + strings.TrimPrefix(req.Path, "/")
+	method := lib.Ternary(req.Method == "", http.MethodPost, strings.ToUpper(req.Method))
+	if err == nil {
+		httpReq, err = http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	}
+	if err != nil {
+		reply.Status, reply.Error = http.StatusBadRequest, vars.ToApiError(err)
+		c.send(reply, binary)
+		return
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	if len(jwtToken) > 0 {
+		httpReq.Header.Set("Authorization", jwtToken)
+	}
+	//the reply of binary client is msgpack, unless rt is specified
+	if q := httpReq.URL.Query(); binary && q.Get("rt") == "" {
+		q.Set("rt", "application/msgpack")
+		httpReq.URL.RawQuery = q.Encode()
+	}
+	httpReq.RemoteAddr, httpReq.Host = upgrade.RemoteAddr, upgrade.Host
+
+	resp := &bufferedResponse{header: http.Header{}, status: http.StatusOK, conn: c, id: req.ID, binary: binary}
+	httpRoter.ServeHTTP(resp, httpReq)
+
+	reply.Status = resp.status
+	respType := resp.header.Get("Content-Type")
+	switch {
+	case resp.status != http.StatusOK:
+		reply.Error = &vars.ApiError{}
+		if respType == "application/msgpack" {
+			err = msgpack.Unmarshal(resp.body.Bytes(), reply.Error)
+		} else {
+			err = json.Unmarshal(resp.body.Bytes(), reply.Error)
+		}
+		if err != nil {
+			reply.Error = &vars.ApiError{Code: vars.ErrCodeInternal, Message: resp.body.String()}
+		}
+	case resp.body.Len() == 0:
+		//i.g. the end of stream api, the chunks are pushed
+	case respType == "application/msgpack":
+		reply.Data = msgpack.RawMessage(resp.body.Bytes())
+	case binary || !json.Valid(resp.body.Bytes()):
+		reply.Data = resp.body.String()
+	default:
+		reply.Data = json.RawMessage(resp.body.Bytes())
+	}
+	if err = c.send(reply, binary); err != nil {
+		logger.Debug().Str("conn", c.ID).Err(err).Msg("websocket reply failed")
+	}
+}
+
+func init() {
+	AddRoute(WsPath, websocket.Server{Handshake: wsHandshake, Handler: wsServe}.ServeHTTP)
+}
@@ -2,10 +2,24 @@ package rpc
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/doptime/config/cfgapi"
+	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/doptime/utils"
+	"github.com/doptime/doptime/vars"
 )
 
+// DefaultTimeout is the timeout of rpc calls whose ctx has no deadline
+var DefaultTimeout = time.Second * 6
+
+// IdempotentCtx returns ctx carrying the idempotency key. the calls of FuncWithCtx with the same key run once,
+// the others get the result of the first call
+func IdempotentCtx(ctx context.Context, key string) context.Context {
+	return utils.WithIdempotencyKey(ctx, key)
+}
+
 // ApiOption is parameter to create an API, RPC, or CallAt
 type Context[i any, o any] struct {
 	Name          string
@@ -13,7 +27,11 @@ type Context[i any, o any] struct {
 	ApiSourceHttp *cfgapi.ApiSourceHttp
 	Ctx           context.Context
 	Func          func(InParameter i) (ret o, err error)
-	Validate      func(pIn interface{}) error
+	// FuncWithCtx calls the api with the deadline of ctx, which is propagated to the worker
+	FuncWithCtx func(ctx context.Context, InParameter i) (ret o, err error)
+	// Timeout is used when ctx has no deadline
+	Timeout  time.Duration
+	Validate func(pIn interface{}) error
 	// you can rewrite input parameter before excecute the service
 	ParamEnhancer func(param i) (out i, err error)
 
@@ -22,4 +40,28 @@ type Context[i any, o any] struct {
 
 	// you can modify the result value to the web client.
 	ResponseModifier func(param i, ret o) (valueToWebclient interface{}, err error)
+
+	// Interceptors wrap the calls by the rpc, on the side of the caller. the global ones of httpapi.UseInterceptors run where the api runs
+	Interceptors []httpapi.Interceptor
+}
+
+// Intercept appends interceptors to the rpc, the one appended first is the outer one
+func (rpc *Context[i, o]) Intercept(interceptors ...httpapi.Interceptor) *Context[i, o] {
+	rpc.Interceptors = append(rpc.Interceptors, interceptors...)
+	return rpc
+}
+
+// intercepted wraps the call with the interceptors of the rpc
+func (rpc *Context[i, o]) intercepted(call func(ctx context.Context, InParam i) (ret o, err error)) func(ctx context.Context, InParam i) (ret o, err error) {
+	return func(ctx context.Context, InParam i) (ret o, err error) {
+		out, err := httpapi.Intercept(ctx, rpc.Name, InParam, false, rpc.Interceptors, func(ctx context.Context, in interface{}) (interface{}, error) {
+			InParam, ok := in.(i)
+			if !ok {
+				return nil, fmt.Errorf("%w: interceptor changed the input of %s to %T", vars.ErrInvalidInput, rpc.Name, in)
+			}
+			return call(ctx, InParam)
+		})
+		ret, _ = out.(o)
+		return ret, err
+	}
 }
@@ -51,6 +51,7 @@ func (a *Context[i, o]) CallByMap(ctx context.Context, _map map[string]interface
 	//load fill the left fields from db
 	if a.ParamEnhancer != nil {
 		if out, err := a.ParamEnhancer(in); err != nil {
+			return nil, err
 		} else if isTypeInPtr {
 			pIn = out
 		} else {
@@ -63,13 +64,13 @@ func (a *Context[i, o]) CallByMap(ctx context.Context, _map map[string]interface
 		return nil, err
 	}
 	//post save the result to db
-	ret, err = a.Func(in)
+	out, err := a.FuncWithCtx(ctx, in)
 	if a.ResultSaver != nil && err == nil {
-		_ = a.ResultSaver(in, ret.(o))
+		err = a.ResultSaver(in, out)
 	}
 	//modify the result value to the web client.
-	if a.ResponseModifier != nil {
-		ret, err = a.ResponseModifier(in, ret.(o))
+	if a.ResponseModifier != nil && err == nil {
+		return a.ResponseModifier(in, out)
 	}
-	return ret, err
+	return out, err
 }
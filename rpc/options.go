@@ -1,10 +1,14 @@
 package rpc
 
+import "time"
+
 // Option is parameter to create an API, RPC, or CallAt
 type Option struct {
 	ApiSourceRds  string
 	ApiSourceHttp string
 	ApiKey        string
+	// Timeout of the call if ctx has no deadline. 0 means DefaultTimeout
+	Timeout time.Duration
 }
 type optionSetter func(*Option)
 
@@ -31,6 +35,13 @@ func WithApiKey(apiKey string) optionSetter {
 	}
 }
 
+// WithTimeout sets the timeout of the calls without deadline in ctx
+func WithTimeout(timeout time.Duration) optionSetter {
+	return func(o *Option) {
+		o.Timeout = timeout
+	}
+}
+
 func (o Option) mergeNewOptions(optionSetters ...optionSetter) (out *Option) {
 	for _, setter := range optionSetters {
 		setter(&o)
@@ -9,6 +9,7 @@ import (
 	"github.com/doptime/config/cfgredis"
 	"github.com/doptime/doptime/httpserve/httpapi"
 	"github.com/doptime/doptime/utils"
+	"github.com/doptime/doptime/vars"
 	"github.com/doptime/logger"
 	"github.com/doptime/redisdb"
 	"github.com/redis/go-redis/v9"
@@ -22,11 +23,11 @@ func Rpc[i any, o any](options ...optionSetter) (rpc *Context[i, o]) {
 
 	var option *Option = Option{ApiSourceRds: "default"}.mergeNewOptions(options...)
 
-	rpc = &Context[i, o]{Name: utils.ApiNameByType((*i)(nil)), ApiSourceRds: option.ApiSourceRds, Ctx: context.Background(),
+	rpc = &Context[i, o]{Name: utils.ApiNameByType((*i)(nil)), ApiSourceRds: option.ApiSourceRds, Ctx: context.Background(), Timeout: option.Timeout,
 		Validate: redisdb.NeedValidate(reflect.TypeOf(new(i)).Elem()),
 	}
 
-	rpc.Func = func(InParam i) (ret o, err error) {
+	rpc.FuncWithCtx = rpc.intercepted(func(ctx context.Context, InParam i) (ret o, err error) {
 
 		var (
 			results []string
@@ -34,33 +35,37 @@ func Rpc[i any, o any](options ...optionSetter) (rpc *Context[i, o]) {
 			b       []byte
 			db      *redis.Client
 			exists  bool
+			cancel  context.CancelFunc
 		)
+		//the deadline is sent to the worker with the job, so that the worker drops the job if the caller is gone
+		if _, ok := ctx.Deadline(); !ok {
+			timeout := rpc.Timeout
+			if timeout <= 0 {
+				timeout = DefaultTimeout
+			}
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
 		if b, err = utils.MarshalApiInput(InParam); err != nil {
 			return ret, err
 		}
-		var Values = []string{"data", string(b)}
-
-		// if hashCallAt {
-		// 	Values = []string{"timeAt", strconv.FormatInt(ops.CallAt.UnixMilli(), 10), "data", string(b)}
-		// } else {
-		// 	Values = []string{"data", string(b)}
-		// }
 		if db, exists = cfgredis.Servers.Get(rpc.ApiSourceRds); !exists {
 			logger.Info().Str("DataSource not defined in enviroment", rpc.ApiSourceRds).Send()
 			return ret, err
 		}
-		args := &redis.XAddArgs{Stream: rpc.Name, Values: Values, MaxLen: 4096}
-		if cmd = db.XAdd(rpc.Ctx, args); cmd.Err() != nil {
+		args := &redis.XAddArgs{Stream: rpc.Name, Values: utils.StreamValues(ctx, b), MaxLen: 4096}
+		if cmd = db.XAdd(ctx, args); cmd.Err() != nil {
 			logger.Info().AnErr("Do XAdd", cmd.Err()).Send()
 			return ret, cmd.Err()
 		}
-		// if hashCallAt {
-		// 	return out, nil
-		// }
 
 		//BLPop 返回结果 [key1,value1,key2,value2]
 		//cmd.Val() is the stream id, the result will be poped from the list with this id
-		if results, err = db.BLPop(context.Background(), time.Second*6, cmd.Val()).Result(); err != nil {
+		deadline, _ := ctx.Deadline()
+		errKey := utils.ReplyErrorKey(cmd.Val())
+		if results, err = db.BLPop(ctx, time.Until(deadline), cmd.Val(), errKey).Result(); err == redis.Nil || ctx.Err() != nil {
+			return ret, context.DeadlineExceeded
+		} else if err != nil {
 			return ret, err
 		}
 
@@ -68,6 +73,14 @@ func Rpc[i any, o any](options ...optionSetter) (rpc *Context[i, o]) {
 			return ret, errors.New("BLPop result length error")
 		}
 		b = []byte(results[1])
+		//the api returned error, rebuild it from the envelope
+		if results[0] == errKey {
+			apiErr := &vars.ApiError{}
+			if err = msgpack.Unmarshal(b, apiErr); err != nil {
+				return ret, err
+			}
+			return ret, apiErr
+		}
 		oType := reflect.TypeOf((*o)(nil)).Elem()
 		//if o type is a pointer, use reflect.New to create a new pointer
 		if oType.Kind() == reflect.Ptr {
@@ -76,6 +89,9 @@ func Rpc[i any, o any](options ...optionSetter) (rpc *Context[i, o]) {
 		}
 		oValueWithPointer := reflect.New(oType).Interface().(*o)
 		return *oValueWithPointer, msgpack.Unmarshal(b, oValueWithPointer)
+	})
+	rpc.Func = func(InParam i) (ret o, err error) {
+		return rpc.FuncWithCtx(rpc.Ctx, InParam)
 	}
 
 	httpapi.ApiViaHttp.Set(rpc.Name, rpc)
@@ -2,7 +2,6 @@ package rpc
 
 import (
 	"context"
-	"fmt"
 	"reflect"
 	"strconv"
 	"time"
@@ -19,6 +18,7 @@ import (
 // This New function is for the case the API is defined outside of this package.
 // If the API is defined in this package, use Api() instead.
 // timeAt is ID of the task. if you want's to cancel the task, you should provide the same timeAt
+// the task is persisted in the data source of the api, and fired by exactly one instance serving the api
 func CallAt[i any, o any](f func(InParam i) (ret o, err error)) (callAtFun func(timeAt time.Time, InParam i) (err error)) {
 	var (
 		db      *redis.Client
@@ -37,20 +37,17 @@ func CallAt[i any, o any](f func(InParam i) (ret o, err error)) (callAtFun func(
 	}
 
 	callAtFun = func(timeAt time.Time, InParam i) (err error) {
-		var (
-			b      []byte
-			cmd    *redis.StringCmd
-			Values []string
-		)
+		var b []byte
 		if b, err = utils.MarshalApiInput(InParam); err != nil {
 			return err
 		}
-		fmt.Println("CallAt", apiName, timeAt.UnixNano())
-		Values = []string{"timeAt", strconv.FormatInt(timeAt.UnixNano(), 10), "data", string(b)}
-		args := &redis.XAddArgs{Stream: apiName, Values: Values, MaxLen: 4096}
-		if cmd = db.XAdd(ctx, args); cmd.Err() != nil {
-			logger.Info().AnErr("Do XAdd", cmd.Err()).Send()
-			return cmd.Err()
+		taskID := strconv.FormatInt(timeAt.UnixNano(), 10)
+		pipeline := db.TxPipeline()
+		pipeline.HSet(ctx, utils.CallAtDataKey(apiName), taskID, string(b))
+		pipeline.ZAdd(ctx, utils.CallAtScheduleKey(apiName), redis.Z{Score: float64(timeAt.UnixMilli()), Member: taskID})
+		if _, err = pipeline.Exec(ctx); err != nil {
+			logger.Info().AnErr("CallAt save task", err).Send()
+			return err
 		}
 		return nil
 
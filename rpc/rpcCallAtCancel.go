@@ -18,8 +18,8 @@ func CallAtCancel[i any](f func(timeAt time.Time, InParam i) (err error), timeAt
 	var (
 		Rds    *redis.Client
 		api    httpapi.ApiInterface
-		Values []string
 		exists bool
+		ctx    = context.Background()
 	)
 	funcPtr := reflect.ValueOf(f).Pointer()
 	if api, exists = callAtfun2Api.Get(funcPtr); !exists {
@@ -29,12 +29,14 @@ func CallAtCancel[i any](f func(timeAt time.Time, InParam i) (err error), timeAt
 		logger.Info().Str("DataSource not defined in enviroment", api.GetDataSource()).Send()
 		return fmt.Errorf("DataSource not defined in enviroment")
 	}
-	Values = []string{"timeAt", strconv.FormatInt(timeAt.UnixNano(), 10), "data", ""}
-	args := &redis.XAddArgs{Stream: api.GetName(), Values: Values, MaxLen: 4096}
-	//use Rds.XAdd rather than Rds.HSet, to prevent Hset before receiing the result of  XAdd
-	if cmd := Rds.XAdd(context.Background(), args); cmd.Err() != nil {
-		logger.Info().AnErr("Do XAdd", cmd.Err()).Send()
-		return cmd.Err()
+	taskID := strconv.FormatInt(timeAt.UnixNano(), 10)
+	//remove from both the schedule and the data, in one transaction, so the task can not be half claimed
+	pipeline := Rds.TxPipeline()
+	pipeline.ZRem(ctx, utils.CallAtScheduleKey(api.GetName()), taskID)
+	pipeline.HDel(ctx, utils.CallAtDataKey(api.GetName()), taskID)
+	if _, err = pipeline.Exec(ctx); err != nil {
+		logger.Info().AnErr("CallAtCancel remove task", err).Send()
+		return err
 	}
 	return nil
 }
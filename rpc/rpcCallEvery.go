@@ -0,0 +1,199 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/doptime/config/cfgredis"
+	"github.com/doptime/doptime/httpserve/httpapi"
+	"github.com/doptime/doptime/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// EveryTask is a recurring call of an api
+type EveryTask struct {
+	ID     string
+	Spec   string
+	Paused bool
+	// zero if paused
+	NextAt time.Time
+}
+
+var ErrEveryTaskNotFound = errors.New("recurring task not found")
+
+// register the task only if it does not exist, so that every replica can register the same task at startup
+// KEYS[1] spec hash, KEYS[2] data hash, KEYS[3] schedule zset; ARGV[1] id, ARGV[2] spec, ARGV[3] data, ARGV[4] next fire in unix milli
+var callEveryRegisterScript = redis.NewScript(`
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[3], ARGV[4], ARGV[1])
+return 1
+`)
+
+// KEYS[1] spec hash, KEYS[2] schedule zset; ARGV[1] id, ARGV[2] next fire in unix milli
+var callEveryResumeScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[2], 'NX', ARGV[2], ARGV[1])
+return 1
+`)
+
+func callEveryTarget(funcPtr uintptr, name string) (apiName string, db *redis.Client, err error) {
+	var (
+		apiInfo httpapi.ApiInterface
+		exists  bool
+	)
+	if apiInfo, exists = httpapi.GetApiByFunc(funcPtr); !exists {
+		return "", nil, fmt.Errorf("service function should be defined By Api or Rpc before used in CallEvery: %s", name)
+	}
+	if db, exists = cfgredis.Servers.Get(apiInfo.GetDataSource()); !exists {
+		return "", nil, fmt.Errorf("DataSource not defined in enviroment: %s", apiInfo.GetDataSource())
+	}
+	return apiInfo.GetName(), db, nil
+}
+
+// CallEvery calls the api repeatedly, by cron expression ("0 2 * * *"), descriptor ("@daily", "@every 5m") or interval ("5m").
+// the task is persisted in the data source of the api. each tick is fired by exactly one instance serving the api.
+// the task id is derived from spec & parameter, so registering the same task again (i.g. by every replica at startup) is a no-op
+func CallEvery[i any, o any](f func(InParam i) (ret o, err error), spec string, InParam i) (taskID string, err error) {
+	var (
+		schedule utils.Schedule
+		apiName  string
+		db       *redis.Client
+		b        []byte
+	)
+	if schedule, err = utils.ParseSchedule(spec); err != nil {
+		return "", err
+	} else if schedule.Next(time.Now()).IsZero() {
+		return "", fmt.Errorf("schedule never fires: %s", spec)
+	}
+	if apiName, db, err = callEveryTarget(reflect.ValueOf(f).Pointer(), utils.ApiNameByType((*i)(nil))); err != nil {
+		return "", err
+	}
+	if b, err = utils.MarshalApiInput(InParam); err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	h.Write([]byte(spec))
+	h.Write(b)
+	taskID = strconv.FormatUint(h.Sum64(), 36)
+
+	keys := []string{utils.CallEverySpecKey(apiName), utils.CallEveryDataKey(apiName), utils.CallEveryScheduleKey(apiName)}
+	nextAt := schedule.Next(time.Now()).UnixMilli()
+	if err = callEveryRegisterScript.Run(context.Background(), db, keys, taskID, spec, string(b), nextAt).Err(); err != nil {
+		return "", err
+	}
+	return taskID, nil
+}
+
+// CallEveryPause stops firing the task, until CallEveryResume
+func CallEveryPause[i any, o any](f func(InParam i) (ret o, err error), taskID string) (err error) {
+	var (
+		apiName string
+		db      *redis.Client
+		exists  bool
+		c       = context.Background()
+	)
+	if apiName, db, err = callEveryTarget(reflect.ValueOf(f).Pointer(), utils.ApiNameByType((*i)(nil))); err != nil {
+		return err
+	}
+	if exists, err = db.HExists(c, utils.CallEverySpecKey(apiName), taskID).Result(); err != nil {
+		return err
+	} else if !exists {
+		return ErrEveryTaskNotFound
+	}
+	return db.ZRem(c, utils.CallEveryScheduleKey(apiName), taskID).Err()
+}
+
+// CallEveryResume schedules the paused task from now on. resuming a running task changes nothing
+func CallEveryResume[i any, o any](f func(InParam i) (ret o, err error), taskID string) (err error) {
+	var (
+		apiName  string
+		db       *redis.Client
+		spec     string
+		schedule utils.Schedule
+		resumed  int
+		c        = context.Background()
+	)
+	if apiName, db, err = callEveryTarget(reflect.ValueOf(f).Pointer(), utils.ApiNameByType((*i)(nil))); err != nil {
+		return err
+	}
+	if spec, err = db.HGet(c, utils.CallEverySpecKey(apiName), taskID).Result(); err == redis.Nil {
+		return ErrEveryTaskNotFound
+	} else if err != nil {
+		return err
+	}
+	if schedule, err = utils.ParseSchedule(spec); err != nil {
+		return err
+	}
+	keys := []string{utils.CallEverySpecKey(apiName), utils.CallEveryScheduleKey(apiName)}
+	if resumed, err = callEveryResumeScript.Run(c, db, keys, taskID, schedule.Next(time.Now()).UnixMilli()).Int(); err != nil {
+		return err
+	} else if resumed == 0 {
+		return ErrEveryTaskNotFound
+	}
+	return nil
+}
+
+// CallEveryCancel removes the task permanently
+func CallEveryCancel[i any, o any](f func(InParam i) (ret o, err error), taskID string) (err error) {
+	var (
+		apiName string
+		db      *redis.Client
+		c       = context.Background()
+	)
+	if apiName, db, err = callEveryTarget(reflect.ValueOf(f).Pointer(), utils.ApiNameByType((*i)(nil))); err != nil {
+		return err
+	}
+	pipeline := db.TxPipeline()
+	pipeline.ZRem(c, utils.CallEveryScheduleKey(apiName), taskID)
+	pipeline.HDel(c, utils.CallEveryDataKey(apiName), taskID)
+	pipeline.HDel(c, utils.CallEverySpecKey(apiName), taskID)
+	_, err = pipeline.Exec(c)
+	return err
+}
+
+// CallEveryList lists the recurring tasks of the api, ordered by the next fire time. paused tasks come last
+func CallEveryList[i any, o any](f func(InParam i) (ret o, err error)) (tasks []*EveryTask, err error) {
+	var (
+		apiName string
+		db      *redis.Client
+		c       = context.Background()
+	)
+	if apiName, db, err = callEveryTarget(reflect.ValueOf(f).Pointer(), utils.ApiNameByType((*i)(nil))); err != nil {
+		return nil, err
+	}
+	pipeline := db.Pipeline()
+	specsCmd := pipeline.HGetAll(c, utils.CallEverySpecKey(apiName))
+	scheduleCmd := pipeline.ZRangeWithScores(c, utils.CallEveryScheduleKey(apiName), 0, -1)
+	if _, err = pipeline.Exec(c); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	nextAt := map[string]int64{}
+	for _, z := range scheduleCmd.Val() {
+		nextAt[z.Member.(string)] = int64(z.Score)
+	}
+	for id, spec := range specsCmd.Val() {
+		task := &EveryTask{ID: id, Spec: spec, Paused: true}
+		if ms, ok := nextAt[id]; ok {
+			task.Paused, task.NextAt = false, time.UnixMilli(ms)
+		}
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(a, b int) bool {
+		if tasks[a].Paused != tasks[b].Paused {
+			return !tasks[a].Paused
+		}
+		return tasks[a].NextAt.Before(tasks[b].NextAt)
+	})
+	return tasks, nil
+}
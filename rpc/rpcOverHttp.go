@@ -3,6 +3,7 @@ package rpc
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"reflect"
@@ -11,12 +12,13 @@ import (
 	"github.com/doptime/config/cfgapi"
 	"github.com/doptime/doptime/httpserve/httpapi"
 	"github.com/doptime/doptime/utils"
+	"github.com/doptime/doptime/vars"
 	"github.com/doptime/logger"
 	"github.com/doptime/redisdb"
 	"github.com/vmihailenco/msgpack/v5"
 )
 
-func callViaHttp(url string, jwt string, InParam interface{}, retValueWithPointer interface{}) (err error) {
+func callViaHttp(ctx context.Context, url string, jwt string, InParam interface{}, retValueWithPointer interface{}) (err error) {
 	var (
 		b, revBytes []byte
 		req         *http.Request
@@ -39,13 +41,16 @@ func callViaHttp(url string, jwt string, InParam interface{}, retValueWithPointe
 		Timeout: 10 * time.Second,
 	}
 
-	if req, err = http.NewRequest("POST", url, bytes.NewBuffer(b)); err != nil {
+	if req, err = http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(b)); err != nil {
 		return err
 	}
 	if len(jwt) > 0 {
 		req.Header.Add("Authorization", "Bearer "+jwt)
 	}
 	req.Header.Add("Content-Type", "application/octet-stream")
+	if key := utils.IdempotencyKeyOf(ctx); key != "" {
+		req.Header.Add(utils.IdempotencyHeader, key)
+	}
 
 	if resp, err = client.Do(req); err != nil {
 		return err
@@ -54,6 +59,14 @@ func callViaHttp(url string, jwt string, InParam interface{}, retValueWithPointe
 	if revBytes, err = io.ReadAll(resp.Body); err != nil {
 		return err
 	}
+	//the body of failed call is the error envelope
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &vars.ApiError{}
+		if err = msgpack.Unmarshal(revBytes, apiErr); err != nil || len(apiErr.Code) == 0 {
+			return fmt.Errorf("http status %d: %s", resp.StatusCode, string(revBytes))
+		}
+		return apiErr
+	}
 	return msgpack.Unmarshal(revBytes, retValueWithPointer)
 }
 
@@ -69,16 +82,18 @@ func RpcOverHttp[i any, o any](options ...optionSetter) (rpc *Context[i, o]) {
 	rpc = &Context[i, o]{Name: utils.ApiNameByType((*i)(nil)), ApiSourceHttp: httpServer, Ctx: context.Background(),
 		Validate: redisdb.NeedValidate(reflect.TypeOf(new(i)).Elem()),
 	}
-	rpc.Func = func(InParam i) (ret o, err error) {
+	rpc.FuncWithCtx = rpc.intercepted(func(ctx context.Context, InParam i) (ret o, err error) {
 		oType := reflect.TypeOf((*o)(nil)).Elem()
 		//if o type is a pointer, use reflect.New to create a new pointer
 		if oType.Kind() == reflect.Ptr {
 			ret = reflect.New(oType.Elem()).Interface().(o)
-			return ret, callViaHttp(rpc.ApiSourceHttp.UrlBase+"/API-!"+rpc.Name+"-!rt~application%2Fmsgpack", rpc.ApiSourceHttp.ApiKey, InParam, ret)
+			return ret, callViaHttp(ctx, rpc.ApiSourceHttp.UrlBase+"/API-!"+rpc.Name+"-!rt~application%2Fmsgpack", rpc.ApiSourceHttp.ApiKey, InParam, ret)
 		}
 		oValueWithPointer := reflect.New(oType).Interface().(*o)
-		return *oValueWithPointer, callViaHttp(rpc.ApiSourceHttp.UrlBase+"/API-!"+rpc.Name+"-!rt~application%2Fmsgpack", rpc.ApiSourceHttp.ApiKey, InParam, oValueWithPointer)
-
+		return *oValueWithPointer, callViaHttp(ctx, rpc.ApiSourceHttp.UrlBase+"/API-!"+rpc.Name+"-!rt~application%2Fmsgpack", rpc.ApiSourceHttp.ApiKey, InParam, oValueWithPointer)
+	})
+	rpc.Func = func(InParam i) (ret o, err error) {
+		return rpc.FuncWithCtx(rpc.Ctx, InParam)
 	}
 
 	httpapi.ApiViaHttp.Set(rpc.Name, rpc)
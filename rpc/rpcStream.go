@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"reflect"
+	"time"
+
+	"github.com/doptime/config/cfgredis"
+	"github.com/doptime/doptime/utils"
+	"github.com/doptime/doptime/vars"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// DefaultStreamTimeout is the timeout of the whole stream call, if ctx has no deadline
+var DefaultStreamTimeout = time.Second * 120
+
+// StreamContext calls the api created by api.ApiStream, and iterates the chunks as they arrive
+type StreamContext[i any, o any] struct {
+	Name         string
+	ApiSourceRds string
+	Ctx          context.Context
+	// Timeout is used when ctx has no deadline
+	Timeout     time.Duration
+	FuncWithCtx func(ctx context.Context, InParameter i) iter.Seq2[o, error]
+	Func        func(InParameter i) iter.Seq2[o, error]
+}
+
+// RpcStream creates the caller of a stream api. the chunks are relayed by the worker through a redis stream per call:
+//
+//	for chunk, err := range DemoStream(&InDemo{}) {
+//		if err != nil { ... }
+//	}
+func RpcStream[i any, o any](options ...optionSetter) (rpc *StreamContext[i, o]) {
+	var option *Option = Option{ApiSourceRds: "default"}.mergeNewOptions(options...)
+
+	rpc = &StreamContext[i, o]{Name: utils.ApiNameByType((*i)(nil)), ApiSourceRds: option.ApiSourceRds, Ctx: context.Background(), Timeout: option.Timeout}
+	rpc.FuncWithCtx = func(ctx context.Context, InParam i) iter.Seq2[o, error] {
+		return func(yield func(o, error) bool) {
+			var (
+				zero   o
+				cancel context.CancelFunc
+			)
+			if _, ok := ctx.Deadline(); !ok {
+				timeout := rpc.Timeout
+				if timeout <= 0 {
+					timeout = DefaultStreamTimeout
+				}
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			if err := rpc.iterate(ctx, InParam, yield); err != nil {
+				yield(zero, err)
+			}
+		}
+	}
+	rpc.Func = func(InParam i) iter.Seq2[o, error] {
+		return rpc.FuncWithCtx(rpc.Ctx, InParam)
+	}
+	return rpc
+}
+
+// iterate yields the chunks until the end entry, or the error entry of the reply stream
+func (rpc *StreamContext[i, o]) iterate(ctx context.Context, InParam i, yield func(o, error) bool) (err error) {
+	var (
+		b       []byte
+		db      *redis.Client
+		exists  bool
+		id      string
+		streams []redis.XStream
+	)
+	if b, err = utils.MarshalApiInput(InParam); err != nil {
+		return err
+	}
+	if db, exists = cfgredis.Servers.Get(rpc.ApiSourceRds); !exists {
+		return fmt.Errorf("DataSource not defined in enviroment: %s", rpc.ApiSourceRds)
+	}
+	values := append(utils.StreamValues(ctx, b), utils.StreamField, "1")
+	if id, err = db.XAdd(ctx, &redis.XAddArgs{Stream: rpc.Name, Values: values, MaxLen: 4096}).Result(); err != nil {
+		return err
+	}
+	replyFrom := utils.ReplyStreamKey(id)
+	defer db.Del(context.Background(), replyFrom)
+
+	for lastID := "0"; ; {
+		deadline, _ := ctx.Deadline()
+		block := min(time.Until(deadline), time.Second*5)
+		if block <= 0 {
+			return context.DeadlineExceeded
+		}
+		args := &redis.XReadArgs{Streams: []string{replyFrom, lastID}, Count: 64, Block: block}
+		if streams, err = db.XRead(ctx, args).Result(); err == redis.Nil {
+			continue
+		} else if ctx.Err() != nil {
+			return context.DeadlineExceeded
+		} else if err != nil {
+			return err
+		}
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				lastID = message.ID
+				if _, ok := message.Values["end"]; ok {
+					return nil
+				}
+				if envelope, ok := message.Values["error"].(string); ok {
+					apiErr := &vars.ApiError{}
+					if err = msgpack.Unmarshal([]byte(envelope), apiErr); err != nil {
+						return err
+					}
+					return apiErr
+				}
+				data, _ := message.Values["data"].(string)
+				if chunk, err := decodeChunk[o]([]byte(data)); err != nil {
+					return err
+				} else if !yield(chunk, nil) {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func decodeChunk[o any](b []byte) (ret o, err error) {
+	oType := reflect.TypeOf((*o)(nil)).Elem()
+	//if o type is a pointer, use reflect.New to create a new pointer
+	if oType.Kind() == reflect.Ptr {
+		ret = reflect.New(oType.Elem()).Interface().(o)
+		return ret, msgpack.Unmarshal(b, ret)
+	}
+	oValueWithPointer := reflect.New(oType).Interface().(*o)
+	return *oValueWithPointer, msgpack.Unmarshal(b, oValueWithPointer)
+}
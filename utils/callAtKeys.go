@@ -0,0 +1,45 @@
+package utils
+
+// keys of the CallAt / CallEvery scheduler, shared by the caller (rpc) and the dispatcher (api).
+// the keys are hash tagged by the api stream, i.g. "{api:demo}:delay", so that the scripts touching them and the stream
+// are in one slot of redis cluster
+
+// CallAtDataKey is the hash of task id (unix nano of the fire time) => msgpack parameter
+func CallAtDataKey(apiName string) string {
+	return "{" + apiName + "}:delay"
+}
+
+// CallAtScheduleKey is the zset of task id, scored by the fire time in unix milli
+func CallAtScheduleKey(apiName string) string {
+	return "{" + apiName + "}:delay:at"
+}
+
+// LegacyCallAtDataKey & LegacyCallAtScheduleKey are the keys without hash tag, of the older versions. the tasks in them are migrated
+func LegacyCallAtDataKey(apiName string) string {
+	return apiName + ":delay"
+}
+
+func LegacyCallAtScheduleKey(apiName string) string {
+	return apiName + ":delay:at"
+}
+
+// CallEverySpecKey is the hash of recurring task id => schedule spec
+func CallEverySpecKey(apiName string) string {
+	return "{" + apiName + "}:every"
+}
+
+// CallEveryDataKey is the hash of recurring task id => msgpack parameter
+func CallEveryDataKey(apiName string) string {
+	return "{" + apiName + "}:every:data"
+}
+
+// CallEveryScheduleKey is the zset of recurring task id, scored by the next fire time in unix milli.
+// paused tasks are removed from it, but kept in the spec hash
+func CallEveryScheduleKey(apiName string) string {
+	return "{" + apiName + "}:every:at"
+}
+
+// LegacyCallEveryKeys are the spec hash, data hash and schedule zset without hash tag, of the older versions
+func LegacyCallEveryKeys(apiName string) (spec, data, schedule string) {
+	return apiName + ":every", apiName + ":every:data", apiName + ":every:at"
+}
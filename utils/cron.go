@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the next fire time after t
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// IntervalSchedule fires every fixed duration
+type IntervalSchedule struct {
+	Every time.Duration
+}
+
+func (s IntervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.Every)
+}
+
+// CronSchedule is a standard 5 fields cron: minute hour day-of-month month day-of-week.
+// each field is a bit set of the allowed values
+type CronSchedule struct {
+	Minute, Hour, Dom, Month, Dow uint64
+	// true if the field is "*", used for the OR semantic of day-of-month and day-of-week
+	DomStar, DowStar bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+var cronDowNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// ParseSchedule accepts:
+// 1. cron expressions, i.g. "*/5 * * * *", "0 2 * * mon-fri"
+// 2. descriptors: @yearly @monthly @weekly @daily @hourly, and "@every 5m"
+// 3. go durations for fixed intervals, i.g. "5m", "1h30m"
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		spec = strings.TrimSpace(every)
+	} else if cron, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = cron
+	}
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("interval should be positive: %s", spec)
+		}
+		return IntervalSchedule{Every: d}, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression should have 5 fields: %s", spec)
+	}
+	var (
+		s   = &CronSchedule{DomStar: fields[2] == "*" || fields[2] == "?", DowStar: fields[4] == "*" || fields[4] == "?"}
+		err error
+	)
+	if s.Minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if s.Hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if s.Dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if s.Month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, err
+	}
+	if s.Dow, err = parseCronField(fields[4], 0, 7, cronDowNames); err != nil {
+		return nil, err
+	}
+	//7 is sunday as well
+	if s.Dow&(1<<7) != 0 {
+		s.Dow |= 1
+	}
+	return s, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (bits uint64, err error) {
+	parseValue := func(v string) (int, error) {
+		if n, ok := names[strings.ToLower(v)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("cron value %q out of range [%d, %d]", v, min, max)
+		}
+		return n, nil
+	}
+	for _, part := range strings.Split(field, ",") {
+		var (
+			start, end, step = min, max, 1
+			rangePart        = part
+		)
+		if r, stepStr, ok := strings.Cut(part, "/"); ok {
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid cron step: %s", part)
+			}
+			rangePart = r
+		}
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			lo, hi, _ := strings.Cut(rangePart, "-")
+			if start, err = parseValue(lo); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(hi); err != nil {
+				return 0, err
+			}
+		default:
+			if start, err = parseValue(rangePart); err != nil {
+				return 0, err
+			}
+			//"5/15" means from 5 to max every 15
+			if !strings.Contains(part, "/") {
+				end = start
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("invalid cron range: %s", part)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.Dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.Dow&(1<<uint(t.Weekday())) != 0
+	//when both day-of-month and day-of-week are restricted, either matches
+	if !s.DomStar && !s.DowStar {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// Next searches field by field, from month to minute. gives up after 5 years, for expressions like "0 0 30 2 *"
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+	for t.Year() <= yearLimit {
+		if s.Month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.Hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.Minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule_Next(t *testing.T) {
+	base := time.Date(2026, 10, 18, 10, 7, 30, 0, time.UTC)
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/5 * * * *", time.Date(2026, 10, 18, 10, 10, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2026, 10, 19, 2, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 10, 18, 11, 0, 0, 0, time.UTC)},
+		{"30 9 * * mon-fri", time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * 3", time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC)},
+		{"5m", base.Add(5 * time.Minute)},
+		{"@every 1h30m", base.Add(90 * time.Minute)},
+	}
+	for _, c := range cases {
+		s, err := ParseSchedule(c.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) failed: %v", c.spec, err)
+		}
+		if got := s.Next(base); !got.Equal(c.want) {
+			t.Errorf("ParseSchedule(%q).Next = %v, want %v", c.spec, got, c.want)
+		}
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "61 * * * *", "*/0 * * * *", "5-1 * * * *", "-5m"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) should fail", spec)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// DeadlineField is the field of the api stream message, holding the deadline of the call in unix milli.
+// the worker drops the job if the deadline is passed before it runs
+const DeadlineField = "deadline"
+
+// StreamValues builds the api stream message of the call, with the deadline & the idempotency key of ctx if any
+func StreamValues(ctx context.Context, data []byte) (values []string) {
+	values = []string{"data", string(data)}
+	if deadline, ok := ctx.Deadline(); ok {
+		values = append(values, DeadlineField, strconv.FormatInt(deadline.UnixMilli(), 10))
+	}
+	if key := IdempotencyKeyOf(ctx); key != "" {
+		values = append(values, IdempotencyField, key)
+	}
+	return values
+}
+
+// DeadlineOfMessage returns the deadline carried by the stream message. ok is false if the caller set none
+func DeadlineOfMessage(values map[string]interface{}) (deadline time.Time, ok bool) {
+	str, _ := values[DeadlineField].(string)
+	if len(str) == 0 {
+		return deadline, false
+	}
+	ms, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return deadline, false
+	}
+	return time.UnixMilli(ms), true
+}
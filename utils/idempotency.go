@@ -0,0 +1,22 @@
+package utils
+
+import "context"
+
+// IdempotencyField is the field of the api stream message, holding the idempotency key of the call
+const IdempotencyField = "idempotencyKey"
+
+// IdempotencyHeader is the http header of the idempotency key
+const IdempotencyHeader = "Idempotency-Key"
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey returns ctx carrying the idempotency key, the calls of the same key run once
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// IdempotencyKeyOf returns the idempotency key carried by ctx, "" if none
+func IdempotencyKeyOf(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	return key
+}
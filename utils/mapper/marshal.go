@@ -139,9 +139,10 @@ func parseEncoderTag(fieldName string, tag string) string {
 
 	// 3. 提取名称部分
 	if len(parts) > 0 {
-		candidate := parts[0]
+		// 兼容标准 json tag 的选项，如 "error,omitempty"
+		candidate, _, _ := strings.Cut(parts[0], ",")
 		// 如果第一部分不是指令（不以 @ 开头），则它就是名字
-		if !strings.HasPrefix(candidate, "@") {
+		if candidate != "" && !strings.HasPrefix(candidate, "@") {
 			return candidate
 		}
 	}
@@ -0,0 +1,18 @@
+package utils
+
+// the worker pushes the result of a stream job to the list named by the message id,
+// and the error envelope to ReplyErrorKey. the rpc caller BLPops both
+
+// ReplyErrorKey is the list of the error envelope of the job
+func ReplyErrorKey(messageID string) string {
+	return messageID + ":err"
+}
+
+// StreamField marks the stream message whose caller iterates the chunks of the result
+const StreamField = "stream"
+
+// ReplyStreamKey is the redis stream relaying the chunks of the job.
+// each entry has one of the fields: "data" the msgpack chunk, "error" the error envelope, "end"
+func ReplyStreamKey(messageID string) string {
+	return messageID + ":stream"
+}
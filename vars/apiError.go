@@ -0,0 +1,133 @@
+package vars
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	cmap "github.com/orcaman/concurrent-map/v2"
+)
+
+var ErrNotFound error = errors.New("not found")
+var ErrForbidden error = errors.New("forbidden")
+var ErrConflict error = errors.New("conflict")
+var ErrTooManyRequests error = errors.New("too many requests")
+
+// ApiError is the error envelope sent back to the caller, on the rpc reply list or in the http response body.
+// the receiver rebuilds it as a typed error, so errors.Is(err, vars.ErrInvalidInput) holds on both sides
+type ApiError struct {
+	Code      string      `json:"code" msgpack:"code"`
+	Message   string      `json:"message" msgpack:"message"`
+	Details   interface{} `json:"details,omitempty" msgpack:"details,omitempty"`
+	Retryable bool        `json:"retryable" msgpack:"retryable"`
+}
+
+func (e *ApiError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the sentinel error registered with the code
+func (e *ApiError) Unwrap() error {
+	if code, ok := ErrorCodes.Get(e.Code); ok {
+		return code.Err
+	}
+	return nil
+}
+
+// detailedError carries the details of the envelope, the wrapped error keeps its code
+type detailedError struct {
+	error
+	details interface{}
+}
+
+func (e *detailedError) Unwrap() error { return e.error }
+
+// WithDetails attaches details to err, they are sent back in the Details of the envelope.
+// i.g. return vars.WithDetails(fmt.Errorf("%w: age", vars.ErrInvalidInput), map[string]string{"age": "must be positive"})
+func WithDetails(err error, details interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return &detailedError{error: err, details: details}
+}
+
+// ErrorCode binds a sentinel error to the code in the envelope, and the http status of it
+type ErrorCode struct {
+	Err        error
+	HttpStatus int
+	Retryable  bool
+}
+
+// ErrorCodes is keyed by code
+var ErrorCodes = cmap.New[*ErrorCode]()
+
+// errorCodeOrder are the codes in the order of registration, ToApiError matches them in this order
+var errorCodeOrder struct {
+	sync.RWMutex
+	codes []string
+}
+
+const ErrCodeInternal = "internal"
+
+// RegisterErrorCode makes the sentinel error survive rpc & http boundaries.
+// an error matching several sentinels gets the code registered first; registering a code again keeps its place
+func RegisterErrorCode(code string, err error, httpStatus int, retryable bool) {
+	errorCodeOrder.Lock()
+	defer errorCodeOrder.Unlock()
+	if !ErrorCodes.Has(code) {
+		errorCodeOrder.codes = append(errorCodeOrder.codes, code)
+	}
+	ErrorCodes.Set(code, &ErrorCode{Err: err, HttpStatus: httpStatus, Retryable: retryable})
+}
+
+func init() {
+	type codeOf struct {
+		code string
+		err  error
+	}
+	//slices rather than maps, so that the order of registration is fixed
+	for _, c := range []codeOf{{"parameter", ErrParm}, {"invalid_data", ErrInvalidData}, {"invalid_input", ErrInvalidInput},
+		{"invalid_field", ErrInvalidField}, {"invalid_key", ErrInvalidKey}, {"invalid_value", ErrInvalidValue}, {"invalid_type", ErrInvalidType},
+		{"invalid_method", ErrInvalidMethod}, {"api_name_empty", ErrApiNameEmpty}} {
+		RegisterErrorCode(c.code, c.err, http.StatusBadRequest, false)
+	}
+	for _, c := range []codeOf{{"jwt", ErrJWT}, {"invalid_jwt", ErrInvalidJwt}, {"invalid_jwt_field", ErrInvalidJwtField},
+		{"invalid_auth", ErrInvalidAuth}, {"invalid_user_or_password", ErrInvalidUserOrPassword}} {
+		RegisterErrorCode(c.code, c.err, http.StatusUnauthorized, false)
+	}
+	RegisterErrorCode("forbidden", ErrForbidden, http.StatusForbidden, false)
+	RegisterErrorCode("not_found", ErrNotFound, http.StatusNotFound, false)
+	RegisterErrorCode("conflict", ErrConflict, http.StatusConflict, false)
+	RegisterErrorCode("too_many_requests", ErrTooManyRequests, http.StatusTooManyRequests, true)
+	RegisterErrorCode("deadline_exceeded", context.DeadlineExceeded, http.StatusGatewayTimeout, true)
+}
+
+// ToApiError wraps err into the envelope, with the first registered code whose sentinel matches.
+// errors matching no registered sentinel get ErrCodeInternal. the details attached by WithDetails go to Details
+func ToApiError(err error) *ApiError {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var details interface{}
+	if detailed := (*detailedError)(nil); errors.As(err, &detailed) {
+		details = detailed.details
+	}
+	errorCodeOrder.RLock()
+	defer errorCodeOrder.RUnlock()
+	for _, code := range errorCodeOrder.codes {
+		if item, ok := ErrorCodes.Get(code); ok && errors.Is(err, item.Err) {
+			return &ApiError{Code: code, Message: err.Error(), Details: details, Retryable: item.Retryable}
+		}
+	}
+	return &ApiError{Code: ErrCodeInternal, Message: err.Error(), Details: details}
+}
+
+// HttpStatusOf maps the error to http status, 500 if the code is not registered
+func HttpStatusOf(err error) int {
+	if code, ok := ErrorCodes.Get(ToApiError(err).Code); ok {
+		return code.HttpStatus
+	}
+	return http.StatusInternalServerError
+}
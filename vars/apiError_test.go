@@ -0,0 +1,75 @@
+package vars
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestApiError_RoundTrip(t *testing.T) {
+	cases := []struct {
+		err    error
+		target error
+		status int
+	}{
+		{fmt.Errorf("bad id: %w", ErrInvalidInput), ErrInvalidInput, http.StatusBadRequest},
+		{ErrInvalidJwt, ErrInvalidJwt, http.StatusUnauthorized},
+		{fmt.Errorf("no such api: %w", ErrNotFound), ErrNotFound, http.StatusNotFound},
+		{context.DeadlineExceeded, context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{&ApiError{Code: "conflict", Message: "version mismatch", Details: "v3"}, ErrConflict, http.StatusConflict},
+	}
+	for _, c := range cases {
+		b, err := msgpack.Marshal(ToApiError(c.err))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := &ApiError{}
+		if err = msgpack.Unmarshal(b, got); err != nil {
+			t.Fatal(err)
+		}
+		if !errors.Is(got, c.target) {
+			t.Errorf("errors.Is(%v, %v) = false after round trip", got, c.target)
+		}
+		if got.Error() != c.err.Error() {
+			t.Errorf("message = %q, want %q", got.Error(), c.err.Error())
+		}
+		if status := HttpStatusOf(got); status != c.status {
+			t.Errorf("HttpStatusOf(%v) = %d, want %d", got, status, c.status)
+		}
+	}
+	if got := ToApiError(errors.New("boom")); got.Code != ErrCodeInternal || HttpStatusOf(got) != http.StatusInternalServerError {
+		t.Errorf("unregistered error = %+v", got)
+	}
+}
+
+func TestToApiError_RegistrationOrder(t *testing.T) {
+	errFirst, errSecond := errors.New("first"), errors.New("second")
+	RegisterErrorCode("test_first", errFirst, http.StatusBadRequest, false)
+	RegisterErrorCode("test_second", errSecond, http.StatusConflict, false)
+	//the error matching both sentinels gets the code registered first, every time
+	both := fmt.Errorf("%w and %w", errSecond, errFirst)
+	for i := 0; i < 100; i++ {
+		if got := ToApiError(both); got.Code != "test_first" {
+			t.Fatalf("code = %q, want test_first", got.Code)
+		}
+	}
+}
+
+func TestToApiError_Details(t *testing.T) {
+	err := fmt.Errorf("create user: %w", WithDetails(fmt.Errorf("age: %w", ErrInvalidInput), map[string]string{"age": "must be positive"}))
+	b, _ := msgpack.Marshal(ToApiError(err))
+	got := &ApiError{}
+	if err := msgpack.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != "invalid_input" || got.Message != err.Error() || fmt.Sprint(got.Details) != "map[age:must be positive]" {
+		t.Errorf("envelope = %+v", got)
+	}
+	if WithDetails(nil, "x") != nil {
+		t.Error("WithDetails(nil) should be nil")
+	}
+}